@@ -1,6 +1,28 @@
 package qgo
 
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	cachego "cache_go"
+)
+
 type TwoQ[T comparable] struct {
+	// Mu guards the queues and PageBuffer. Get takes it for reading for
+	// a hit that leaves the queues as they are, an A1in hit or an Am hit
+	// on the key already at the head of Am, and only takes it for
+	// writing when an Am hit has to move its key to the head. Every
+	// other method that changes the cache takes it for writing, and the
+	// ones that only read take it for reading. The hit and miss counts
+	// are updated atomically so Gets sharing the lock can count. Equal
+	// is called with Mu held and must not call back into the cache.
+	// KeyNorm is called before Mu is taken, so it may call back into the
+	// cache but runs concurrently when several goroutines use it.
+	// OnPromote and OnDemote run after Mu is released.
+	Mu sync.RWMutex
+
 	K_In       int
 	K_Out      int
 	PageBuffer map[T]*Page
@@ -8,11 +30,61 @@ type TwoQ[T comparable] struct {
 	A1in       *FIFO[T]
 	Am         *LRU[T]
 	A1out      *FIFO[T]
+
+	// PromoteThreshold is the number of A1out hits a key needs before it
+	// is promoted to Am. Below the threshold it is re-admitted to A1in.
+	PromoteThreshold int
+	ghostHits        map[T]int
+
+	// OnPromote is called when a key moves from A1out to Am and OnDemote
+	// when a key is pushed out of A1in into A1out. They run once Insert
+	// has finished changing the queues, so they may call back into the
+	// cache.
+	OnPromote func(key T)
+	OnDemote  func(key T)
+	events    []transition[T]
+
+	// Equal, when set, lets Set skip storing a value equal to the one a
+	// resident key already holds. Values are of type any and not always
+	// comparable, so it is left to the caller to pick a comparison,
+	// reflect.DeepEqual being the catch all. When nil every Set of a
+	// resident key counts as a change.
+	Equal func(a, b any) bool
+
+	// KeyNorm, when set, maps every key passed to Get, Set, TrySet,
+	// Insert, Delete and Location to the form it is stored under, e.g.
+	// lower case, so spellings of the same key share one entry. It has
+	// to be deterministic and return the same form for every spelling,
+	// or a key could end up stored twice or never be found. nil leaves
+	// keys as they are. It is called without Mu held, see Mu, so it has
+	// to be safe for concurrent use.
+	KeyNorm func(key T) T
+
+	// MaxBytes is an optional budget on the summed size of the values of
+	// all resident pages, in A1in and Am alike, 0 disables it. A1out only
+	// remembers keys and costs nothing. SizeOf measures a value, when nil
+	// a []byte or string counts its length and anything else 0.
+	MaxBytes  int
+	SizeOf    func(value any) int
+	bytesUsed int
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type transition[T comparable] struct {
+	key      T
+	promoted bool
 }
 
 type Page struct {
 	data      any
 	queueType string
+	size      int
+
+	// promotedVia is how the page got to its queue, see Location.
+	promotedVia Route
 }
 
 type Node[T comparable] struct {
@@ -22,6 +94,25 @@ type Node[T comparable] struct {
 	next           *Node[T]
 }
 
+// isHead, isTail and isInterior tell the sentinels of a queue apart
+// from the nodes holding keys, see newSentinels.
+func (node *Node[T]) isHead() bool     { return node.end_identifier == 1 }
+func (node *Node[T]) isTail() bool     { return node.end_identifier == -1 }
+func (node *Node[T]) isInterior() bool { return node.end_identifier == 0 }
+
+// newSentinels returns the linked head and tail of an empty queue. FIFO
+// and LRU only ever get their sentinels from here and never replace
+// them, so the operations on them can rely on Head and Tail being the
+// right kind of node without checking.
+func newSentinels[T comparable]() (head, tail *Node[T]) {
+	tail = &Node[T]{end_identifier: -1}
+	head = &Node[T]{end_identifier: 1}
+
+	head.next = tail
+	tail.prev = head
+	return head, tail
+}
+
 func deleteNode[T comparable](node *Node[T]) {
 	next := node.next
 	prev := node.prev
@@ -51,15 +142,12 @@ type FIFO[T comparable] struct {
 }
 
 func NewFIFO[T comparable]() *FIFO[T] {
-	tail := &Node[T]{end_identifier: -1}
-	head := &Node[T]{end_identifier: 1}
-
-	head.next = tail
-	tail.prev = head
+	head, tail := newSentinels[T]()
 
 	return &FIFO[T]{
-		Tail: tail,
-		Head: head,
+		Nodes: make(map[T]*Node[T]),
+		Tail:  tail,
+		Head:  head,
 	}
 }
 
@@ -68,13 +156,18 @@ func (fifo *FIFO[T]) isPresent(key T) bool {
 	return present
 }
 
-func (fifo *FIFO[T]) add(key T) *Node[T] {
-	head := fifo.Head
-
-	if head.end_identifier != 1 {
-		panic("this has to be head")
+func (fifo *FIFO[T]) remove(key T) bool {
+	node, present := fifo.Nodes[key]
+	if !present {
+		return false
 	}
+	deleteNode(node)
+	delete(fifo.Nodes, key)
+	return true
+}
 
+func (fifo *FIFO[T]) add(key T) *Node[T] {
+	head := fifo.Head
 	next_to_head := head.next
 
 	newNode := NewNode(key, head, next_to_head)
@@ -85,14 +178,8 @@ func (fifo *FIFO[T]) add(key T) *Node[T] {
 
 func (fifo *FIFO[T]) evict() (key T, evicted bool) {
 	var defaultValue T
-	tail := fifo.Tail
-	if tail.end_identifier != -1 {
-		panic("tail is not initialized properly")
-	}
-
-	prev := tail.prev
-
-	if prev.end_identifier == 1 {
+	prev := fifo.Tail.prev
+	if prev.isHead() {
 		return defaultValue, false
 	}
 	defaultValue = prev.key
@@ -110,25 +197,17 @@ type LRU[T comparable] struct {
 
 // func (lru *LRU[T])
 func NewLRU[T comparable]() *LRU[T] {
-	tail := &Node[T]{end_identifier: -1}
-	head := &Node[T]{end_identifier: 1}
-
-	head.next = tail
-	tail.prev = head
+	head, tail := newSentinels[T]()
 
 	return &LRU[T]{
-		Tail: tail,
-		Head: head,
+		Nodes: make(map[T]*Node[T]),
+		Tail:  tail,
+		Head:  head,
 	}
 }
 
 func (lru *LRU[T]) add(key T) *Node[T] {
 	head := lru.Head
-
-	if head.end_identifier != 1 {
-		panic("this has to be head")
-	}
-
 	next_to_head := head.next
 
 	newNode := NewNode(key, head, next_to_head)
@@ -137,25 +216,23 @@ func (lru *LRU[T]) add(key T) *Node[T] {
 	return newNode
 }
 
+// access moves key to the head of the LRU. It only relinks the node, so
+// it takes constant time and does not allocate.
 func (lru *LRU[T]) access(key T) {
 	node := lru.Nodes[key]
 	deleteNode(node)
 	head := lru.getHead()
 
+	node.prev = head
 	node.next = head.next
+	head.next.prev = node
 	head.next = node
 }
 
 func (lru *LRU[T]) evict() (T, bool) {
 	var defaultValue T
-	tail := lru.Tail
-	if tail.end_identifier != -1 {
-		panic("tail is not initialized properly")
-	}
-
-	prev := tail.prev
-
-	if prev.end_identifier == 1 {
+	prev := lru.Tail.prev
+	if prev.isHead() {
 		return defaultValue, false
 	}
 
@@ -168,80 +245,599 @@ func (lru *LRU[T]) evict() (T, bool) {
 }
 
 func (lru *LRU[T]) getHead() *Node[T] {
-	head := lru.Head
-	if head.end_identifier != 1 {
-		panic("how")
-	}
-	return head
+	return lru.Head
 }
 
+// NewTwoQ creates a TwoQ with capacity page slots and its queues ready
+// for use. K_In and K_Out start at a quarter and a half of the capacity,
+// the sizes the paper recommends, and can be changed with SetKInKOut.
 func NewTwoQ[T comparable](capacity int) *TwoQ[T] {
+	if capacity <= 0 {
+		panic("capacity has to be greater than 0")
+	}
 
 	return &TwoQ[T]{
-		Capacity: capacity,
+		K_In:             max(capacity/4, 1),
+		K_Out:            max(capacity/2, 1),
+		PageBuffer:       make(map[T]*Page),
+		Capacity:         capacity,
+		A1in:             NewFIFO[T](),
+		Am:               NewLRU[T](),
+		A1out:            NewFIFO[T](),
+		PromoteThreshold: 1,
+		ghostHits:        make(map[T]int),
 	}
 }
 
-func (twoQ *TwoQ[T]) reclaimFor() {
+// NewTwoQWithBytes creates a TwoQ bounded both by the number of pages
+// and by the summed size of their values, see MaxBytes.
+func NewTwoQWithBytes[T comparable](capacity int, maxBytes int) *TwoQ[T] {
+	if maxBytes <= 0 {
+		panic("byte capacity has to be greater than 0")
+	}
+	twoQ := NewTwoQ[T](capacity)
+	twoQ.MaxBytes = maxBytes
+	return twoQ
+}
+
+// BytesUsed returns the summed size of the values of all resident pages.
+func (twoQ *TwoQ[T]) BytesUsed() int {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
 
-	if len(twoQ.PageBuffer) < twoQ.Capacity {
-		return
+	return twoQ.bytesUsed
+}
+
+// sizeOf returns the size of value as counted against MaxBytes.
+func (twoQ *TwoQ[T]) sizeOf(value any) int {
+	if twoQ.SizeOf == nil {
+		switch value := value.(type) {
+		case []byte:
+			return len(value)
+		case string:
+			return len(value)
+		}
+		return 0
 	}
-	if len(twoQ.A1in.Nodes) >= twoQ.K_In {
-		key, evicted := twoQ.A1in.evict()
+	size := twoQ.SizeOf(value)
+	if size < 0 {
+		panic("size cannot be negative")
+	}
+	return size
+}
+
+// fits reports whether a value of size could ever be stored, a value
+// over MaxBytes is not even after evicting everything.
+func (twoQ *TwoQ[T]) fits(size int) bool {
+	return twoQ.MaxBytes <= 0 || size <= twoQ.MaxBytes
+}
+
+// reclaimFor evicts until there is a free page slot and room for size
+// more bytes, so that admitting one key never takes PageBuffer over
+// Capacity or the values over MaxBytes. A1in gives up its oldest key
+// once it holds K_In keys, or when Am has nothing left to give. size
+// has to fit, see fits.
+func (twoQ *TwoQ[T]) reclaimFor(size int) {
+	for len(twoQ.PageBuffer) >= twoQ.Capacity ||
+		(twoQ.MaxBytes > 0 && twoQ.bytesUsed+size > twoQ.MaxBytes) {
+		if len(twoQ.A1in.Nodes) >= twoQ.K_In || len(twoQ.Am.Nodes) == 0 {
+			twoQ.demote()
+			continue
+		}
+
+		key, evicted := twoQ.Am.evict()
 		if !evicted {
 			panic("why cant we evict")
 		}
-
+		twoQ.bytesUsed -= twoQ.PageBuffer[key].size
 		delete(twoQ.PageBuffer, key)
-		twoQ.A1out.add(key)
+		twoQ.evictions++
+	}
+}
 
-		if len(twoQ.A1out.Nodes) > twoQ.K_Out {
-			_, evicted := twoQ.A1out.evict()
-			if !evicted {
-				panic("why cant we evict")
-			}
-		}
-		return
+// SetKInKOut changes K_In and K_Out on a live cache, e.g. for a tuner
+// shifting protection between recency and frequency. kIn has to be
+// between 1 and Capacity and kOut must not be negative. A1in keys over
+// the new K_In are demoted to A1out right away, oldest first, and
+// A1out is trimmed to the new K_Out; larger limits only take effect as
+// the queues fill. OnDemote runs for every key spilled.
+func (twoQ *TwoQ[T]) SetKInKOut(kIn, kOut int) {
+	defer twoQ.fireEvents()
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	if kIn <= 0 || kIn > twoQ.Capacity || kOut < 0 {
+		panic("K_In has to be between 1 and the capacity and K_Out cannot be negative")
 	}
 
-	key, evicted := twoQ.Am.evict()
+	twoQ.K_In = kIn
+	twoQ.K_Out = kOut
+	for len(twoQ.A1in.Nodes) > twoQ.K_In {
+		twoQ.demote()
+	}
+	twoQ.trimA1out()
+}
+
+// demote moves the oldest A1in key to A1out, trimming A1out to K_Out.
+func (twoQ *TwoQ[T]) demote() {
+	key, evicted := twoQ.A1in.evict()
 	if !evicted {
 		panic("why cant we evict")
 	}
+
+	twoQ.bytesUsed -= twoQ.PageBuffer[key].size
 	delete(twoQ.PageBuffer, key)
+	twoQ.evictions++
+	twoQ.A1out.add(key)
+	twoQ.events = append(twoQ.events, transition[T]{key: key})
 
+	twoQ.trimA1out()
 }
-func (twoQ *TwoQ[T]) Insert(key T, value any) (any, bool) {
 
-	if twoQ.A1out.isPresent(key) {
-		twoQ.reclaimFor()
-		twoQ.Am.add(key)
-		twoQ.PageBuffer[key] = &Page{
-			data:      value,
-			queueType: "A_M",
+// trimA1out forgets the oldest A1out keys until at most K_Out are left.
+func (twoQ *TwoQ[T]) trimA1out() {
+	for len(twoQ.A1out.Nodes) > twoQ.K_Out {
+		ghost, evicted := twoQ.A1out.evict()
+		if !evicted {
+			panic("why cant we evict")
 		}
-		return value, true
+		delete(twoQ.ghostHits, ghost)
 	}
+}
+
+// insertState is where a key stands when it is referenced, which decides
+// the transition Insert makes.
+type insertState int
+
+const (
+	stateMiss insertState = iota
+	stateA1inHit
+	stateAmHit
+	stateA1outHit
+)
+
+func (twoQ *TwoQ[T]) stateOf(key T) insertState {
+	if twoQ.A1out.isPresent(key) {
+		return stateA1outHit
+	}
+
 	page, present := twoQ.PageBuffer[key]
+	switch {
+	case !present:
+		return stateMiss
+	case page.queueType == "A_M":
+		return stateAmHit
+	default:
+		return stateA1inHit
+	}
+}
 
-	if !present {
-		twoQ.reclaimFor()
+// norm returns the form key is stored under, see KeyNorm.
+func (twoQ *TwoQ[T]) norm(key T) T {
+	if twoQ.KeyNorm == nil {
+		return key
+	}
+	return twoQ.KeyNorm(key)
+}
+
+// admit makes room for key and places it at the head of A1in or Am.
+// The value has to fit, see fits.
+func (twoQ *TwoQ[T]) admit(key T, value any, size int, queueType string) {
+	twoQ.reclaimFor(size)
+	if queueType == "A_M" {
+		twoQ.Am.add(key)
+	} else {
 		twoQ.A1in.add(key)
-		twoQ.PageBuffer[key] = &Page{
-			data:      value,
-			queueType: "A1_In",
+	}
+	twoQ.PageBuffer[key] = &Page{
+		data:      value,
+		queueType: queueType,
+		size:      size,
+	}
+	twoQ.bytesUsed += size
+}
+
+// Get looks key up without changing its value. A hit in Am moves the
+// key to the head of Am; a key that is not resident, including one only
+// remembered in A1out, is a miss and nothing moves until it is Set. Only
+// an Am hit that moves its key takes Mu for writing.
+func (twoQ *TwoQ[T]) Get(key T) (any, bool) {
+	key = twoQ.norm(key)
+
+	twoQ.Mu.RLock()
+	data, hit, done := twoQ.get(key, false)
+	twoQ.Mu.RUnlock()
+	if done {
+		return data, hit
+	}
+
+	// The key has to move, and may have been moved or evicted by the
+	// time the write lock is held, so it is looked up again.
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	data, hit, _ = twoQ.get(key, true)
+	return data, hit
+}
+
+// get does the lookup of Get. With exclusive false Mu is only held for
+// reading and an Am hit that would move its key is left alone, counted
+// neither as a hit nor a miss, and reported not done.
+func (twoQ *TwoQ[T]) get(key T, exclusive bool) (data any, hit, done bool) {
+	switch twoQ.stateOf(key) {
+	case stateAmHit:
+		if twoQ.Am.Head.next != twoQ.Am.Nodes[key] {
+			if !exclusive {
+				return nil, false, false
+			}
+			twoQ.Am.access(key)
 		}
-		return value, false
+		fallthrough
+
+	case stateA1inHit:
+		atomic.AddUint64(&twoQ.hits, 1)
+		return twoQ.PageBuffer[key].data, true, true
+
+	default:
+		atomic.AddUint64(&twoQ.misses, 1)
+		return nil, false, true
 	}
+}
 
-	if page.queueType == "A1_In" {
-		return page.data, true
+// Set stores value under key and reports whether it changed what the
+// cache holds. A resident key keeps its place apart from an Am key
+// moving to the head of Am, a key found in A1out is promoted the same
+// way Insert promotes it and a new key is admitted to A1in. When Equal
+// finds value equal to the resident one the write is skipped and Set
+// reports no change, the access is still recorded. A value larger than
+// MaxBytes is not stored at all and Set reports no change. Set leaves
+// the hit and miss counts to Get.
+func (twoQ *TwoQ[T]) Set(key T, value any) (changed bool) {
+	key = twoQ.norm(key)
+	defer twoQ.fireEvents()
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	if !twoQ.fits(twoQ.sizeOf(value)) {
+		return false
 	}
+	return twoQ.set(key, value)
+}
 
+// set is Set for a value known to fit, with Mu held.
+func (twoQ *TwoQ[T]) set(key T, value any) (changed bool) {
+	switch twoQ.stateOf(key) {
+	case stateA1inHit:
+		changed = twoQ.update(key, value)
+
+	case stateAmHit:
+		twoQ.Am.access(key)
+		changed = twoQ.update(key, value)
+
+	case stateA1outHit:
+		twoQ.readmit(key, value)
+		changed = true
+
+	default:
+		twoQ.admit(key, value, twoQ.sizeOf(value), "A1_In")
+		changed = true
+	}
+	return changed
+}
+
+// update stores value for a resident key unless Equal says it already
+// holds it. A value that grows the page past MaxBytes takes the page
+// out and admits it again at the head of its queue, so the eviction that
+// makes room never picks the page being updated.
+func (twoQ *TwoQ[T]) update(key T, value any) bool {
+	page := twoQ.PageBuffer[key]
+	if twoQ.Equal != nil && twoQ.Equal(page.data, value) {
+		return false
+	}
+
+	size := twoQ.sizeOf(value)
+	if twoQ.MaxBytes > 0 && twoQ.bytesUsed-page.size+size > twoQ.MaxBytes {
+		twoQ.removePage(key, page)
+		twoQ.admit(key, value, size, page.queueType)
+		twoQ.PageBuffer[key].promotedVia = page.promotedVia
+		return true
+	}
+
+	twoQ.bytesUsed += size - page.size
+	page.data = value
+	page.size = size
+	return true
+}
+
+// removePage takes the resident key out of its queue and PageBuffer.
+func (twoQ *TwoQ[T]) removePage(key T, page *Page) {
 	if page.queueType == "A_M" {
+		deleteNode(twoQ.Am.Nodes[key])
+		delete(twoQ.Am.Nodes, key)
+	} else {
+		twoQ.A1in.remove(key)
+	}
+	twoQ.bytesUsed -= page.size
+	delete(twoQ.PageBuffer, key)
+}
+
+// Delete removes key right away, e.g. when the data it caches changed,
+// and reports whether it was resident. A key only remembered in A1out
+// is forgotten too, but not reported. Unlike an eviction the key does
+// not move to A1out and it is not counted as an eviction.
+func (twoQ *TwoQ[T]) Delete(key T) bool {
+	key = twoQ.norm(key)
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	if twoQ.A1out.remove(key) {
+		delete(twoQ.ghostHits, key)
+		return false
+	}
+	page, present := twoQ.PageBuffer[key]
+	if !present {
+		return false
+	}
+	twoQ.removePage(key, page)
+	return true
+}
+
+// Len returns the number of resident keys, those of A1out excluded.
+func (twoQ *TwoQ[T]) Len() int {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	return len(twoQ.PageBuffer)
+}
+
+// Insert references key. It returns the resident value and true on a
+// hit, value and true on an A1out hit, which readmits the key, and value
+// with false when the key was not known:
+//
+//   - miss: the key is admitted to A1in.
+//   - A1in hit: nothing moves, A1in is a FIFO and correlated references
+//     must not promote.
+//   - Am hit: the key moves to the head of Am.
+//   - A1out hit: the key was seen recently enough to prove reuse and is
+//     admitted to Am, or back to A1in while it has fewer than
+//     PromoteThreshold A1out hits.
+//
+// A value larger than MaxBytes is never admitted, Insert returns it with
+// false, A1out hit or not, and leaves the queues as they are. Only hits
+// on A1in and Am count as hits in Stats.
+//
+// Deprecated: Insert never updates a resident value, use Get to read and
+// Set to write.
+func (twoQ *TwoQ[T]) Insert(key T, value any) (any, bool) {
+	key = twoQ.norm(key)
+	defer twoQ.fireEvents()
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	return twoQ.reference(key, value)
+}
+
+// fireEvents runs the callbacks for the transitions of the last Insert.
+// It is deferred before Mu is taken, so it runs after the lock is
+// released.
+func (twoQ *TwoQ[T]) fireEvents() {
+	twoQ.Mu.Lock()
+	events := twoQ.events
+	twoQ.events = nil
+	onPromote, onDemote := twoQ.OnPromote, twoQ.OnDemote
+	twoQ.Mu.Unlock()
+
+	for _, event := range events {
+		if event.promoted && onPromote != nil {
+			onPromote(event.key)
+		} else if !event.promoted && onDemote != nil {
+			onDemote(event.key)
+		}
+	}
+}
+
+func (twoQ *TwoQ[T]) reference(key T, value any) (any, bool) {
+
+	switch twoQ.stateOf(key) {
+	case stateA1inHit:
+		twoQ.hits++
+		return twoQ.PageBuffer[key].data, true
+
+	case stateAmHit:
+		twoQ.hits++
 		twoQ.Am.access(key)
+		return twoQ.PageBuffer[key].data, true
+
+	case stateA1outHit:
+		twoQ.misses++
+		if !twoQ.fits(twoQ.sizeOf(value)) {
+			return value, false
+		}
+		twoQ.readmit(key, value)
+		return value, true
+
+	default:
+		twoQ.misses++
+		if size := twoQ.sizeOf(value); twoQ.fits(size) {
+			twoQ.admit(key, value, size, "A1_In")
+		}
+		return value, false
+	}
+}
+
+// readmit brings back a key found in A1out, into Am once it has
+// PromoteThreshold A1out hits and into A1in before that. A1out kept no
+// value, so the page is sized by the value it comes back with, which
+// has to fit.
+func (twoQ *TwoQ[T]) readmit(key T, value any) {
+	twoQ.A1out.remove(key)
+	twoQ.ghostHits[key]++
+
+	queueType, route := "A1_In", RouteA1outReadmit
+	if twoQ.ghostHits[key] >= twoQ.PromoteThreshold {
+		delete(twoQ.ghostHits, key)
+		queueType, route = "A_M", RouteA1outPromote
+	}
+	twoQ.admit(key, value, twoQ.sizeOf(value), queueType)
+	twoQ.PageBuffer[key].promotedVia = route
+	if queueType == "A_M" {
+		twoQ.events = append(twoQ.events, transition[T]{key: key, promoted: true})
+	}
+}
+
+// CheckInvariants reports the first inconsistency between the queues
+// and PageBuffer: at most Capacity resident keys, each linked in the
+// queue its page names and nowhere else, Am holding only keys promoted
+// from A1out, A1out holding only evicted keys and at most K_Out of them,
+// the page sizes adding up to BytesUsed within MaxBytes, and every queue
+// correctly linked.
+func (twoQ *TwoQ[T]) CheckInvariants() error {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	if len(twoQ.PageBuffer) > twoQ.Capacity {
+		return fmt.Errorf("%d resident keys exceed the capacity of %d", len(twoQ.PageBuffer), twoQ.Capacity)
+	}
+	if len(twoQ.A1in.Nodes)+len(twoQ.Am.Nodes) != len(twoQ.PageBuffer) {
+		return fmt.Errorf("A1in and Am hold %d keys but PageBuffer holds %d", len(twoQ.A1in.Nodes)+len(twoQ.Am.Nodes), len(twoQ.PageBuffer))
+	}
+	if len(twoQ.A1out.Nodes) > twoQ.K_Out {
+		return fmt.Errorf("A1out holds %d keys, more than K_Out %d", len(twoQ.A1out.Nodes), twoQ.K_Out)
 	}
 
-	return page.data, true
+	if twoQ.MaxBytes > 0 && twoQ.bytesUsed > twoQ.MaxBytes {
+		return fmt.Errorf("%d bytes used exceed the budget of %d", twoQ.bytesUsed, twoQ.MaxBytes)
+	}
+
+	bytesUsed := 0
+	for key, page := range twoQ.PageBuffer {
+		bytesUsed += page.size
+		inA1in := twoQ.A1in.isPresent(key)
+		_, inAm := twoQ.Am.Nodes[key]
+		switch {
+		case twoQ.A1out.isPresent(key):
+			return fmt.Errorf("resident key %v is also in A1out", key)
+		case page.queueType == "A_M" && (!inAm || inA1in):
+			return fmt.Errorf("key %v is marked A_M but is not only in Am", key)
+		case page.queueType == "A1_In" && (!inA1in || inAm):
+			return fmt.Errorf("key %v is marked A1_In but is not only in A1in", key)
+		case page.queueType == "A_M" && page.promotedVia != RouteA1outPromote:
+			return fmt.Errorf("key %v is in Am without having been promoted from A1out", key)
+		case page.queueType == "A1_In" && page.promotedVia == RouteA1outPromote:
+			return fmt.Errorf("key %v is in A1in but marked as promoted to Am", key)
+		}
+	}
+	if bytesUsed != twoQ.bytesUsed {
+		return fmt.Errorf("pages hold %d bytes but the tracked total is %d", bytesUsed, twoQ.bytesUsed)
+	}
+
+	queues := []struct {
+		name  string
+		head  *Node[T]
+		tail  *Node[T]
+		nodes map[T]*Node[T]
+	}{
+		{"A1in", twoQ.A1in.Head, twoQ.A1in.Tail, twoQ.A1in.Nodes},
+		{"Am", twoQ.Am.Head, twoQ.Am.Tail, twoQ.Am.Nodes},
+		{"A1out", twoQ.A1out.Head, twoQ.A1out.Tail, twoQ.A1out.Nodes},
+	}
+	for _, queue := range queues {
+		count := 0
+		prev := queue.head
+		for node := queue.head.next; !node.isTail(); node = node.next {
+			if node.prev != prev {
+				return fmt.Errorf("%s: node %v has a broken prev link", queue.name, node.key)
+			}
+			if queue.nodes[node.key] != node {
+				return fmt.Errorf("%s: node %v is not the one in its map", queue.name, node.key)
+			}
+			count++
+			if count > len(queue.nodes) {
+				return fmt.Errorf("%s: more linked nodes than the %d in its map", queue.name, len(queue.nodes))
+			}
+			prev = node
+		}
+		if queue.tail.prev != prev {
+			return fmt.Errorf("%s: tail has a broken prev link", queue.name)
+		}
+		if count != len(queue.nodes) {
+			return fmt.Errorf("%s: %d linked nodes but %d in its map", queue.name, count, len(queue.nodes))
+		}
+	}
+	return nil
+}
+
+// Entries returns the resident keys of Am from least to most recently
+// used, followed by those of A1in from oldest to newest.
+func (twoQ *TwoQ[T]) Entries() []cachego.Entry[T, any] {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	entries := make([]cachego.Entry[T, any], 0, len(twoQ.PageBuffer))
+	for _, tail := range []*Node[T]{twoQ.Am.Tail, twoQ.A1in.Tail} {
+		for node := tail.prev; node.isInterior(); node = node.prev {
+			entries = append(entries, cachego.Entry[T, any]{Key: node.key, Value: twoQ.PageBuffer[node.key].data})
+		}
+	}
+	return entries
+}
+
+// AmKeysByRecency returns the keys of Am from the most recently used, at
+// the head, to the least recently used at the tail, the next one Am
+// gives up. It walks the list, nothing is counted or moved.
+func (twoQ *TwoQ[T]) AmKeysByRecency() []T {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	keys := make([]T, 0, len(twoQ.Am.Nodes))
+	for node := twoQ.Am.Head.next; node.isInterior(); node = node.next {
+		keys = append(keys, node.key)
+	}
+	return keys
+}
+
+// String lists every queue from head to tail and the use of the page
+// buffer, e.g. "A1in[d c], Am[a b], A1out[e], buffer=4/4". It walks the
+// linked lists, so the order is the one the queues evict in reverse.
+func (twoQ *TwoQ[T]) String() string {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	var b strings.Builder
+	for i, queue := range []struct {
+		name string
+		head *Node[T]
+	}{
+		{"A1in", twoQ.A1in.Head},
+		{"Am", twoQ.Am.Head},
+		{"A1out", twoQ.A1out.Head},
+	} {
+		if i > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(queue.name)
+		b.WriteByte('[')
+		for node := queue.head.next; node.isInterior(); node = node.next {
+			if node != queue.head.next {
+				b.WriteByte(' ')
+			}
+			fmt.Fprint(&b, node.key)
+		}
+		b.WriteByte(']')
+	}
+	fmt.Fprintf(&b, ", buffer=%d/%d", len(twoQ.PageBuffer), twoQ.Capacity)
+	return b.String()
+}
+
+func (twoQ *TwoQ[T]) Stats() cachego.Stats {
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	return cachego.Stats{
+		Hits:      atomic.LoadUint64(&twoQ.hits),
+		Misses:    atomic.LoadUint64(&twoQ.misses),
+		Evictions: twoQ.evictions,
+		Len:       len(twoQ.PageBuffer),
+		Cap:       twoQ.Capacity,
+	}
 }
@@ -1,7 +1,15 @@
 package qgo
 
 import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"cache_go/cachetest"
 )
 
 // TestNodeOperations tests the basic node operations
@@ -120,10 +128,13 @@ func TestLRUOperations(t *testing.T) {
 	// Test access operation (should move node1 to the front)
 	lru.access("key1")
 
-	// // Verify structure after access: head -> node1 -> node2 -> tail
-	// if lru.Head.next != node1 || node1.next != node2 {
-	// 	t.Errorf("LRU structure incorrect after access operation")
-	// }
+	// Verify structure after access: head -> node1 -> node2 -> tail
+	if lru.Head.next != node1 || node1.next != node2 || node2.next != lru.Tail {
+		t.Errorf("LRU structure incorrect after access operation")
+	}
+	if lru.Tail.prev != node2 || node2.prev != node1 || node1.prev != lru.Head {
+		t.Errorf("LRU prev links incorrect after access operation")
+	}
 	nextToHead:=lru.getHead().next
 	if nextToHead.key != "key1" {
 		t.Errorf("LRU structure incorrect after access operation")
@@ -308,3 +319,795 @@ func TestLRUEmpty(t *testing.T) {
 		t.Errorf("Eviction from empty LRU should return false")
 	}
 }
+
+// newTestTwoQ builds a TwoQ cache with the given queue sizes
+func newTestTwoQ(capacity, kIn, kOut int) *TwoQ[string] {
+	twoQ := NewTwoQ[string](capacity)
+	twoQ.K_In = kIn
+	twoQ.K_Out = kOut
+	return twoQ
+}
+
+// TestTwoQPromoteThreshold tests that a key needs PromoteThreshold A1out hits to reach Am
+func TestTwoQPromoteThreshold(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.PromoteThreshold = 2
+
+	twoQ.Insert("a", "value-a")
+	twoQ.Insert("b", "value-b")
+	twoQ.Insert("c", "value-c") // a is moved to A1out
+
+	if !twoQ.A1out.isPresent("a") {
+		t.Fatal("a should be in A1out")
+	}
+
+	// First A1out hit is below the threshold, a goes back to A1in
+	twoQ.Insert("a", "value-a")
+	page, present := twoQ.PageBuffer["a"]
+	if !present || page.queueType != "A1_In" {
+		t.Fatalf("a should be re-admitted to A1_In after one A1out hit, got %+v", page)
+	}
+	if twoQ.A1out.isPresent("a") {
+		t.Error("a should have left A1out when re-admitted")
+	}
+
+	twoQ.Insert("d", "value-d") // c is moved to A1out
+	twoQ.Insert("e", "value-e") // a is moved to A1out again
+
+	if !twoQ.A1out.isPresent("a") {
+		t.Fatal("a should be back in A1out")
+	}
+
+	// Second A1out hit reaches the threshold
+	twoQ.Insert("a", "value-a")
+	page, present = twoQ.PageBuffer["a"]
+	if !present || page.queueType != "A_M" {
+		t.Fatalf("a should be promoted to A_M after two A1out hits, got %+v", page)
+	}
+	if _, present := twoQ.Am.Nodes["a"]; !present {
+		t.Error("a should be in the Am list")
+	}
+	if twoQ.A1out.isPresent("a") {
+		t.Error("a should have left A1out when promoted")
+	}
+}
+
+// TestTwoQPromoteThresholdDefault tests that a single A1out hit promotes by default
+func TestTwoQPromoteThresholdDefault(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+
+	twoQ.Insert("a", "value-a")
+	twoQ.Insert("b", "value-b")
+	twoQ.Insert("c", "value-c") // a is moved to A1out
+
+	twoQ.Insert("a", "value-a")
+	page, present := twoQ.PageBuffer["a"]
+	if !present || page.queueType != "A_M" {
+		t.Fatalf("a should be promoted to A_M after one A1out hit, got %+v", page)
+	}
+}
+
+// TestTwoQStats tests the hit, miss and eviction counters
+func TestTwoQStats(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+
+	twoQ.Insert("a", "value-a") // miss
+	twoQ.Insert("a", "value-a") // hit in A1in
+	twoQ.Insert("b", "value-b") // miss
+	twoQ.Insert("c", "value-c") // miss, a is evicted to A1out
+	twoQ.Insert("a", "value-a") // ghost hit is still a miss, b is evicted
+
+	stats := twoQ.Stats()
+	if stats.Hits != 1 || stats.Misses != 4 || stats.Evictions != 2 {
+		t.Errorf("Expected 1 hit, 4 misses and 2 evictions, got %+v", stats)
+	}
+	if stats.Len != 2 || stats.Cap != 2 {
+		t.Errorf("Expected Len 2 and Cap 2, got %+v", stats)
+	}
+}
+
+// TestTwoQInsertMiss tests that a new key is admitted to A1in
+func TestTwoQInsertMiss(t *testing.T) {
+	twoQ := newTestTwoQ(3, 1, 2)
+
+	value, present := twoQ.Insert("a", "value-a")
+	if present || value != "value-a" {
+		t.Errorf("Expected (value-a, false) on a miss, got (%v, %v)", value, present)
+	}
+	if twoQ.stateOf("a") != stateA1inHit || twoQ.A1in.Head.next.key != "a" {
+		t.Error("Expected a to be at the head of A1in")
+	}
+}
+
+// TestTwoQInsertA1inHit tests that an A1in hit returns the stored value and moves nothing
+func TestTwoQInsertA1inHit(t *testing.T) {
+	twoQ := newTestTwoQ(3, 1, 2)
+	twoQ.Insert("a", "value-a")
+	twoQ.Insert("b", "value-b")
+
+	value, present := twoQ.Insert("a", "ignored")
+	if !present || value != "value-a" {
+		t.Errorf("Expected (value-a, true) on an A1in hit, got (%v, %v)", value, present)
+	}
+	if twoQ.A1in.Head.next.key != "b" || twoQ.A1in.Tail.prev.key != "a" {
+		t.Error("An A1in hit must not reorder the A1in FIFO")
+	}
+	if twoQ.stateOf("a") != stateA1inHit {
+		t.Error("An A1in hit must not promote")
+	}
+}
+
+// TestTwoQInsertAmHit tests that an Am hit moves the key to the head of Am
+func TestTwoQInsertAmHit(t *testing.T) {
+	twoQ := newTestTwoQ(4, 1, 2)
+	twoQ.PageBuffer["a"] = &Page{data: "value-a", queueType: "A_M"}
+	twoQ.Am.add("a")
+	twoQ.PageBuffer["b"] = &Page{data: "value-b", queueType: "A_M"}
+	twoQ.Am.add("b")
+
+	value, present := twoQ.Insert("a", "ignored")
+	if !present || value != "value-a" {
+		t.Errorf("Expected (value-a, true) on an Am hit, got (%v, %v)", value, present)
+	}
+	if twoQ.Am.Head.next.key != "a" {
+		t.Error("Expected a to move to the head of Am")
+	}
+}
+
+// TestTwoQInsertFullCycle tests a key going A1in -> A1out -> Am in one flow
+func TestTwoQInsertFullCycle(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+
+	twoQ.Insert("a", "value-a")
+	if twoQ.stateOf("a") != stateA1inHit {
+		t.Fatal("Expected a in A1in after the first reference")
+	}
+
+	twoQ.Insert("b", "value-b")
+	twoQ.Insert("c", "value-c") // A1in is over K_In, a is demoted
+	if twoQ.stateOf("a") != stateA1outHit {
+		t.Fatal("Expected a in A1out after being pushed out of A1in")
+	}
+	if _, present := twoQ.PageBuffer["a"]; present {
+		t.Fatal("A1out keys must not be resident")
+	}
+
+	value, present := twoQ.Insert("a", "value-a2")
+	if !present || value != "value-a2" {
+		t.Errorf("Expected (value-a2, true) on an A1out hit, got (%v, %v)", value, present)
+	}
+	if twoQ.stateOf("a") != stateAmHit {
+		t.Fatal("Expected a in Am after an A1out hit")
+	}
+	if twoQ.A1out.isPresent("a") {
+		t.Error("a must leave A1out once promoted")
+	}
+	if len(twoQ.PageBuffer) > twoQ.Capacity {
+		t.Errorf("PageBuffer exceeded capacity: %d", len(twoQ.PageBuffer))
+	}
+}
+
+// TestTwoQCallbacks tests that OnDemote and OnPromote fire on exactly the right transitions
+func TestTwoQCallbacks(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+
+	var demoted, promoted []string
+	twoQ.OnDemote = func(key string) {
+		demoted = append(demoted, key)
+		if _, present := twoQ.PageBuffer[key]; present {
+			t.Errorf("OnDemote(%s) fired before the key left the buffer", key)
+		}
+	}
+	twoQ.OnPromote = func(key string) {
+		promoted = append(promoted, key)
+		if twoQ.stateOf(key) != stateAmHit {
+			t.Errorf("OnPromote(%s) fired before the key reached Am", key)
+		}
+	}
+
+	twoQ.Insert("a", "value-a")
+	twoQ.Insert("b", "value-b")
+	twoQ.Insert("a", "value-a") // A1in hit, no transition
+	if len(demoted) != 0 || len(promoted) != 0 {
+		t.Fatalf("Expected no transitions yet, got demoted=%v promoted=%v", demoted, promoted)
+	}
+
+	twoQ.Insert("c", "value-c") // a is demoted
+	if len(demoted) != 1 || demoted[0] != "a" {
+		t.Errorf("Expected a to be demoted, got %v", demoted)
+	}
+
+	twoQ.Insert("a", "value-a") // a is promoted, b is demoted to make room
+	if len(promoted) != 1 || promoted[0] != "a" {
+		t.Errorf("Expected a to be promoted, got %v", promoted)
+	}
+	if len(demoted) != 2 || demoted[1] != "b" {
+		t.Errorf("Expected b to be demoted, got %v", demoted)
+	}
+
+	twoQ.Insert("a", "value-a") // Am hit, no transition
+	if len(promoted) != 1 || len(demoted) != 2 {
+		t.Errorf("An Am hit must not fire callbacks, got demoted=%v promoted=%v", demoted, promoted)
+	}
+}
+
+// TestTwoQCallbackReentrancy tests that a callback can safely call Insert
+func TestTwoQCallbackReentrancy(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	reentered := false
+	twoQ.OnDemote = func(key string) {
+		if !reentered {
+			reentered = true
+			twoQ.Insert("from-callback", "value")
+		}
+	}
+
+	twoQ.Insert("a", "value-a")
+	twoQ.Insert("b", "value-b")
+	twoQ.Insert("c", "value-c") // a is demoted, the callback inserts a new key
+
+	if _, present := twoQ.PageBuffer["from-callback"]; !present {
+		t.Error("Expected the key inserted by the callback to be resident")
+	}
+	if len(twoQ.PageBuffer) > twoQ.Capacity {
+		t.Errorf("PageBuffer exceeded capacity: %d", len(twoQ.PageBuffer))
+	}
+	if len(twoQ.A1in.Nodes)+len(twoQ.Am.Nodes) != len(twoQ.PageBuffer) {
+		t.Errorf("Queues hold %d keys but PageBuffer holds %d", len(twoQ.A1in.Nodes)+len(twoQ.Am.Nodes), len(twoQ.PageBuffer))
+	}
+}
+
+// TestTwoQGetDoesNotMutate tests that Get never changes stored values or admits keys
+func TestTwoQGetDoesNotMutate(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.Set("a", "value-a")
+
+	value, present := twoQ.Get("a")
+	if !present || value != "value-a" {
+		t.Errorf("Expected ('value-a', true), got (%v, %v)", value, present)
+	}
+
+	value, present = twoQ.Get("missing")
+	if present || value != nil {
+		t.Errorf("Expected (nil, false) for a missing key, got (%v, %v)", value, present)
+	}
+	if _, resident := twoQ.PageBuffer["missing"]; resident {
+		t.Error("Get must not admit a missing key")
+	}
+
+	twoQ.Set("b", "value-b")
+	twoQ.Set("c", "value-c") // a is moved to A1out
+	if _, present := twoQ.Get("a"); present {
+		t.Error("Expected a key only in A1out to be a miss")
+	}
+	if !twoQ.A1out.isPresent("a") {
+		t.Error("Get must leave an A1out key in A1out")
+	}
+
+	stats := twoQ.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses from Get, got %+v", stats)
+	}
+}
+
+// TestTwoQSetUpserts tests that Set overwrites resident values and promotes A1out keys
+func TestTwoQSetUpserts(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.Set("a", "value-a")
+	twoQ.Set("a", "value-a2")
+	if value, _ := twoQ.Get("a"); value != "value-a2" {
+		t.Errorf("Expected Set to overwrite an A1in value, got %v", value)
+	}
+	if twoQ.PageBuffer["a"].queueType != "A1_In" {
+		t.Error("Expected a to stay in A1in after an overwrite")
+	}
+
+	twoQ.Set("b", "value-b")
+	twoQ.Set("c", "value-c") // a is moved to A1out
+	twoQ.Set("a", "value-a3")
+	page, present := twoQ.PageBuffer["a"]
+	if !present || page.queueType != "A_M" || page.data != "value-a3" {
+		t.Errorf("Expected a to be promoted to Am with the new value, got %+v", page)
+	}
+
+	twoQ.Set("a", "value-a4")
+	if value, _ := twoQ.Get("a"); value != "value-a4" {
+		t.Errorf("Expected Set to overwrite an Am value, got %v", value)
+	}
+
+	stats := twoQ.Stats()
+	if stats.Hits != 2 || stats.Misses != 0 {
+		t.Errorf("Expected Set to leave hits and misses to Get, got %+v", stats)
+	}
+}
+
+// TestTwoQSetChanged tests that Set reports whether the stored value changed
+func TestTwoQSetChanged(t *testing.T) {
+	twoQ := newAmTwoQ() // Am: b, a from most to least recent
+	if !twoQ.Set("a", "a") {
+		t.Error("Expected Set without Equal to report a change")
+	}
+
+	twoQ.Equal = reflect.DeepEqual
+	twoQ.Set("b", []byte("b"))
+	stored := twoQ.PageBuffer["b"].data
+	if twoQ.Set("b", []byte("b")) {
+		t.Error("Expected an equal value to report no change")
+	}
+	if &twoQ.PageBuffer["b"].data.([]byte)[0] != &stored.([]byte)[0] {
+		t.Error("Expected an equal value to leave the stored one in place")
+	}
+	if twoQ.Am.Head.next.key != "b" {
+		t.Error("Expected an unchanged Set to still move b to the head of Am")
+	}
+	if !twoQ.Set("b", []byte("c")) || string(twoQ.PageBuffer["b"].data.([]byte)) != "c" {
+		t.Error("Expected a different value to be stored and reported")
+	}
+	if !twoQ.Set("e", "e") {
+		t.Error("Expected admitting a new key to report a change")
+	}
+
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestNodeSentinels tests that the sentinel helpers tell head, tail and key nodes apart
+func TestNodeSentinels(t *testing.T) {
+	for name, head := range map[string]*Node[string]{"FIFO": NewFIFO[string]().Head, "LRU": NewLRU[string]().Head} {
+		tail := head.next
+		if !head.isHead() || head.isTail() || head.isInterior() {
+			t.Errorf("%s: expected Head to be only a head", name)
+		}
+		if !tail.isTail() || tail.isHead() || tail.isInterior() {
+			t.Errorf("%s: expected the node after an empty Head to be the tail", name)
+		}
+		if tail.prev != head {
+			t.Errorf("%s: expected the sentinels to be linked both ways", name)
+		}
+
+		node := NewNode("key", head, tail)
+		if !node.isInterior() || node.isHead() || node.isTail() {
+			t.Errorf("%s: expected a key node to be interior", name)
+		}
+	}
+}
+
+// newAmTwoQ builds a cache with keys a and b both in Am
+func newAmTwoQ() *TwoQ[string] {
+	twoQ := newTestTwoQ(2, 1, 4)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		twoQ.Set(key, key)
+	}
+	twoQ.Set("a", "a") // a and b are back from A1out, into Am
+	twoQ.Set("b", "b")
+	return twoQ
+}
+
+// TestTwoQAccessHotDoesNotAllocate tests that Am hits only relink nodes
+func TestTwoQAccessHotDoesNotAllocate(t *testing.T) {
+	twoQ := newAmTwoQ()
+	if twoQ.PageBuffer["a"].queueType != "A_M" || twoQ.PageBuffer["b"].queueType != "A_M" {
+		t.Fatal("Expected a and b in Am")
+	}
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		twoQ.Get("a")
+		twoQ.Get("b")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected Am hits not to allocate, got %v allocations", allocs)
+	}
+
+	if twoQ.Am.Head.next.key != "b" || twoQ.Am.Head.next.next.key != "a" {
+		t.Error("Expected b then a at the head of Am")
+	}
+	for node := twoQ.Am.Head.next; node != twoQ.Am.Tail; node = node.next {
+		if node.next.prev != node {
+			t.Errorf("Broken prev link after %s", node.key)
+		}
+	}
+}
+
+func BenchmarkTwoQAccessHot(b *testing.B) {
+	twoQ := newAmTwoQ()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			twoQ.Get("a")
+		} else {
+			twoQ.Get("b")
+		}
+	}
+}
+
+// TestTwoQRandomizedInvariants tests that the invariants hold after every operation of a random workload
+func TestTwoQRandomizedInvariants(t *testing.T) {
+	configs := []struct{ capacity, kIn, kOut int }{
+		{8, 2, 4},
+		{8, 8, 8},
+		{4, 6, 2}, // K_In above the capacity, A1in can hold every page
+		{1, 1, 0},
+	}
+
+	for _, config := range configs {
+		rng := rand.New(rand.NewSource(42))
+		twoQ := newTestTwoQ(config.capacity, config.kIn, config.kOut)
+		twoQ.PromoteThreshold = 1 + rng.Intn(2)
+
+		for i := 0; i < 5000; i++ {
+			key := fmt.Sprint(rng.Intn(3 * config.capacity))
+			switch rng.Intn(3) {
+			case 0:
+				twoQ.Insert(key, i)
+			case 1:
+				twoQ.Get(key)
+			default:
+				twoQ.Set(key, i)
+			}
+
+			if err := twoQ.CheckInvariants(); err != nil {
+				t.Fatalf("config %+v, operation %d on %s: %v", config, i, key, err)
+			}
+		}
+	}
+}
+
+// TestTwoQCheckInvariantsDetectsDrift tests that CheckInvariants reports a broken cache
+func TestTwoQCheckInvariantsDetectsDrift(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.Set("a", "value-a")
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	twoQ.PageBuffer["ghost"] = &Page{queueType: "A1_In"}
+	if twoQ.CheckInvariants() == nil {
+		t.Error("Expected a key missing from the queues to be reported")
+	}
+	delete(twoQ.PageBuffer, "ghost")
+
+	twoQ.A1in.Nodes["a"].prev = twoQ.A1in.Tail
+	if twoQ.CheckInvariants() == nil {
+		t.Error("Expected a broken link to be reported")
+	}
+}
+
+// TestTwoQEntries tests that Entries lists Am by recency and then A1in by age
+func TestTwoQEntries(t *testing.T) {
+	twoQ := newAmTwoQ() // Am: b, a from most to least recent
+	twoQ.Get("a")       // Am: a, b
+	twoQ.Set("e", "e")  // d is demoted, the full buffer makes room in A1in
+
+	var keys []string
+	for _, entry := range twoQ.Entries() {
+		keys = append(keys, entry.Key)
+		if entry.Value != twoQ.PageBuffer[entry.Key].data {
+			t.Errorf("Expected the data of %s, got %v", entry.Key, entry.Value)
+		}
+	}
+	if len(keys) != len(twoQ.PageBuffer) {
+		t.Fatalf("Expected %d entries, got %v", len(twoQ.PageBuffer), keys)
+	}
+	if keys[len(keys)-1] != "e" {
+		t.Errorf("Expected the newest A1in key last, got %v", keys)
+	}
+}
+
+// TestTwoQKeyNorm tests that keys are stored and looked up in normalized form
+func TestTwoQKeyNorm(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.KeyNorm = strings.ToLower
+
+	twoQ.Set("Key", "value")
+	if value, present := twoQ.Get("KEY"); !present || value != "value" {
+		t.Errorf("Expected KEY to find Key, got (%v, %v)", value, present)
+	}
+	if _, present := twoQ.Insert("key", "other"); !present {
+		t.Error("Expected Insert to hit the normalized key")
+	}
+	twoQ.Set("kEy", "value2")
+	if len(twoQ.PageBuffer) != 1 {
+		t.Errorf("Expected a single entry, got %d", len(twoQ.PageBuffer))
+	}
+	if _, present := twoQ.PageBuffer["key"]; !present {
+		t.Error("Expected the entry to be stored under the normalized key")
+	}
+
+	var demoted []string
+	twoQ.OnDemote = func(key string) { demoted = append(demoted, key) }
+	twoQ.Set("A", 1)
+	twoQ.Set("B", 2)
+	if fmt.Sprint(demoted) != "[key]" {
+		t.Errorf("Expected callbacks to see normalized keys, got %v", demoted)
+	}
+
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTwoQAmKeysByRecency tests that Am keys are listed from the head of the list to its tail
+func TestTwoQAmKeysByRecency(t *testing.T) {
+	twoQ := newTestTwoQ(4, 1, 4)
+	if keys := twoQ.AmKeysByRecency(); len(keys) != 0 {
+		t.Errorf("Expected no Am keys, got %v", keys)
+	}
+
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		twoQ.Set(key, key)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		twoQ.Set(key, key) // back from A1out, into Am
+	}
+	twoQ.Get("a")
+
+	want := []string{"a", "c", "b"}
+	if keys := twoQ.AmKeysByRecency(); !reflect.DeepEqual(keys, want) {
+		t.Errorf("Expected %v, got %v", want, keys)
+	}
+	if stats := twoQ.Stats(); stats.Hits != 1 {
+		t.Errorf("Expected AmKeysByRecency not to count, got %+v", stats)
+	}
+}
+
+// TestTwoQString tests that String shows every queue in order
+func TestTwoQString(t *testing.T) {
+	twoQ := newAmTwoQ() // Am: b, a; A1out: d, c; a leaves Am for good
+	twoQ.Set("e", "e")
+
+	var _ fmt.Stringer = twoQ
+	want := "A1in[e], Am[b], A1out[d c], buffer=2/2"
+	if got := fmt.Sprint(twoQ); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := newTestTwoQ(2, 1, 2).String(); got != "A1in[], Am[], A1out[], buffer=0/2" {
+		t.Errorf("Unexpected empty dump %q", got)
+	}
+}
+
+func newBytesTwoQ(capacity, kIn, kOut, maxBytes int) *TwoQ[string] {
+	twoQ := newTestTwoQ(capacity, kIn, kOut)
+	twoQ.MaxBytes = maxBytes
+	return twoQ
+}
+
+// TestTwoQBytes tests that the byte total follows pages through A1in, Am and A1out
+func TestTwoQBytes(t *testing.T) {
+	twoQ := newBytesTwoQ(4, 1, 4, 10)
+
+	twoQ.Set("a", "aaaa")
+	twoQ.Set("b", "bbbb")
+	if twoQ.BytesUsed() != 8 {
+		t.Fatalf("Expected 8 bytes, got %d", twoQ.BytesUsed())
+	}
+
+	// c does not fit next to a and b, a leaves A1in for A1out first.
+	twoQ.Set("c", "cccc")
+	if twoQ.BytesUsed() != 8 || !twoQ.A1out.isPresent("a") {
+		t.Fatalf("Expected a demoted and 8 bytes, got %s with %d bytes", twoQ, twoQ.BytesUsed())
+	}
+
+	// a comes back to Am with the value it is set to, not the old one.
+	twoQ.Set("a", "aa")
+	if twoQ.PageBuffer["a"].queueType != "A_M" || twoQ.BytesUsed() != 10 {
+		t.Fatalf("Expected a in Am and 10 bytes, got %s with %d bytes", twoQ, twoQ.BytesUsed())
+	}
+
+	// Growing a resident page evicts others, never the page itself.
+	twoQ.Set("a", "aaaaaaaaa")
+	if _, present := twoQ.Get("a"); !present || twoQ.BytesUsed() != 9 {
+		t.Fatalf("Expected a resident with 9 bytes, got %s with %d bytes", twoQ, twoQ.BytesUsed())
+	}
+
+	// A value over the budget is never stored.
+	if twoQ.Set("big", "this is too large") || twoQ.Set("a", "this is too large") {
+		t.Error("Expected values over MaxBytes to be rejected")
+	}
+	if _, present := twoQ.PageBuffer["big"]; present || twoQ.PageBuffer["a"].data != "aaaaaaaaa" {
+		t.Error("Expected a rejected value to change nothing")
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTwoQInsertA1outTooLarge tests that an A1out hit with a value over
+// MaxBytes reports false and leaves the key in A1out
+func TestTwoQInsertA1outTooLarge(t *testing.T) {
+	twoQ := newBytesTwoQ(2, 1, 2, 10)
+	twoQ.Insert("a", "aaaa")
+	twoQ.Insert("b", "bbbb")
+	twoQ.Insert("c", "cccc") // a is moved to A1out
+
+	if value, present := twoQ.Insert("a", "this is too large"); present || value != "this is too large" {
+		t.Errorf("Expected (this is too large, false), got (%v, %v)", value, present)
+	}
+	if !twoQ.A1out.isPresent("a") {
+		t.Error("Expected a to stay in A1out")
+	}
+	if value, present := twoQ.Insert("a", "aa"); !present || value != "aa" {
+		t.Errorf("Expected (aa, true) once the value fits, got (%v, %v)", value, present)
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTwoQBytesRandomized tests that variable sized values never take the byte total over the budget
+func TestTwoQBytesRandomized(t *testing.T) {
+	rng := rand.New(rand.NewSource(42))
+	twoQ := newBytesTwoQ(16, 4, 8, 64)
+
+	for i := 0; i < 5000; i++ {
+		key := fmt.Sprint(rng.Intn(48))
+		value := strings.Repeat("x", rng.Intn(24))
+		switch rng.Intn(3) {
+		case 0:
+			twoQ.Insert(key, value)
+		case 1:
+			twoQ.Get(key)
+		default:
+			twoQ.Set(key, value)
+		}
+
+		if twoQ.BytesUsed() > twoQ.MaxBytes {
+			t.Fatalf("operation %d: %d bytes used exceed the budget of %d", i, twoQ.BytesUsed(), twoQ.MaxBytes)
+		}
+		if err := twoQ.CheckInvariants(); err != nil {
+			t.Fatalf("operation %d on %s: %v", i, key, err)
+		}
+	}
+}
+
+// FuzzTwoQ tests that no stream of operations leaves the queues and PageBuffer inconsistent
+func FuzzTwoQ(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		twoQ := NewTwoQ[int](4)
+		twoQ.K_In = 2
+		twoQ.K_Out = 4
+		twoQ.PageBuffer = make(map[int]*Page)
+		twoQ.A1in = NewFIFO[int]()
+		twoQ.A1in.Nodes = make(map[int]*Node[int])
+		twoQ.Am = NewLRU[int]()
+		twoQ.Am.Nodes = make(map[int]*Node[int])
+		twoQ.A1out = NewFIFO[int]()
+		twoQ.A1out.Nodes = make(map[int]*Node[int])
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { twoQ.Get(key) },
+			Set:             func(key, value int) { twoQ.Set(key, value) },
+			Delete:          func(key int) { twoQ.Delete(key) },
+			CheckInvariants: twoQ.CheckInvariants,
+		})
+	})
+}
+
+// TestTwoQSetKInKOut tests that shrinking K_In spills A1in into A1out and shrinking K_Out trims it
+func TestTwoQSetKInKOut(t *testing.T) {
+	twoQ := newTestTwoQ(4, 4, 4)
+	var demoted []string
+	twoQ.OnDemote = func(key string) { demoted = append(demoted, key) }
+	for _, key := range []string{"a", "b", "c", "d"} {
+		twoQ.Set(key, key)
+	}
+
+	twoQ.SetKInKOut(1, 2)
+	if got := twoQ.String(); got != "A1in[d], Am[], A1out[c b], buffer=1/4" {
+		t.Errorf("Unexpected queues after shrinking %q", got)
+	}
+	if !reflect.DeepEqual(demoted, []string{"a", "b", "c"}) {
+		t.Errorf("Expected a, b and c demoted, got %v", demoted)
+	}
+
+	// Growing only raises the limits.
+	twoQ.SetKInKOut(4, 4)
+	if got := twoQ.String(); got != "A1in[d], Am[], A1out[c b], buffer=1/4" {
+		t.Errorf("Expected growing to move nothing, got %q", got)
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sizes := range [][2]int{{0, 1}, {5, 1}, {1, -1}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected K_In %d and K_Out %d to panic", sizes[0], sizes[1])
+				}
+			}()
+			twoQ.SetKInKOut(sizes[0], sizes[1])
+		}()
+	}
+}
+
+// TestTwoQGetSharesReadLock tests that Get only needs the write lock to move an Am key to the head of Am
+func TestTwoQGetSharesReadLock(t *testing.T) {
+	twoQ := newTestTwoQ(3, 1, 4)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		twoQ.Set(key, key)
+	}
+	twoQ.Set("a", "a")
+	twoQ.Set("b", "b") // A1in[d], Am[b a]
+
+	get := func(key string) chan struct{} {
+		done := make(chan struct{})
+		go func() {
+			twoQ.Get(key)
+			close(done)
+		}()
+		return done
+	}
+	completes := func(done chan struct{}) bool {
+		select {
+		case <-done:
+			return true
+		case <-time.After(50 * time.Millisecond):
+			return false
+		}
+	}
+
+	twoQ.Mu.RLock()
+	for _, key := range []string{"d", "b", "missing"} {
+		if !completes(get(key)) {
+			t.Errorf("Expected Get(%q) to complete under a shared read lock", key)
+		}
+	}
+	moved := get("a")
+	if completes(moved) {
+		t.Error("Expected Get(\"a\") to wait for the write lock to move a")
+	}
+	twoQ.Mu.RUnlock()
+
+	<-moved
+	if head := twoQ.Am.Head.next.key; head != "a" {
+		t.Errorf("Expected a at the head of Am once the lock was released, got %s", head)
+	}
+
+	if stats := twoQ.Stats(); stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Expected 3 hits and 1 miss, got %+v", stats)
+	}
+}
+
+// TestTwoQConcurrent tests Gets and Sets from several goroutines, run it with -race
+func TestTwoQConcurrent(t *testing.T) {
+	twoQ := newTestTwoQ(8, 2, 8)
+	var promoted, demoted int
+	var mu sync.Mutex
+	twoQ.OnPromote = func(string) { mu.Lock(); promoted++; mu.Unlock() }
+	twoQ.OnDemote = func(string) { mu.Lock(); demoted++; mu.Unlock() }
+
+	var wg sync.WaitGroup
+	gets := make([]uint64, 4)
+	for g := range gets {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 2000; i++ {
+				key := fmt.Sprint(rng.Intn(16))
+				if rng.Intn(4) == 0 {
+					twoQ.Set(key, i)
+				} else {
+					twoQ.Get(key)
+					gets[g]++
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	total := gets[0] + gets[1] + gets[2] + gets[3]
+	if stats := twoQ.Stats(); stats.Hits+stats.Misses != total {
+		t.Errorf("Expected %d lookups counted, got %+v", total, stats)
+	}
+	if promoted == 0 || demoted == 0 {
+		t.Errorf("Expected callbacks to fire, got %d promotions and %d demotions", promoted, demoted)
+	}
+}
@@ -0,0 +1,18 @@
+package qgo
+
+// Cache adapts a TwoQ to cachego.Cache, whose Set does not report
+// whether the value changed, so tooling written against that interface
+// works with 2Q. Every other method is the one of TwoQ.
+type Cache[T comparable] struct {
+	*TwoQ[T]
+}
+
+// AsCache returns twoQ as a cachego.Cache.
+func (twoQ *TwoQ[T]) AsCache() Cache[T] {
+	return Cache[T]{twoQ}
+}
+
+// Set is TwoQ.Set without the report of whether the value changed.
+func (c Cache[T]) Set(key T, value any) {
+	c.TwoQ.Set(key, value)
+}
@@ -0,0 +1,41 @@
+package qgo
+
+import (
+	"testing"
+
+	cachego "cache_go"
+)
+
+var _ cachego.Cache[string, any] = Cache[string]{}
+
+// TestTwoQAsCache tests the adapter and that Delete forgets resident and A1out keys alike
+func TestTwoQAsCache(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	var c cachego.Cache[string, any] = twoQ.AsCache()
+
+	c.Set("a", "1")
+	c.Set("b", "2")
+	c.Set("c", "3") // a is demoted to A1out
+	if value, ok := c.Get("c"); !ok || value != "3" {
+		t.Errorf("Expected (3, true), got (%v, %v)", value, ok)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected Len 2, got %d", c.Len())
+	}
+
+	if !c.Delete("c") || c.Delete("c") {
+		t.Error("Expected Delete to report the key only while it is resident")
+	}
+	if c.Delete("a") {
+		t.Error("Expected an A1out key not to be reported")
+	}
+	if _, inQueue := twoQ.Location("a"); inQueue {
+		t.Error("Expected Delete to forget the A1out key")
+	}
+	if stats := c.Stats(); stats.Len != 1 || stats.Evictions != 1 {
+		t.Errorf("Expected Delete not to count as an eviction, got %+v", stats)
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,64 @@
+package qgo
+
+import (
+	"fmt"
+
+	cachego "cache_go"
+)
+
+// The Try variants below behave like their namesakes but return one of
+// the cachego errors instead of panicking, for callers that would rather
+// not recover().
+
+// TryNewTwoQ is NewTwoQ returning cachego.ErrInvalidCapacity for a
+// capacity that is not greater than 0.
+func TryNewTwoQ[T comparable](capacity int) (*TwoQ[T], error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("%w: got %d", cachego.ErrInvalidCapacity, capacity)
+	}
+	return NewTwoQ[T](capacity), nil
+}
+
+// TryNewTwoQWithBytes is NewTwoQWithBytes returning
+// cachego.ErrInvalidCapacity for a capacity or a byte budget that is not
+// greater than 0.
+func TryNewTwoQWithBytes[T comparable](capacity int, maxBytes int) (*TwoQ[T], error) {
+	if maxBytes <= 0 {
+		return nil, fmt.Errorf("%w: byte budget %d", cachego.ErrInvalidCapacity, maxBytes)
+	}
+	twoQ, err := TryNewTwoQ[T](capacity)
+	if err != nil {
+		return nil, err
+	}
+	twoQ.MaxBytes = maxBytes
+	return twoQ, nil
+}
+
+// TrySetKInKOut is SetKInKOut returning cachego.ErrInvalidArgument for a
+// kIn that is not between 1 and Capacity or a negative kOut, leaving the
+// queues as they are.
+func (twoQ *TwoQ[T]) TrySetKInKOut(kIn, kOut int) error {
+	twoQ.Mu.RLock()
+	capacity := twoQ.Capacity
+	twoQ.Mu.RUnlock()
+
+	if kIn <= 0 || kIn > capacity || kOut < 0 {
+		return fmt.Errorf("%w: K_In %d has to be between 1 and %d and K_Out %d cannot be negative", cachego.ErrInvalidArgument, kIn, capacity, kOut)
+	}
+	twoQ.SetKInKOut(kIn, kOut)
+	return nil
+}
+
+// TrySet is Set returning cachego.ErrValueTooLarge for a value larger
+// than MaxBytes instead of silently storing nothing.
+func (twoQ *TwoQ[T]) TrySet(key T, value any) (changed bool, err error) {
+	key = twoQ.norm(key)
+	defer twoQ.fireEvents()
+	twoQ.Mu.Lock()
+	defer twoQ.Mu.Unlock()
+
+	if size := twoQ.sizeOf(value); !twoQ.fits(size) {
+		return false, fmt.Errorf("%w: %d bytes for a budget of %d", cachego.ErrValueTooLarge, size, twoQ.MaxBytes)
+	}
+	return twoQ.set(key, value), nil
+}
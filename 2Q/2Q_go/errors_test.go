@@ -0,0 +1,71 @@
+package qgo
+
+import (
+	"errors"
+	"testing"
+
+	cachego "cache_go"
+)
+
+// TestTwoQTrySet tests that a value larger than MaxBytes is an error and stores nothing
+func TestTwoQTrySet(t *testing.T) {
+	twoQ := newBytesTwoQ(4, 1, 4, 8)
+
+	if changed, err := twoQ.TrySet("a", "1234"); !changed || err != nil {
+		t.Errorf("Expected (true, nil), got (%v, %v)", changed, err)
+	}
+	if _, err := twoQ.TrySet("b", "123456789"); !errors.Is(err, cachego.ErrValueTooLarge) {
+		t.Errorf("Expected ErrValueTooLarge, got %v", err)
+	}
+	if _, present := twoQ.Get("b"); present || twoQ.BytesUsed() != 4 {
+		t.Errorf("Expected the oversized value to be dropped, %d bytes used", twoQ.BytesUsed())
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTryNewTwoQ tests that invalid sizes are errors instead of panics
+// and that a new cache is ready for use
+func TestTryNewTwoQ(t *testing.T) {
+	if _, err := TryNewTwoQ[string](0); !errors.Is(err, cachego.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+	if _, err := TryNewTwoQWithBytes[string](4, 0); !errors.Is(err, cachego.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+	if _, err := TryNewTwoQWithBytes[string](-1, 8); !errors.Is(err, cachego.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+
+	twoQ, err := TryNewTwoQ[string](8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if twoQ.K_In != 2 || twoQ.K_Out != 4 {
+		t.Errorf("Expected K_In 2 and K_Out 4, got %d and %d", twoQ.K_In, twoQ.K_Out)
+	}
+	twoQ.Set("a", "1")
+	if value, present := twoQ.Get("a"); !present || value != "1" {
+		t.Errorf("Expected (1, true), got (%v, %v)", value, present)
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTwoQTrySetKInKOut tests that out of range queue sizes are errors and change nothing
+func TestTwoQTrySetKInKOut(t *testing.T) {
+	twoQ := newTestTwoQ(4, 2, 2)
+	for _, sizes := range [][2]int{{0, 1}, {5, 1}, {2, -1}} {
+		if err := twoQ.TrySetKInKOut(sizes[0], sizes[1]); !errors.Is(err, cachego.ErrInvalidArgument) {
+			t.Errorf("%v: Expected ErrInvalidArgument, got %v", sizes, err)
+		}
+	}
+	if twoQ.K_In != 2 || twoQ.K_Out != 2 {
+		t.Errorf("Expected K_In and K_Out to stay 2, got %d and %d", twoQ.K_In, twoQ.K_Out)
+	}
+	if err := twoQ.TrySetKInKOut(1, 3); err != nil || twoQ.K_In != 1 || twoQ.K_Out != 3 {
+		t.Errorf("Expected K_In 1 and K_Out 3, got %d and %d (%v)", twoQ.K_In, twoQ.K_Out, err)
+	}
+}
@@ -0,0 +1,59 @@
+package qgo
+
+// Route is how a resident page got to the queue it is in.
+type Route int
+
+const (
+	// RouteMiss is a key admitted to A1in on a miss.
+	RouteMiss Route = iota
+	// RouteA1outReadmit is a key found in A1out with fewer than
+	// PromoteThreshold A1out hits, admitted back to A1in.
+	RouteA1outReadmit
+	// RouteA1outPromote is a key found in A1out and promoted to Am, the
+	// proven reuse path, the only one into Am.
+	RouteA1outPromote
+)
+
+func (route Route) String() string {
+	switch route {
+	case RouteMiss:
+		return "miss"
+	case RouteA1outReadmit:
+		return "A1out readmit"
+	case RouteA1outPromote:
+		return "A1out promote"
+	default:
+		return "unknown"
+	}
+}
+
+// Location is where a key stands in the cache.
+type Location struct {
+	// Queue is "A1in", "Am" or "A1out", the queue the key is in.
+	Queue string
+	// PromotedVia is how a resident key got to its queue. It is
+	// RouteMiss for a key only remembered in A1out.
+	PromotedVia Route
+}
+
+// Location returns the queue key is in and how it got there, reporting
+// false for a key in none of them. It only looks, nothing is counted or
+// moved, so tests and monitoring can check that Am is only populated by
+// keys that proved their reuse through A1out.
+func (twoQ *TwoQ[T]) Location(key T) (Location, bool) {
+	key = twoQ.norm(key)
+
+	twoQ.Mu.RLock()
+	defer twoQ.Mu.RUnlock()
+
+	switch twoQ.stateOf(key) {
+	case stateA1outHit:
+		return Location{Queue: "A1out"}, true
+	case stateAmHit:
+		return Location{Queue: "Am", PromotedVia: twoQ.PageBuffer[key].promotedVia}, true
+	case stateA1inHit:
+		return Location{Queue: "A1in", PromotedVia: twoQ.PageBuffer[key].promotedVia}, true
+	default:
+		return Location{}, false
+	}
+}
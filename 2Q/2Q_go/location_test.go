@@ -0,0 +1,84 @@
+package qgo
+
+import (
+	"fmt"
+	"testing"
+)
+
+// checkLocation fails the test if key is not at want
+func checkLocation(t *testing.T, twoQ *TwoQ[string], key string, want Location) {
+	t.Helper()
+	if got, present := twoQ.Location(key); !present || got != want {
+		t.Errorf("Expected %s at %+v, got %+v (present %v)", key, want, got, present)
+	}
+}
+
+// TestTwoQLocation tests that Location follows a key through every route
+func TestTwoQLocation(t *testing.T) {
+	twoQ := newTestTwoQ(2, 1, 2)
+	twoQ.PromoteThreshold = 2
+
+	if _, present := twoQ.Location("a"); present {
+		t.Error("Expected an unknown key to have no location")
+	}
+
+	twoQ.Set("a", "value-a")
+	checkLocation(t, twoQ, "a", Location{Queue: "A1in", PromotedVia: RouteMiss})
+	twoQ.Set("b", "value-b")
+	twoQ.Set("c", "value-c") // a is moved to A1out
+	checkLocation(t, twoQ, "a", Location{Queue: "A1out"})
+
+	twoQ.Set("a", "value-a") // below the threshold, a goes back to A1in
+	checkLocation(t, twoQ, "a", Location{Queue: "A1in", PromotedVia: RouteA1outReadmit})
+
+	twoQ.Set("d", "value-d")
+	twoQ.Set("e", "value-e") // a is moved to A1out again
+	twoQ.Set("a", "value-a") // the second A1out hit promotes a
+	checkLocation(t, twoQ, "a", Location{Queue: "Am", PromotedVia: RouteA1outPromote})
+
+	stats := twoQ.Stats()
+	twoQ.Location("a")
+	if twoQ.Stats() != stats {
+		t.Error("Expected Location to count nothing")
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTwoQLocationKeptOnGrowth tests that a page growing past MaxBytes keeps its route when it is re-admitted
+func TestTwoQLocationKeptOnGrowth(t *testing.T) {
+	twoQ := newBytesTwoQ(2, 1, 4, 8)
+
+	twoQ.Set("a", "1")
+	twoQ.Set("b", "1")
+	twoQ.Set("c", "1") // a is moved to A1out
+	twoQ.Set("a", "1") // and promoted to Am
+	twoQ.Set("a", "12345678")
+	checkLocation(t, twoQ, "a", Location{Queue: "Am", PromotedVia: RouteA1outPromote})
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTwoQAmOnlyByReuse tests that a scan of one-off keys mixed with reused ones only ever promotes reused keys to Am
+func TestTwoQAmOnlyByReuse(t *testing.T) {
+	twoQ := newTestTwoQ(20, 5, 10)
+	for i := 0; i < 500; i++ {
+		twoQ.Set(fmt.Sprintf("scan-%d", i), i)
+		twoQ.Set(fmt.Sprintf("hot-%d", i%5), i)
+	}
+
+	for _, key := range twoQ.AmKeysByRecency() {
+		location, _ := twoQ.Location(key)
+		if location.PromotedVia != RouteA1outPromote {
+			t.Errorf("Expected %s to be in Am through A1out, got %v", key, location.PromotedVia)
+		}
+		if key[:4] == "scan" {
+			t.Errorf("Expected the one-off key %s to stay out of Am", key)
+		}
+	}
+	if err := twoQ.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,124 @@
+// Package bench runs every policy of this repository over the same
+// synthetic workloads, so the hit ratio and the cost per operation of
+// one can be compared with the others when picking a policy. The
+// benchmarks live in bench_test.go, this file holds the workload
+// generator and drives every policy through cachego.Cache.
+package bench
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	qgo "2Q_go"
+	cachego "cache_go"
+	clockpro "clockpro_go"
+	lfuo1 "lfu_O-1"
+	lfuheap "lfuheap_go"
+	lirs "lirs_go"
+	lrukgo "lruK"
+	sievego "sieve_go"
+	wtinylfu "wtinylfu_go"
+)
+
+// Zipf returns count keys in [0, n) drawn from a Zipfian distribution
+// with exponent skew: key i comes up with a probability proportional to
+// 1/(i+1)^skew, so key 0 is the most popular. Unlike rand.Zipf, skew
+// may be below 1, which is where most measured web and storage traces
+// lie. The keys come from a fixed seed, so every call with the same
+// arguments returns the same trace.
+func Zipf(n int, skew float64, count int) []int {
+	if n <= 0 || skew < 0 || count < 0 {
+		panic("n has to be greater than 0 and skew and count cannot be negative")
+	}
+
+	cdf := make([]float64, n)
+	total := 0.0
+	for i := range cdf {
+		total += 1 / math.Pow(float64(i+1), skew)
+		cdf[i] = total
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	keys := make([]int, count)
+	for i := range keys {
+		u := rng.Float64() * total
+		keys[i] = sort.SearchFloat64s(cdf, u)
+	}
+	return keys
+}
+
+// Lookup reads key from a cache, sets it when it misses and reports
+// whether it hit, the only operation a simulation needs.
+type Lookup func(key int) (hit bool)
+
+// lookup returns the Lookup of c, setting a key that misses to
+// value(key). Values are not checked.
+func lookup[V any](c cachego.Cache[int, V], value func(key int) V) Lookup {
+	return func(key int) bool {
+		if _, ok := c.Get(key); ok {
+			return true
+		}
+		c.Set(key, value(key))
+		return false
+	}
+}
+
+// HitRatio replays keys through lookup and returns the share of the
+// lookups that hit.
+func HitRatio(lookup Lookup, keys []int) float64 {
+	if len(keys) == 0 {
+		return 0
+	}
+
+	hits := 0
+	for _, key := range keys {
+		if lookup(key) {
+			hits++
+		}
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+// Policy is a policy under comparison, New making a cache of it that
+// holds capacity entries.
+type Policy struct {
+	Name string
+	New  func(capacity int) Lookup
+}
+
+// Policies lists every policy of the repository. 2Q uses the queue
+// sizes NewTwoQ starts with, the ones the 2Q paper recommends.
+var Policies = []Policy{
+	{"2Q", func(capacity int) Lookup { return lookup(qgo.NewTwoQ[int](capacity).AsCache(), keyAsAny) }},
+	{"LFU", func(capacity int) Lookup { return lookup[any](lfuo1.NewLfuCacheWithSize[int](capacity), keyAsAny) }},
+	{"LFUHeap", func(capacity int) Lookup { return lookup[int](lfuheap.NewLFUHeap[int, int](capacity), keyAsInt) }},
+	{"LRU-K", newLRUK},
+	{"Sieve", func(capacity int) Lookup { return lookup(sievego.NewSieve[int](capacity).AsCache(), keyAsAny) }},
+	{"CLOCK-Pro", func(capacity int) Lookup { return lookup[int](clockpro.NewClockPro[int, int](capacity), keyAsInt) }},
+	{"LIRS", func(capacity int) Lookup { return lookup[int](lirs.NewLIRS[int, int](capacity), keyAsInt) }},
+	{"W-TinyLFU", newWTinyLFU},
+}
+
+func keyAsInt(key int) int { return key }
+func keyAsAny(key int) any { return key }
+
+// newLRUK runs LRU-K with K=2 and no correlation period. Its pages hold
+// bytes, not ints, and it is driven on a logical clock that ticks once
+// per operation, so reference times are distinct without depending on
+// how fast the benchmark runs.
+func newLRUK(capacity int) Lookup {
+	t := int64(0)
+	c := lrukgo.Cache[int]{
+		LRU_K: lrukgo.NewLRU[int](2, capacity, 0),
+		Clock: func() int64 { t++; return t },
+	}
+	return lookup(c, func(int) []byte { return []byte{} })
+}
+
+// newWTinyLFU runs W-TinyLFU counting every key under its own value,
+// the sketch mixes the bits itself.
+func newWTinyLFU(capacity int) Lookup {
+	c := wtinylfu.NewWTinyLFU[int, int](capacity, func(key int) uint64 { return uint64(key) })
+	return lookup[int](c, keyAsInt)
+}
@@ -0,0 +1,105 @@
+package bench
+
+import "testing"
+
+const (
+	keySpace = 10000
+	capacity = 1000
+	traceLen = 200000
+)
+
+// workloads are the traces every policy is run over: a static skewed
+// one, where frequency wins, and the same one broken up by long scans
+// of keys that are never used again, which only scan resistant policies
+// survive.
+var workloads = []struct {
+	name  string
+	trace []int
+}{
+	{"zipf", Zipf(keySpace, 0.99, traceLen)},
+	{"zipf+scan", withScans(Zipf(keySpace, 0.99, traceLen), 20000, 2*capacity)},
+}
+
+// withScans inserts a scan of length fresh keys after every period keys
+// of trace.
+func withScans(trace []int, period, length int) []int {
+	scanned := make([]int, 0, len(trace)+len(trace)/period*length)
+	next := keySpace
+	for i, key := range trace {
+		scanned = append(scanned, key)
+		if (i+1)%period == 0 {
+			for j := 0; j < length; j++ {
+				scanned = append(scanned, next)
+				next++
+			}
+		}
+	}
+	return scanned
+}
+
+// TestZipf tests that the trace is deterministic, in range and skewed towards key 0
+func TestZipf(t *testing.T) {
+	keys := Zipf(100, 1.2, 10000)
+	again := Zipf(100, 1.2, 10000)
+
+	counts := make([]int, 100)
+	for i, key := range keys {
+		if key < 0 || key >= 100 {
+			t.Fatalf("Key %d out of range", key)
+		}
+		if key != again[i] {
+			t.Fatal("Expected the same trace for the same arguments")
+		}
+		counts[key]++
+	}
+	if counts[0] <= counts[1] || counts[1] <= counts[10] || counts[10] <= counts[99] {
+		t.Errorf("Expected popularity to fall with the key, got %d, %d, %d and %d", counts[0], counts[1], counts[10], counts[99])
+	}
+
+	// Without skew every key is equally likely.
+	uniform := make([]int, 4)
+	for _, key := range Zipf(4, 0, 40000) {
+		uniform[key]++
+	}
+	for key, count := range uniform {
+		if count < 9000 || count > 11000 {
+			t.Errorf("Expected about 10000 draws of key %d without skew, got %d", key, count)
+		}
+	}
+}
+
+// TestHitRatioNoEvictions tests every policy against the hit ratio of a cache that never evicts
+func TestHitRatioNoEvictions(t *testing.T) {
+	trace := Zipf(100, 0.8, 5000)
+	distinct := map[int]bool{}
+	for _, key := range trace {
+		distinct[key] = true
+	}
+	want := 1 - float64(len(distinct))/float64(len(trace))
+
+	for _, policy := range Policies {
+		if got := HitRatio(policy.New(len(distinct)), trace); got != want {
+			t.Errorf("%s: expected hit ratio %.4f without evictions, got %.4f", policy.Name, want, got)
+		}
+	}
+}
+
+// BenchmarkPolicies runs every policy over every workload and reports
+// the hit ratio of a full pass over the trace next to the time per
+// lookup.
+func BenchmarkPolicies(b *testing.B) {
+	for _, workload := range workloads {
+		for _, policy := range Policies {
+			b.Run(workload.name+"/"+policy.Name, func(b *testing.B) {
+				hitRatio := HitRatio(policy.New(capacity), workload.trace)
+
+				lookup := policy.New(capacity)
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					lookup(workload.trace[i%len(workload.trace)])
+				}
+				b.ReportMetric(hitRatio, "hit-ratio")
+			})
+		}
+	}
+}
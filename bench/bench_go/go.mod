@@ -0,0 +1,27 @@
+module bench_go
+
+go 1.22.2
+
+require (
+	2Q_go v0.0.0
+	cache_go v0.0.0
+	clockpro_go v0.0.0
+	lfu_O-1 v0.0.0
+	lfuheap_go v0.0.0
+	lirs_go v0.0.0
+	lruK v0.0.0
+	sieve_go v0.0.0
+	wtinylfu_go v0.0.0
+)
+
+replace (
+	2Q_go => ../../2Q/2Q_go
+	cache_go => ../../cache/cache_go
+	clockpro_go => ../../clockpro/clockpro_go
+	lfu_O-1 => ../../lfu_O-1
+	lfuheap_go => ../../lfuheap/lfuheap_go
+	lirs_go => ../../lirs/lirs_go
+	lruK => ../../lru-k/lruK_go
+	sieve_go => ../../sieve/sieve_go
+	wtinylfu_go => ../../wtinylfu/wtinylfu_go
+)
@@ -0,0 +1,33 @@
+package cachego
+
+// Entry is a single key/value pair held by a cache.
+type Entry[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// Stats is a point in time view of a cache's counters, uniform across
+// policies so they can be compared side by side.
+type Stats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Len       int
+	Cap       int
+}
+
+// Cache is the surface shared by every policy in this repository, so
+// that tooling such as persistence can be written once and work with
+// any of them.
+type Cache[K comparable, V any] interface {
+	Get(key K) (V, bool)
+	Set(key K, value V)
+	Delete(key K) bool
+	Len() int
+
+	// Entries returns every resident key/value pair. The order is
+	// policy specific but replaying it through Set must be valid.
+	Entries() []Entry[K, V]
+
+	Stats() Stats
+}
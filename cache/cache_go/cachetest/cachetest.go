@@ -0,0 +1,121 @@
+// Package cachetest drives a cache through a stream of operations
+// decoded from fuzzer input and checks the invariants of the policy
+// after every one of them, so the bookkeeping bugs that only show up
+// after an unlucky sequence of evictions are found by `go test -fuzz`
+// rather than in production. Each policy module adapts its cache to a
+// Policy and hands it to Run from a Fuzz target of its own.
+package cachetest
+
+import "testing"
+
+// Keys is the size of the key space operations draw from. It is kept
+// small so that keys keep coming back after being evicted, which is
+// where the queues and the maps tend to drift apart.
+const Keys = 16
+
+// Op is an operation Run applies to a cache.
+type Op int
+
+const (
+	OpGet Op = iota
+	OpSet
+	OpDelete
+	OpEvict
+	numOps
+)
+
+// Policy adapts a cache to the operations of Run. Get, Set, Delete and
+// CheckInvariants are required. Evict is left nil by a policy that
+// cannot evict on demand, Run then skips the operation. Evict has to be
+// a no-op on an empty cache.
+type Policy struct {
+	Get             func(key int)
+	Set             func(key int, value int)
+	Delete          func(key int)
+	Evict           func()
+	CheckInvariants func() error
+}
+
+// Decode turns data into operations, two bytes each: the first picks
+// the operation and the second the key. A trailing odd byte is ignored.
+func Decode(data []byte) (ops []Op, keys []int) {
+	for i := 0; i+1 < len(data); i += 2 {
+		ops = append(ops, Op(data[i])%numOps)
+		keys = append(keys, int(data[i+1])%Keys)
+	}
+	return ops, keys
+}
+
+// Run applies the operations encoded in data to p, each Set storing the
+// index of the operation as the value, and fails t with the operation
+// that broke an invariant.
+func Run(t testing.TB, data []byte, p Policy) {
+	t.Helper()
+
+	ops, keys := Decode(data)
+	for i, op := range ops {
+		key := keys[i]
+		switch op {
+		case OpGet:
+			p.Get(key)
+		case OpSet:
+			p.Set(key, i)
+		case OpDelete:
+			p.Delete(key)
+		case OpEvict:
+			if p.Evict == nil {
+				continue
+			}
+			p.Evict()
+		}
+
+		if err := p.CheckInvariants(); err != nil {
+			t.Fatalf("operation %d, %s of key %d: %v", i, op, key, err)
+		}
+	}
+}
+
+func (op Op) String() string {
+	switch op {
+	case OpGet:
+		return "Get"
+	case OpSet:
+		return "Set"
+	case OpDelete:
+		return "Delete"
+	case OpEvict:
+		return "Evict"
+	}
+	return "unknown"
+}
+
+// Seed adds a few streams to the corpus of f: filling the cache and
+// reading it back, a scan over every key between reads of a hot few,
+// and a stream that mixes all operations.
+func Seed(f *testing.F) {
+	var fill, scan, mixed []byte
+	for key := 0; key < Keys; key++ {
+		fill = append(fill, byte(OpSet), byte(key))
+	}
+	for key := 0; key < Keys; key++ {
+		fill = append(fill, byte(OpGet), byte(key))
+	}
+
+	for round := 0; round < 4; round++ {
+		for key := 0; key < 3; key++ {
+			scan = append(scan, byte(OpSet), byte(key), byte(OpGet), byte(key))
+		}
+		for key := 3; key < Keys; key++ {
+			scan = append(scan, byte(OpSet), byte(key))
+		}
+	}
+
+	for i := 0; i < 64; i++ {
+		mixed = append(mixed, byte(i%int(numOps)), byte(i*7))
+	}
+
+	f.Add([]byte{})
+	f.Add(fill)
+	f.Add(scan)
+	f.Add(mixed)
+}
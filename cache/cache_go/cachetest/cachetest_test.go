@@ -0,0 +1,73 @@
+package cachetest
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+// TestDecode tests that every two bytes make one operation on a key in range
+func TestDecode(t *testing.T) {
+	ops, keys := Decode([]byte{byte(OpSet), 3, byte(numOps + OpDelete), Keys + 5, 9})
+
+	if !reflect.DeepEqual(ops, []Op{OpSet, OpDelete}) {
+		t.Errorf("Expected [Set Delete], got %v", ops)
+	}
+	if !reflect.DeepEqual(keys, []int{3, 5}) {
+		t.Errorf("Expected keys [3 5], got %v", keys)
+	}
+}
+
+// TestRunWithoutEvict tests that Evict is skipped for a policy without it
+func TestRunWithoutEvict(t *testing.T) {
+	var gets, sets, deletes, checks int
+	p := Policy{
+		Get:             func(key int) { gets++ },
+		Set:             func(key, value int) { sets++ },
+		Delete:          func(key int) { deletes++ },
+		CheckInvariants: func() error { checks++; return nil },
+	}
+
+	Run(t, []byte{byte(OpSet), 1, byte(OpDelete), 1, byte(OpEvict), 0, byte(OpGet), 1}, p)
+	if sets != 1 || deletes != 1 || gets != 1 || checks != 3 {
+		t.Errorf("Expected 1 Set, 1 Delete, 1 Get and 3 checks, got %d, %d, %d and %d", sets, deletes, gets, checks)
+	}
+}
+
+// fatalRecorder keeps the first Fatalf instead of stopping the test, the
+// rest of the stream still runs but only the first failure counts.
+type fatalRecorder struct {
+	testing.TB
+	msg string
+}
+
+func (r *fatalRecorder) Helper() {}
+
+func (r *fatalRecorder) Fatalf(format string, args ...any) {
+	if r.msg == "" {
+		r.msg = fmt.Sprintf(format, args...)
+	}
+}
+
+// TestRunReportsBrokenInvariant tests that Run fails on the first broken invariant
+func TestRunReportsBrokenInvariant(t *testing.T) {
+	data := map[int]int{}
+	p := Policy{
+		Get:    func(key int) {},
+		Set:    func(key, value int) { data[key] = value },
+		Delete: func(key int) { delete(data, key) },
+		CheckInvariants: func() error {
+			if len(data) > 1 {
+				return errors.New("more than one key")
+			}
+			return nil
+		},
+	}
+
+	fake := &fatalRecorder{TB: t}
+	Run(fake, []byte{byte(OpSet), 1, byte(OpDelete), 1, byte(OpSet), 2, byte(OpSet), 3}, p)
+	if fake.msg != "operation 3, Set of key 3: more than one key" {
+		t.Errorf("Expected Run to fail once two keys are stored, got %q", fake.msg)
+	}
+}
@@ -0,0 +1,36 @@
+package cachego
+
+import "errors"
+
+// The errors the policies of this repository return, so a caller can
+// tell failures apart with errors.Is whatever the policy. A policy may
+// wrap them to add the key or the sizes involved.
+var (
+	// ErrCacheFull is returned when there is no room for an entry and
+	// none can be made, e.g. more entries than capacity are loaded.
+	ErrCacheFull = errors.New("cache is full")
+
+	// ErrKeyNotFound is returned when a key that has to be resident is
+	// not.
+	ErrKeyNotFound = errors.New("key not found")
+
+	// ErrKeyExists is returned when a key that must not be resident yet
+	// already is.
+	ErrKeyExists = errors.New("key already exists")
+
+	// ErrCacheEmpty is returned when an eviction is asked of an empty
+	// cache.
+	ErrCacheEmpty = errors.New("cache is empty")
+
+	// ErrInvalidCapacity is returned when a cache is created, or found,
+	// without a capacity greater than 0.
+	ErrInvalidCapacity = errors.New("capacity has to be greater than 0")
+
+	// ErrInvalidArgument is returned when a parameter other than the
+	// capacity is out of the range a policy accepts, e.g. a K of 0.
+	ErrInvalidArgument = errors.New("argument out of range")
+
+	// ErrValueTooLarge is returned when a value is larger than the whole
+	// budget of the cache and could never fit.
+	ErrValueTooLarge = errors.New("value is larger than the cache")
+)
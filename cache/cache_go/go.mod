@@ -0,0 +1,3 @@
+module cache_go
+
+go 1.22.2
@@ -0,0 +1,32 @@
+package persist
+
+import (
+	"encoding/gob"
+	"io"
+
+	cachego "cache_go"
+)
+
+// Save gob-encodes every entry of the cache into w. Only the key/value
+// pairs are written, policy specific metadata such as frequencies or
+// reference history is not part of the format.
+//
+// If K or V is an interface type the concrete types stored in it have
+// to be registered with gob.Register before calling Save or Load.
+func Save[K comparable, V any](c cachego.Cache[K, V], w io.Writer) error {
+	return gob.NewEncoder(w).Encode(c.Entries())
+}
+
+// Load decodes entries written by Save from r and replays them into the
+// cache with Set, in the order they were saved.
+func Load[K comparable, V any](c cachego.Cache[K, V], r io.Reader) error {
+	var entries []cachego.Entry[K, V]
+	if err := gob.NewDecoder(r).Decode(&entries); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		c.Set(entry.Key, entry.Value)
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package persist
+
+import (
+	"bytes"
+	"testing"
+
+	cachego "cache_go"
+)
+
+// mapCache is a minimal Cache used to exercise Save and Load
+type mapCache[K comparable, V any] struct {
+	order []K
+	data  map[K]V
+}
+
+func newMapCache[K comparable, V any]() *mapCache[K, V] {
+	return &mapCache[K, V]{data: make(map[K]V)}
+}
+
+func (m *mapCache[K, V]) Get(key K) (V, bool) {
+	value, present := m.data[key]
+	return value, present
+}
+
+func (m *mapCache[K, V]) Set(key K, value V) {
+	if _, present := m.data[key]; !present {
+		m.order = append(m.order, key)
+	}
+	m.data[key] = value
+}
+
+func (m *mapCache[K, V]) Delete(key K) bool {
+	if _, present := m.data[key]; !present {
+		return false
+	}
+	delete(m.data, key)
+	for i, k := range m.order {
+		if k == key {
+			m.order = append(m.order[:i], m.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (m *mapCache[K, V]) Len() int {
+	return len(m.data)
+}
+
+func (m *mapCache[K, V]) Entries() []cachego.Entry[K, V] {
+	entries := make([]cachego.Entry[K, V], 0, len(m.order))
+	for _, key := range m.order {
+		entries = append(entries, cachego.Entry[K, V]{Key: key, Value: m.data[key]})
+	}
+	return entries
+}
+
+func (m *mapCache[K, V]) Stats() cachego.Stats {
+	return cachego.Stats{Len: len(m.data), Cap: len(m.data)}
+}
+
+// TestSaveLoadRoundTrip tests that every key/value pair survives a round trip
+func TestSaveLoadRoundTrip(t *testing.T) {
+	src := newMapCache[string, []byte]()
+	src.Set("key1", []byte("data1"))
+	src.Set("key2", []byte("data2"))
+	src.Set("key3", []byte("data3"))
+
+	var buf bytes.Buffer
+	if err := Save[string, []byte](src, &buf); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	dst := newMapCache[string, []byte]()
+	if err := Load[string, []byte](dst, &buf); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if dst.Len() != src.Len() {
+		t.Fatalf("Expected %d entries after Load, got %d", src.Len(), dst.Len())
+	}
+	for i, entry := range src.Entries() {
+		value, present := dst.Get(entry.Key)
+		if !present {
+			t.Errorf("Expected key '%s' to be present after Load", entry.Key)
+			continue
+		}
+		if !bytes.Equal(value, entry.Value) {
+			t.Errorf("Expected value '%s' for key '%s', got '%s'", entry.Value, entry.Key, value)
+		}
+		if dst.order[i] != entry.Key {
+			t.Errorf("Expected key '%s' at position %d, got '%s'", entry.Key, i, dst.order[i])
+		}
+	}
+}
+
+// TestSaveLoadEmpty tests persisting an empty cache
+func TestSaveLoadEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Save[int, string](newMapCache[int, string](), &buf); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	dst := newMapCache[int, string]()
+	if err := Load[int, string](dst, &buf); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if dst.Len() != 0 {
+		t.Errorf("Expected empty cache after Load, got %d entries", dst.Len())
+	}
+}
+
+// TestLoadCorrupt tests that Load reports a decoding error
+func TestLoadCorrupt(t *testing.T) {
+	dst := newMapCache[string, string]()
+	err := Load[string, string](dst, bytes.NewBufferString("not gob"))
+	if err == nil {
+		t.Fatal("Expected Load to fail on corrupt input")
+	}
+	if dst.Len() != 0 {
+		t.Errorf("Expected no entries after a failed Load, got %d", dst.Len())
+	}
+}
@@ -0,0 +1,88 @@
+// Package sketch holds approximate data structures shared by the cache
+// policies, such as frequency estimators used for admission and aging.
+package sketch
+
+import (
+	"math"
+	"math/bits"
+)
+
+// depth is the number of rows of a CountMin. Every key is counted once
+// per row and the smallest counter wins, so more rows make a collision
+// in all of them less likely.
+const depth = 4
+
+// seeds spread one hash over the rows so each row collides differently.
+var seeds = [depth]uint64{
+	0xc3a5c85c97cb3127,
+	0xb492b66fbe98f273,
+	0x9ae16a3b2f90404f,
+	0xcbf29ce484222325,
+}
+
+// CountMin is a count-min sketch over 64 bit hashes. Estimate never
+// reports less than the number of times a hash was added since the last
+// Reset, and with width w it overestimates by more than e/w of all adds
+// with a probability of at most e^-4.
+type CountMin struct {
+	counters []uint32
+	mask     uint64
+	adds     uint64
+}
+
+// NewCountMin creates a sketch with width counters per row, rounded up
+// to a power of two.
+func NewCountMin(width int) *CountMin {
+	if width <= 0 {
+		panic("width has to be greater than 0")
+	}
+
+	width = 1 << bits.Len(uint(width-1))
+	return &CountMin{
+		counters: make([]uint32, depth*width),
+		mask:     uint64(width - 1),
+	}
+}
+
+// index returns the position of hash in row.
+func (cm *CountMin) index(hash uint64, row int) int {
+	h := (hash ^ seeds[row]) * 0x9e3779b97f4a7c15
+	h ^= h >> 32
+	return row*int(cm.mask+1) + int(h&cm.mask)
+}
+
+// Add counts one occurrence of hash. Counters saturate instead of
+// wrapping around.
+func (cm *CountMin) Add(hash uint64) {
+	for row := 0; row < depth; row++ {
+		i := cm.index(hash, row)
+		if cm.counters[i] < math.MaxUint32 {
+			cm.counters[i]++
+		}
+	}
+	cm.adds++
+}
+
+// Estimate returns the approximate number of times hash was added.
+func (cm *CountMin) Estimate(hash uint64) uint32 {
+	estimate := uint32(math.MaxUint32)
+	for row := 0; row < depth; row++ {
+		estimate = min(estimate, cm.counters[cm.index(hash, row)])
+	}
+	return estimate
+}
+
+// Reset halves every counter, so old occurrences count half as much as
+// new ones. Calling it periodically ages the sketch.
+func (cm *CountMin) Reset() {
+	for i := range cm.counters {
+		cm.counters[i] /= 2
+	}
+	cm.adds /= 2
+}
+
+// Adds returns the number of adds the sketch currently accounts for,
+// halved by every Reset like the counters.
+func (cm *CountMin) Adds() uint64 {
+	return cm.adds
+}
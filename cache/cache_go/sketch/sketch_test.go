@@ -0,0 +1,97 @@
+package sketch
+
+import (
+	"math"
+	"testing"
+)
+
+// hashOf spreads small integers so the tests do not rely on the sketch
+// mixing sequential keys well.
+func hashOf(key int) uint64 {
+	h := uint64(key) * 0xff51afd7ed558ccd
+	return h ^ h>>33
+}
+
+// TestCountMinNeverUnderestimates tests the count-min guarantee and its error bound
+func TestCountMinNeverUnderestimates(t *testing.T) {
+	const width = 1024
+	cm := NewCountMin(width)
+
+	counts := make(map[int]uint32)
+	for i := 0; i < 20000; i++ {
+		key := (i * i) % 3000
+		counts[key]++
+		cm.Add(hashOf(key))
+	}
+
+	bound := uint32(math.E / width * float64(cm.Adds()))
+	over := 0
+	for key, count := range counts {
+		estimate := cm.Estimate(hashOf(key))
+		if estimate < count {
+			t.Fatalf("Estimate for %d is %d, below its true count %d", key, estimate, count)
+		}
+		if estimate-count > bound {
+			over++
+		}
+	}
+	// e^-4 of 3000 keys is about 55, allow some slack
+	if over > 100 {
+		t.Errorf("Expected few estimates beyond the error bound %d, got %d", bound, over)
+	}
+
+	if estimate := cm.Estimate(hashOf(1 << 40)); estimate > bound {
+		t.Errorf("Expected an unseen hash to stay within the bound %d, got %d", bound, estimate)
+	}
+}
+
+// TestCountMinReset tests that Reset halves every estimate
+func TestCountMinReset(t *testing.T) {
+	cm := NewCountMin(64)
+	for i := 0; i < 9; i++ {
+		cm.Add(42)
+	}
+
+	cm.Reset()
+	if estimate := cm.Estimate(42); estimate != 4 {
+		t.Errorf("Expected 9 halved to 4, got %d", estimate)
+	}
+	if cm.Adds() != 4 {
+		t.Errorf("Expected Adds to be halved to 4, got %d", cm.Adds())
+	}
+
+	cm.Reset()
+	cm.Reset()
+	cm.Reset()
+	if estimate := cm.Estimate(42); estimate != 0 {
+		t.Errorf("Expected the estimate to age out to 0, got %d", estimate)
+	}
+}
+
+// TestCountMinWidth tests that the width is rounded up to a power of two
+func TestCountMinWidth(t *testing.T) {
+	for width, want := range map[int]int{1: 1, 3: 4, 1000: 1024, 1024: 1024} {
+		if got := len(NewCountMin(width).counters) / depth; got != want {
+			t.Errorf("Expected width %d to become %d, got %d", width, want, got)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected NewCountMin(0) to panic")
+		}
+	}()
+	NewCountMin(0)
+}
+
+// TestCountMinAddDoesNotAllocate tests that Add and Estimate are allocation free
+func TestCountMinAddDoesNotAllocate(t *testing.T) {
+	cm := NewCountMin(1024)
+	allocs := testing.AllocsPerRun(1000, func() {
+		cm.Add(7)
+		cm.Estimate(7)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
@@ -0,0 +1,83 @@
+// Package synced makes any cache safe for concurrent use by wrapping it
+// behind a sync.RWMutex, so policies without their own locking can be
+// shared between goroutines and callers that do not share them do not
+// pay for it.
+package synced
+
+import (
+	"sync"
+
+	cachego "cache_go"
+)
+
+// Synced wraps a Cache behind a sync.RWMutex. Len, Entries and Stats
+// take the read lock and Set and Delete the write lock.
+//
+// Get takes the write lock unless the cache was wrapped with
+// NewReadOnlyGet. Most policies change state on every read: LRU moves
+// the key, LFU bumps its frequency, Sieve sets its visited bit, and all
+// of them count hits and misses, so running two of their Gets under a
+// shared read lock would be a data race.
+type Synced[K comparable, V any] struct {
+	mu          sync.RWMutex
+	cache       cachego.Cache[K, V]
+	readOnlyGet bool
+}
+
+// New wraps c, serializing Get with the write lock.
+func New[K comparable, V any](c cachego.Cache[K, V]) *Synced[K, V] {
+	return &Synced[K, V]{cache: c}
+}
+
+// NewReadOnlyGet wraps a cache whose Get does not change any state, so
+// Gets can run in parallel under the read lock.
+func NewReadOnlyGet[K comparable, V any](c cachego.Cache[K, V]) *Synced[K, V] {
+	return &Synced[K, V]{cache: c, readOnlyGet: true}
+}
+
+func (s *Synced[K, V]) Get(key K) (V, bool) {
+	if s.readOnlyGet {
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+	} else {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+	}
+
+	return s.cache.Get(key)
+}
+
+func (s *Synced[K, V]) Set(key K, value V) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache.Set(key, value)
+}
+
+func (s *Synced[K, V]) Delete(key K) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.cache.Delete(key)
+}
+
+func (s *Synced[K, V]) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cache.Len()
+}
+
+func (s *Synced[K, V]) Entries() []cachego.Entry[K, V] {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cache.Entries()
+}
+
+func (s *Synced[K, V]) Stats() cachego.Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.cache.Stats()
+}
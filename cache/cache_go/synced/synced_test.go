@@ -0,0 +1,114 @@
+package synced
+
+import (
+	"sync"
+	"testing"
+
+	cachego "cache_go"
+)
+
+var _ cachego.Cache[string, int] = (*Synced[string, int])(nil)
+
+// countingCache is an unsynchronized map that counts hits and misses on
+// Get, like the policies do
+type countingCache[K comparable, V any] struct {
+	data   map[K]V
+	hits   uint64
+	misses uint64
+}
+
+func newCountingCache[K comparable, V any]() *countingCache[K, V] {
+	return &countingCache[K, V]{data: make(map[K]V)}
+}
+
+func (c *countingCache[K, V]) Get(key K) (V, bool) {
+	value, present := c.data[key]
+	if present {
+		c.hits++
+	} else {
+		c.misses++
+	}
+	return value, present
+}
+
+func (c *countingCache[K, V]) Set(key K, value V) { c.data[key] = value }
+
+func (c *countingCache[K, V]) Delete(key K) bool {
+	_, present := c.data[key]
+	delete(c.data, key)
+	return present
+}
+
+func (c *countingCache[K, V]) Len() int { return len(c.data) }
+
+func (c *countingCache[K, V]) Entries() []cachego.Entry[K, V] {
+	entries := make([]cachego.Entry[K, V], 0, len(c.data))
+	for key, value := range c.data {
+		entries = append(entries, cachego.Entry[K, V]{Key: key, Value: value})
+	}
+	return entries
+}
+
+func (c *countingCache[K, V]) Stats() cachego.Stats {
+	return cachego.Stats{Hits: c.hits, Misses: c.misses, Len: len(c.data)}
+}
+
+// TestSyncedConcurrentUse tests that a cache mutating on Get is safe to share, run with -race
+func TestSyncedConcurrentUse(t *testing.T) {
+	s := New[int, int](newCountingCache[int, int]())
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				key := (g*1000 + i) % 64
+				s.Set(key, i)
+				s.Get(key)
+				if i%10 == 0 {
+					s.Delete(key)
+				}
+				s.Len()
+				s.Stats()
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	stats := s.Stats()
+	if stats.Hits+stats.Misses != 8000 {
+		t.Errorf("Expected 8000 counted Gets, got %+v", stats)
+	}
+	if len(s.Entries()) != s.Len() {
+		t.Errorf("Expected Entries to match Len %d", s.Len())
+	}
+}
+
+// pureCache is a map whose Get changes nothing
+type pureCache struct{ countingCache[string, int] }
+
+func (c *pureCache) Get(key string) (int, bool) {
+	value, present := c.data[key]
+	return value, present
+}
+
+// TestSyncedReadOnlyGet tests that Gets of a read-only cache run in parallel
+func TestSyncedReadOnlyGet(t *testing.T) {
+	s := NewReadOnlyGet[string, int](&pureCache{*newCountingCache[string, int]()})
+	s.Set("key", 1)
+
+	// Hold the read lock; a Get that took the write lock would block here.
+	s.mu.RLock()
+	done := make(chan struct{})
+	go func() {
+		s.Get("key")
+		close(done)
+	}()
+	<-done
+	s.mu.RUnlock()
+
+	if value, ok := s.Get("key"); !ok || value != 1 {
+		t.Errorf("Expected (1, true), got (%d, %v)", value, ok)
+	}
+}
@@ -0,0 +1,173 @@
+// Package tagged adds group invalidation to any cache: keys are stored
+// with tags, and every key carrying a tag can be deleted at once, e.g.
+// the cached results of queries over a table when the table changes.
+// It is written once against the cachego.Cache interface, using only
+// Set, Delete and Entries, so it layers on every policy that implements
+// the interface instead of each policy keeping a tag index of its own.
+package tagged
+
+import (
+	"sync"
+
+	cachego "cache_go"
+)
+
+// Tagged wraps a Cache with a tag index. It is a Cache itself, so it can
+// be handed to anything taking one, and it serializes every call with a
+// mutex so the index and the cache never disagree; like Synced it makes
+// the wrapped cache safe for concurrent use.
+//
+// The policy evicts keys without telling the wrapper, so the index can
+// name keys that are gone. EvictByTag only counts the keys the policy
+// still held, and the index is pruned against Entries whenever it names
+// more than twice as many keys as the cache holds, which keeps it
+// bounded at an amortized O(1) per tagged Set. Every Set replaces the
+// tags of the key, so the stale tags of an evicted key are gone by the
+// time it is stored again and EvictByTag never deletes the new value.
+type Tagged[K comparable, V any] struct {
+	mu    sync.Mutex
+	cache cachego.Cache[K, V]
+
+	tags    map[string]map[K]struct{}
+	keyTags map[K][]string
+}
+
+// New wraps c. Keys already in c carry no tags.
+func New[K comparable, V any](c cachego.Cache[K, V]) *Tagged[K, V] {
+	return &Tagged[K, V]{
+		cache:   c,
+		tags:    make(map[string]map[K]struct{}),
+		keyTags: make(map[K][]string),
+	}
+}
+
+// SetWithTags is Set that also tags key, replacing any tags it had. A
+// tag listed twice is kept once.
+func (t *Tagged[K, V]) SetWithTags(key K, value V, tags []string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cache.Set(key, value)
+	t.untag(key)
+	if len(tags) == 0 {
+		return
+	}
+
+	keyTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys := t.tags[tag]
+		if keys == nil {
+			keys = make(map[K]struct{})
+			t.tags[tag] = keys
+		}
+		if _, tagged := keys[key]; tagged {
+			continue
+		}
+		keys[key] = struct{}{}
+		keyTags = append(keyTags, tag)
+	}
+	t.keyTags[key] = keyTags
+
+	if len(t.keyTags) > 2*max(t.cache.Len(), 1) {
+		t.prune()
+	}
+}
+
+// EvictByTag deletes every key tagged with tag from the cache and
+// returns how many of them it still held.
+func (t *Tagged[K, V]) EvictByTag(tag string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	evicted := 0
+	for key := range t.tags[tag] {
+		if t.cache.Delete(key) {
+			evicted++
+		}
+		t.untag(key)
+	}
+	return evicted
+}
+
+// Tags returns the tags key was last stored with, nil if it has none.
+// A key the policy has evicted since may still be reported.
+func (t *Tagged[K, V]) Tags(key K) []string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return append([]string(nil), t.keyTags[key]...)
+}
+
+// untag removes key from the index, dropping the tags no key carries any
+// more.
+func (t *Tagged[K, V]) untag(key K) {
+	for _, tag := range t.keyTags[key] {
+		delete(t.tags[tag], key)
+		if len(t.tags[tag]) == 0 {
+			delete(t.tags, tag)
+		}
+	}
+	delete(t.keyTags, key)
+}
+
+// prune forgets the tags of keys the cache no longer holds.
+func (t *Tagged[K, V]) prune() {
+	resident := make(map[K]struct{}, t.cache.Len())
+	for _, entry := range t.cache.Entries() {
+		resident[entry.Key] = struct{}{}
+	}
+	for key := range t.keyTags {
+		if _, ok := resident[key]; !ok {
+			t.untag(key)
+		}
+	}
+}
+
+// Get is the Get of the wrapped cache.
+func (t *Tagged[K, V]) Get(key K) (V, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cache.Get(key)
+}
+
+// Set stores value under key without tags, dropping any tags key had:
+// the policy may have evicted key since they were set, and they must
+// not follow the new value. Use SetWithTags to keep them.
+func (t *Tagged[K, V]) Set(key K, value V) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.cache.Set(key, value)
+	t.untag(key)
+}
+
+// Delete deletes key and its tags.
+func (t *Tagged[K, V]) Delete(key K) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.untag(key)
+	return t.cache.Delete(key)
+}
+
+func (t *Tagged[K, V]) Len() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cache.Len()
+}
+
+func (t *Tagged[K, V]) Entries() []cachego.Entry[K, V] {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cache.Entries()
+}
+
+func (t *Tagged[K, V]) Stats() cachego.Stats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.cache.Stats()
+}
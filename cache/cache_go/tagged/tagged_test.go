@@ -0,0 +1,155 @@
+package tagged
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	cachego "cache_go"
+)
+
+var _ cachego.Cache[string, int] = (*Tagged[string, int])(nil)
+
+// fifoCache holds up to capacity keys and evicts the oldest one without
+// telling anybody, the way every policy does
+type fifoCache[K comparable, V any] struct {
+	capacity int
+	order    []K
+	data     map[K]V
+}
+
+func newFIFOCache[K comparable, V any](capacity int) *fifoCache[K, V] {
+	return &fifoCache[K, V]{capacity: capacity, data: make(map[K]V)}
+}
+
+func (c *fifoCache[K, V]) Get(key K) (V, bool) {
+	value, present := c.data[key]
+	return value, present
+}
+
+func (c *fifoCache[K, V]) Set(key K, value V) {
+	if _, present := c.data[key]; !present {
+		if len(c.order) == c.capacity {
+			delete(c.data, c.order[0])
+			c.order = c.order[1:]
+		}
+		c.order = append(c.order, key)
+	}
+	c.data[key] = value
+}
+
+func (c *fifoCache[K, V]) Delete(key K) bool {
+	if _, present := c.data[key]; !present {
+		return false
+	}
+	delete(c.data, key)
+	for i, k := range c.order {
+		if k == key {
+			c.order = append(c.order[:i], c.order[i+1:]...)
+			break
+		}
+	}
+	return true
+}
+
+func (c *fifoCache[K, V]) Len() int { return len(c.data) }
+
+func (c *fifoCache[K, V]) Entries() []cachego.Entry[K, V] {
+	entries := make([]cachego.Entry[K, V], 0, len(c.order))
+	for _, key := range c.order {
+		entries = append(entries, cachego.Entry[K, V]{Key: key, Value: c.data[key]})
+	}
+	return entries
+}
+
+func (c *fifoCache[K, V]) Stats() cachego.Stats {
+	return cachego.Stats{Len: len(c.data), Cap: c.capacity}
+}
+
+// TestEvictByTag tests that every key carrying a tag is deleted and the others stay
+func TestEvictByTag(t *testing.T) {
+	c := New[string, int](newFIFOCache[string, int](10))
+	c.SetWithTags("q1", 1, []string{"users"})
+	c.SetWithTags("q2", 2, []string{"users", "orders", "users"})
+	c.SetWithTags("q3", 3, []string{"orders"})
+	c.Set("q4", 4)
+
+	if tags := c.Tags("q2"); !reflect.DeepEqual(tags, []string{"users", "orders"}) {
+		t.Errorf("Expected q2 tagged users and orders once each, got %v", tags)
+	}
+	if n := c.EvictByTag("users"); n != 2 {
+		t.Errorf("Expected 2 keys evicted, got %d", n)
+	}
+
+	var keys []string
+	for _, entry := range c.Entries() {
+		keys = append(keys, entry.Key)
+	}
+	sort.Strings(keys)
+	if !reflect.DeepEqual(keys, []string{"q3", "q4"}) {
+		t.Errorf("Expected q3 and q4 to stay, got %v", keys)
+	}
+	if n := c.EvictByTag("users"); n != 0 {
+		t.Errorf("Expected nothing left under users, got %d", n)
+	}
+	if _, ok := c.tags["users"]; ok {
+		t.Error("Expected the emptied tag to leave the index")
+	}
+}
+
+// TestTagsFollowTheKey tests that SetWithTags replaces the tags and Set and Delete drop them
+func TestTagsFollowTheKey(t *testing.T) {
+	c := New[string, int](newFIFOCache[string, int](10))
+	c.SetWithTags("a", 1, []string{"t"})
+	c.Set("a", 2)
+	if tags := c.Tags("a"); tags != nil || len(c.tags) != 0 {
+		t.Errorf("Expected Set to drop the tags, got %v", tags)
+	}
+
+	c.SetWithTags("a", 1, []string{"t"})
+	c.SetWithTags("a", 3, []string{"u"})
+	if n := c.EvictByTag("t"); n != 0 {
+		t.Errorf("Expected the old tag to be replaced, %d keys evicted", n)
+	}
+
+	if !c.Delete("a") || c.Tags("a") != nil || len(c.tags) != 0 {
+		t.Errorf("Expected Delete to drop the key and its tags, got %v", c.tags)
+	}
+}
+
+// TestPruneEvictedKeys tests that keys the policy evicted do not pile up in the index
+func TestPruneEvictedKeys(t *testing.T) {
+	c := New[int, int](newFIFOCache[int, int](4))
+	for key := 0; key < 100; key++ {
+		c.SetWithTags(key, key, []string{"t"})
+		if len(c.keyTags) > 2*4+1 {
+			t.Fatalf("Expected the index to stay bounded, it names %d keys after %d sets", len(c.keyTags), key+1)
+		}
+	}
+
+	if n := c.EvictByTag("t"); n != 4 {
+		t.Errorf("Expected only the 4 resident keys counted, got %d", n)
+	}
+	if c.Len() != 0 || len(c.keyTags) != 0 {
+		t.Errorf("Expected an empty cache and index, got %d keys and %v", c.Len(), c.keyTags)
+	}
+}
+
+// TestStaleTagsOfEvictedKey tests that the tags of a key the policy evicted do not follow it when it is stored again
+func TestStaleTagsOfEvictedKey(t *testing.T) {
+	c := New[string, int](newFIFOCache[string, int](2))
+	c.SetWithTags("k", 1, []string{"t"})
+	c.Set("x", 2)
+	c.Set("y", 3) // evicts k, its tags are left in the index
+	if _, ok := c.Get("k"); ok {
+		t.Fatal("Expected k to be evicted")
+	}
+
+	c.Set("k", 4)
+	if n := c.EvictByTag("t"); n != 0 {
+		t.Errorf("Expected nothing evicted under the stale tag, got %d", n)
+	}
+	if value, ok := c.Get("k"); !ok || value != 4 {
+		t.Errorf("Expected the new k to stay, got (%d, %v)", value, ok)
+	}
+}
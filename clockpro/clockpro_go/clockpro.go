@@ -0,0 +1,373 @@
+package clockpro
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	cachego "cache_go"
+)
+
+// pageType is the status CLOCK-Pro gives a page.
+type pageType int
+
+const (
+	// cold pages are resident but have not shown reuse yet, they are
+	// the ones replaced.
+	cold pageType = iota
+	// hot pages are resident and were reused within the test period of
+	// a cold page, they are only demoted to cold.
+	hot
+	// test pages are cold pages that were replaced but are remembered,
+	// without their value, for the length of their test period.
+	test
+)
+
+type page[K comparable, V any] struct {
+	key   K
+	value V
+	ptype pageType
+	ref   bool
+	prev  *page[K, V]
+	next  *page[K, V]
+}
+
+// ClockPro is a CLOCK-Pro cache, an approximation of LIRS on a single
+// clock. Every page, resident or not, sits on one circular list swept
+// by three hands. The cold hand replaces cold pages whose reference bit
+// is clear, turning them into test pages, and promotes those that were
+// referenced to hot. The hot hand demotes hot pages that were not
+// referenced since it last passed. The test hand forgets test pages
+// once there are more than the capacity. A miss on a test page proves
+// the page is reused at a distance that fits, so it comes back hot and
+// the cold target grows; a test page that expires, because the test
+// hand or the hot hand passed it, shrinks it. Scans only ever fill cold
+// pages and leave the hot ones alone.
+type ClockPro[K comparable, V any] struct {
+	Mu       sync.Mutex
+	Capacity int
+
+	pages map[K]*page[K, V]
+
+	handHot  *page[K, V]
+	handCold *page[K, V]
+	handTest *page[K, V]
+
+	countHot  int
+	countCold int
+	countTest int
+
+	// coldTarget is the number of resident pages kept cold, the hot
+	// pages get the rest of the capacity.
+	coldTarget int
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewClockPro creates a cache holding at most capacity values and
+// remembering at most capacity replaced keys.
+func NewClockPro[K comparable, V any](capacity int) *ClockPro[K, V] {
+	if capacity <= 0 {
+		panic("capacity has to be greater than 0")
+	}
+
+	return &ClockPro[K, V]{
+		Capacity:   capacity,
+		pages:      make(map[K]*page[K, V], 2*capacity),
+		coldTarget: capacity,
+	}
+}
+
+// link places p at the head of the clock, just behind the hot hand, so
+// it is the last page every hand reaches.
+func (c *ClockPro[K, V]) link(p *page[K, V]) {
+	c.pages[p.key] = p
+	if c.handHot == nil {
+		p.prev, p.next = p, p
+		c.handHot, c.handCold, c.handTest = p, p, p
+		return
+	}
+
+	p.next = c.handHot
+	p.prev = c.handHot.prev
+	p.prev.next = p
+	c.handHot.prev = p
+}
+
+// unlink removes p from the clock, moving any hand on it to the next
+// page.
+func (c *ClockPro[K, V]) unlink(p *page[K, V]) {
+	delete(c.pages, p.key)
+	if p.next == p {
+		c.handHot, c.handCold, c.handTest = nil, nil, nil
+		return
+	}
+
+	for _, hand := range []**page[K, V]{&c.handHot, &c.handCold, &c.handTest} {
+		if *hand == p {
+			*hand = p.next
+		}
+	}
+	p.prev.next = p.next
+	p.next.prev = p.prev
+	p.prev, p.next = nil, nil
+}
+
+// reclaim runs the cold hand until there is room for one more resident
+// page.
+func (c *ClockPro[K, V]) reclaim() {
+	for c.countHot+c.countCold >= c.Capacity {
+		c.runHandCold()
+	}
+}
+
+// runHandCold examines the page under the cold hand: a referenced cold
+// page is promoted to hot, an unreferenced one is replaced and kept as
+// a test page.
+func (c *ClockPro[K, V]) runHandCold() {
+	p := c.handCold
+	c.handCold = p.next
+
+	if p.ptype == cold {
+		if p.ref {
+			p.ref = false
+			p.ptype = hot
+			c.countCold--
+			c.countHot++
+		} else {
+			var zeroValue V
+			p.value = zeroValue
+			p.ptype = test
+			c.countCold--
+			c.countTest++
+			c.evictions++
+			for c.countTest > c.Capacity {
+				c.runHandTest()
+			}
+		}
+	}
+	c.balanceHot()
+}
+
+// balanceHot runs the hot hand until the hot pages fit in the capacity
+// left over by the cold target.
+func (c *ClockPro[K, V]) balanceHot() {
+	for c.countHot > c.Capacity-c.coldTarget {
+		c.runHandHot()
+	}
+}
+
+// runHandHot examines the page under the hot hand, clearing the
+// reference bit of a hot page or demoting it to cold if it is already
+// clear. A test page it passes has outlived every hot page's last
+// reference, so its test period ends.
+func (c *ClockPro[K, V]) runHandHot() {
+	p := c.handHot
+	c.handHot = p.next
+	switch p.ptype {
+	case hot:
+		if p.ref {
+			p.ref = false
+		} else {
+			p.ptype = cold
+			c.countHot--
+			c.countCold++
+		}
+	case test:
+		c.expire(p)
+	}
+}
+
+// runHandTest examines the page under the test hand, ending the test
+// period of a test page.
+func (c *ClockPro[K, V]) runHandTest() {
+	p := c.handTest
+	c.handTest = p.next
+	if p.ptype == test {
+		c.expire(p)
+	}
+}
+
+// expire forgets a test page whose test period ended without a reuse,
+// which shrinks the cold target.
+func (c *ClockPro[K, V]) expire(p *page[K, V]) {
+	c.unlink(p)
+	c.countTest--
+	c.coldTarget = max(c.coldTarget-1, 1)
+}
+
+// Get returns the value of a resident key and sets its reference bit.
+// A key only remembered as a test page is a miss.
+func (c *ClockPro[K, V]) Get(key K) (V, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	p, present := c.pages[key]
+	if !present || p.ptype == test {
+		c.misses++
+		var zeroValue V
+		return zeroValue, false
+	}
+
+	c.hits++
+	p.ref = true
+	return p.value, true
+}
+
+// Set stores value under key. A resident key is updated and referenced.
+// A key still in its test period comes back as a hot page and grows the
+// cold target, any other key is admitted as a cold page.
+func (c *ClockPro[K, V]) Set(key K, value V) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	p, present := c.pages[key]
+	switch {
+	case present && p.ptype != test:
+		p.value = value
+		p.ref = true
+
+	case present:
+		c.coldTarget = min(c.coldTarget+1, c.Capacity)
+		c.unlink(p)
+		c.countTest--
+		c.reclaim()
+
+		p.value = value
+		p.ref = false
+		p.ptype = hot
+		c.link(p)
+		c.countHot++
+		c.balanceHot()
+
+	default:
+		c.reclaim()
+		c.link(&page[K, V]{key: key, value: value, ptype: cold})
+		c.countCold++
+	}
+}
+
+// Delete removes key, forgetting it entirely if it is only a test page.
+// It reports whether the key was resident.
+func (c *ClockPro[K, V]) Delete(key K) bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	p, present := c.pages[key]
+	if !present {
+		return false
+	}
+
+	c.unlink(p)
+	switch p.ptype {
+	case hot:
+		c.countHot--
+	case cold:
+		c.countCold--
+	default:
+		c.countTest--
+		return false
+	}
+	return true
+}
+
+func (c *ClockPro[K, V]) Len() int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return c.countHot + c.countCold
+}
+
+// Entries returns every resident key in the order the cold hand will
+// reach them.
+func (c *ClockPro[K, V]) Entries() []cachego.Entry[K, V] {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	entries := make([]cachego.Entry[K, V], 0, c.countHot+c.countCold)
+	if c.handCold == nil {
+		return entries
+	}
+	p := c.handCold
+	for {
+		if p.ptype != test {
+			entries = append(entries, cachego.Entry[K, V]{Key: p.key, Value: p.value})
+		}
+		p = p.next
+		if p == c.handCold {
+			return entries
+		}
+	}
+}
+
+func (c *ClockPro[K, V]) Stats() cachego.Stats {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       c.countHot + c.countCold,
+		Cap:       c.Capacity,
+	}
+}
+
+// CheckInvariants walks the clock and reports the first inconsistency:
+// the clock has to be a circular doubly linked list holding exactly the
+// pages in the map, the counts have to match the page types, the
+// resident and the test pages have to fit in the capacity, the cold
+// target has to be between 1 and the capacity, and every hand has to
+// be on the clock.
+func (c *ClockPro[K, V]) CheckInvariants() error {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if c.handHot == nil {
+		if len(c.pages) != 0 || c.handCold != nil || c.handTest != nil {
+			return errors.New("empty clock with pages or hands left")
+		}
+		return nil
+	}
+
+	counts := map[pageType]int{}
+	hands := map[*page[K, V]]bool{}
+	p := c.handHot
+	for {
+		if p.next.prev != p {
+			return fmt.Errorf("page %v has a broken next link", p.key)
+		}
+		if c.pages[p.key] != p {
+			return fmt.Errorf("page %v on the clock is not the one in the map", p.key)
+		}
+		counts[p.ptype]++
+		hands[p] = true
+		if counts[cold]+counts[hot]+counts[test] > len(c.pages) {
+			return fmt.Errorf("clock holds more pages than the %d in the map", len(c.pages))
+		}
+		p = p.next
+		if p == c.handHot {
+			break
+		}
+	}
+
+	if counts[cold]+counts[hot]+counts[test] != len(c.pages) {
+		return fmt.Errorf("clock holds %d pages but the map holds %d", counts[cold]+counts[hot]+counts[test], len(c.pages))
+	}
+	if counts[hot] != c.countHot || counts[cold] != c.countCold || counts[test] != c.countTest {
+		return fmt.Errorf("counted %d hot, %d cold and %d test pages but recorded %d, %d and %d",
+			counts[hot], counts[cold], counts[test], c.countHot, c.countCold, c.countTest)
+	}
+	if c.countHot+c.countCold > c.Capacity || c.countTest > c.Capacity {
+		return fmt.Errorf("%d resident and %d test pages exceed the capacity of %d", c.countHot+c.countCold, c.countTest, c.Capacity)
+	}
+	if c.coldTarget < 1 || c.coldTarget > c.Capacity {
+		return fmt.Errorf("cold target %d is outside 1 to %d", c.coldTarget, c.Capacity)
+	}
+	if !hands[c.handCold] || !hands[c.handTest] {
+		return errors.New("a hand points at a page that is not on the clock")
+	}
+	return nil
+}
@@ -0,0 +1,181 @@
+package clockpro
+
+import (
+	"math/rand"
+	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
+)
+
+var _ cachego.Cache[string, int] = (*ClockPro[string, int])(nil)
+
+// checkClock fails the test if the clock is inconsistent
+func checkClock[K comparable, V any](t *testing.T, c *ClockPro[K, V]) {
+	t.Helper()
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewClockProPanics tests that a non positive capacity is rejected
+func TestNewClockProPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Expected panic for capacity 0")
+		}
+	}()
+	NewClockPro[string, int](0)
+}
+
+// TestGetSet tests basic reads, writes and deletes
+func TestGetSet(t *testing.T) {
+	c := NewClockPro[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected (1, true), got (%v, %v)", v, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected a miss for an unknown key")
+	}
+
+	c.Set("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("Expected updated value 10, got %v", v)
+	}
+	if !c.Delete("a") || c.Delete("a") {
+		t.Error("Expected Delete to report the key only while it is resident")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Expected Len 1, got %d", c.Len())
+	}
+
+	c.Delete("b")
+	checkClock(t, c)
+	c.Set("c", 3)
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Expected an emptied clock to take new keys, got (%v, %v)", v, ok)
+	}
+	checkClock(t, c)
+}
+
+// TestColdReplacement tests that unreferenced cold pages are replaced in clock order
+func TestColdReplacement(t *testing.T) {
+	c := NewClockPro[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+
+	c.Set("d", 4) // a was referenced and is promoted, b is replaced
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be replaced")
+	}
+	if _, ok := c.Get("a"); !ok {
+		t.Error("Expected the referenced a to stay")
+	}
+	if c.pages["b"].ptype != test {
+		t.Error("Expected b to be kept as a test page")
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Len != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	checkClock(t, c)
+}
+
+// TestTestPageHit tests that a key coming back in its test period is admitted hot
+func TestTestPageHit(t *testing.T) {
+	c := NewClockPro[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4) // a becomes a test page
+	c.coldTarget = 1
+
+	c.Set("a", 5)
+	if c.pages["a"].ptype != hot {
+		t.Errorf("Expected a to come back hot, got type %d", c.pages["a"].ptype)
+	}
+	if c.coldTarget != 2 {
+		t.Errorf("Expected the cold target to grow to 2, got %d", c.coldTarget)
+	}
+	if v, ok := c.Get("a"); !ok || v != 5 {
+		t.Errorf("Expected (5, true), got (%v, %v)", v, ok)
+	}
+	checkClock(t, c)
+}
+
+// TestScanResistance tests that a scan of one-off keys does not flush a reused working set
+func TestScanResistance(t *testing.T) {
+	c := NewClockPro[int, int](100)
+	hotKeys := 50
+
+	// Let the working set prove its reuse while one-off keys pass by.
+	next := 1000
+	for round := 0; round < 20; round++ {
+		for key := 0; key < hotKeys; key++ {
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, key)
+			}
+			c.Set(next, next)
+			next++
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		c.Set(next, next)
+		next++
+	}
+
+	resident := 0
+	for key := 0; key < hotKeys; key++ {
+		if _, ok := c.Get(key); ok {
+			resident++
+		}
+	}
+	if resident < hotKeys*9/10 {
+		t.Errorf("Expected the working set to survive the scan, %d of %d keys are resident", resident, hotKeys)
+	}
+	checkClock(t, c)
+}
+
+// TestRandomizedInvariants tests that a random workload keeps the clock consistent
+func TestRandomizedInvariants(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, capacity := range []int{1, 2, 7, 64} {
+		c := NewClockPro[int, int](capacity)
+		for i := 0; i < 5000; i++ {
+			key := rng.Intn(capacity * 4)
+			switch op := rng.Intn(10); {
+			case op < 5:
+				c.Set(key, i)
+			case op < 9:
+				c.Get(key)
+			default:
+				c.Delete(key)
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Fatalf("capacity %d, step %d: %v", capacity, i, err)
+			}
+		}
+		if len(c.Entries()) != c.Len() {
+			t.Errorf("Expected %d entries, got %d", c.Len(), len(c.Entries()))
+		}
+	}
+}
+
+// FuzzClockPro tests that no stream of operations leaves the clock inconsistent
+func FuzzClockPro(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewClockPro[int, int](4)
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { c.Get(key) },
+			Set:             func(key, value int) { c.Set(key, value) },
+			Delete:          func(key int) { c.Delete(key) },
+			CheckInvariants: c.CheckInvariants,
+		})
+	})
+}
@@ -0,0 +1,68 @@
+package lfuo1
+
+import (
+	"fmt"
+
+	cachego "cache_go"
+)
+
+// The Try variants below behave like their namesakes but return one of
+// the cachego errors instead of panicking, for callers that embed the
+// cache and would rather not recover().
+
+// TryNewLfuCacheWithSize is NewLfuCacheWithSize returning
+// cachego.ErrInvalidCapacity for a size that is not greater than 0.
+func TryNewLfuCacheWithSize[T comparable](size int) (*LFU_Cache[T], error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("%w: got %d", cachego.ErrInvalidCapacity, size)
+	}
+	return NewLfuCacheWithSize[T](size), nil
+}
+
+// TryInsert is Insert returning cachego.ErrKeyExists if key is already
+// present, and cachego.ErrInvalidCapacity if the cache was created
+// without a size. An expired key is not present, it is replaced.
+func (lfuCache *LFU_Cache[T]) TryInsert(key T, value any) error {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	if lfuCache.size <= 0 {
+		return cachego.ErrInvalidCapacity
+	}
+	if item, present := lfuCache.bykey[key]; present {
+		if !lfuCache.expired(item) {
+			return fmt.Errorf("%w: %v", cachego.ErrKeyExists, key)
+		}
+		lfuCache.remove(item)
+	}
+	lfuCache.insert(key, value, 1)
+	return nil
+}
+
+// TryAccess is Access returning cachego.ErrKeyNotFound, and counting a
+// miss, if key is not present or has expired.
+func (lfuCache *LFU_Cache[T]) TryAccess(key T) (any, error) {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item := lfuCache.tryBump(key, 1)
+	if item == nil {
+		return nil, fmt.Errorf("%w: %v", cachego.ErrKeyNotFound, key)
+	}
+	return item.data, nil
+}
+
+// TryEvict is Evict returning cachego.ErrCacheEmpty when there is
+// nothing to evict.
+func (lfuCache *LFU_Cache[T]) TryEvict() (T, any, error) {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	if len(lfuCache.bykey) == 0 {
+		var zeroValue T
+		return zeroValue, nil, cachego.ErrCacheEmpty
+	}
+	key, value := lfuCache.evict()
+	return key, value, nil
+}
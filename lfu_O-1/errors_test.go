@@ -0,0 +1,69 @@
+package lfuo1
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	cachego "cache_go"
+)
+
+// TestTryNewLfuCacheWithSize tests that a size below 1 is an error instead of a panic
+func TestTryNewLfuCacheWithSize(t *testing.T) {
+	if _, err := TryNewLfuCacheWithSize[string](0); !errors.Is(err, cachego.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+	if cache, err := TryNewLfuCacheWithSize[string](2); err != nil || cache.Stats().Cap != 2 {
+		t.Errorf("Expected a cache of size 2, got %v", err)
+	}
+}
+
+// TestTryInsert tests that TryInsert reports a present key and a cache without capacity
+func TestTryInsert(t *testing.T) {
+	if err := NewLfuCache[string]().TryInsert("a", "value-a"); !errors.Is(err, cachego.ErrInvalidCapacity) {
+		t.Errorf("Expected ErrInvalidCapacity, got %v", err)
+	}
+
+	cache, clock := newTTLCache(2)
+	if err := cache.TryInsert("a", "value-a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cache.TryInsert("a", "value-b"); !errors.Is(err, cachego.ErrKeyExists) {
+		t.Errorf("Expected ErrKeyExists, got %v", err)
+	}
+
+	cache.InsertWithTTL("b", "value-b", time.Second)
+	clock.t = clock.t.Add(time.Second)
+	if err := cache.TryInsert("b", "value-c"); err != nil {
+		t.Errorf("Expected an expired key to be replaced, got %v", err)
+	}
+	if value, _ := cache.Peek("b"); value != "value-c" {
+		t.Errorf("Expected value-c, got %v", value)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTryAccessAndEvict tests that a missing key and an empty cache are errors
+func TestTryAccessAndEvict(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Insert("a", "value-a")
+
+	if value, err := cache.TryAccess("a"); err != nil || value != "value-a" {
+		t.Errorf("Expected (value-a, nil), got (%v, %v)", value, err)
+	}
+	if _, err := cache.TryAccess("missing"); !errors.Is(err, cachego.ErrKeyNotFound) {
+		t.Errorf("Expected ErrKeyNotFound, got %v", err)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+
+	if key, _, err := cache.TryEvict(); err != nil || key != "a" {
+		t.Errorf("Expected a to be evicted, got %v and %v", key, err)
+	}
+	if _, _, err := cache.TryEvict(); !errors.Is(err, cachego.ErrCacheEmpty) {
+		t.Errorf("Expected ErrCacheEmpty, got %v", err)
+	}
+}
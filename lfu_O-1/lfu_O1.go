@@ -1,17 +1,36 @@
 package lfuo1
 
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	cachego "cache_go"
+)
+
 type FreqNode[T comparable] struct {
 	value int
+	// items is only allocated once a second item joins the node, a node
+	// holding a single item keeps it in oldest and newest alone. Many
+	// distinct frequencies mean many single item nodes, and a map costs
+	// far more than the item it would hold.
 	items map[T]*LFU_Item[T]
+	size  int
 	prev  *FreqNode[T]
 	next  *FreqNode[T]
+
+	// oldest and newest are the ends of the node's items ordered by
+	// last_access, so either end can be evicted in O(1).
+	oldest *LFU_Item[T]
+	newest *LFU_Item[T]
 }
 
 func NewFreqNode[T comparable]() *FreqNode[T] {
 
 	return &FreqNode[T]{
 		value: 0,
-		items: make(map[T]*LFU_Item[T]),
 		prev:  nil,
 		next:  nil,
 	}
@@ -32,6 +51,109 @@ func GetNewNode[T comparable](value int, prev, next *FreqNode[T]) *FreqNode[T] {
 	return new_node
 }
 
+// push adds item to the node as its most recently accessed item.
+func (node *FreqNode[T]) push(key T, item *LFU_Item[T]) {
+	if node.size == 1 && node.items == nil {
+		node.items = make(map[T]*LFU_Item[T], 2)
+		node.items[node.oldest.key] = node.oldest
+	}
+	if node.items != nil {
+		node.items[key] = item
+	}
+	node.size++
+	item.parent = node
+
+	item.older = node.newest
+	item.newer = nil
+	if node.newest != nil {
+		node.newest.newer = item
+	} else {
+		node.oldest = item
+	}
+	node.newest = item
+}
+
+// unlink removes item from the node.
+func (node *FreqNode[T]) unlink(key T, item *LFU_Item[T]) {
+	delete(node.items, key)
+	node.size--
+
+	if item.older != nil {
+		item.older.newer = item.newer
+	} else {
+		node.oldest = item.newer
+	}
+	if item.newer != nil {
+		item.newer.older = item.older
+	} else {
+		node.newest = item.older
+	}
+	item.older = nil
+	item.newer = nil
+}
+
+// absorb moves every item of other into node, keeping the items ordered
+// by last_access.
+func (node *FreqNode[T]) absorb(other *FreqNode[T]) {
+	a, b := node.oldest, other.oldest
+	node.oldest, node.newest = nil, nil
+	node.size = 0
+	for a != nil || b != nil {
+		var item *LFU_Item[T]
+		if b == nil || (a != nil && a.last_access <= b.last_access) {
+			item, a = a, a.newer
+		} else {
+			item, b = b, b.newer
+		}
+		node.push(item.key, item)
+	}
+	other.items = nil
+	other.size = 0
+	other.oldest, other.newest = nil, nil
+}
+
+// len returns the number of items in the node.
+func (node *FreqNode[T]) len() int {
+	return node.size
+}
+
+// maxFreeNodes bounds the frequency nodes an LFU_Cache keeps for reuse.
+const maxFreeNodes = 64
+
+// newNode is GetNewNode taking the node from the free list when it is
+// not empty.
+func (lfuCache *LFU_Cache[T]) newNode(value int, prev, next *FreqNode[T]) *FreqNode[T] {
+	node := lfuCache.freeNodes
+	if node == nil {
+		return GetNewNode(value, prev, next)
+	}
+	lfuCache.freeNodes = node.next
+	lfuCache.numFreeNodes--
+
+	node.value = value
+	node.prev = prev
+	node.next = next
+	prev.next = node
+	if next != nil {
+		next.prev = node
+	}
+	return node
+}
+
+// releaseNode unlinks an empty node, see DeleteNode, and keeps it on the
+// free list unless that is full. Its items map is dropped rather than
+// kept, a map never shrinks and would stay with whatever item reuses the
+// node.
+func (lfuCache *LFU_Cache[T]) releaseNode(node *FreqNode[T]) {
+	DeleteNode(node)
+	if lfuCache.numFreeNodes >= maxFreeNodes {
+		return
+	}
+	*node = FreqNode[T]{next: lfuCache.freeNodes}
+	lfuCache.freeNodes = node
+	lfuCache.numFreeNodes++
+}
+
 func DeleteNode[T comparable](node *FreqNode[T]) {
 	next := node.next
 	prev := node.prev
@@ -45,6 +167,23 @@ func DeleteNode[T comparable](node *FreqNode[T]) {
 type LFU_Item[T comparable] struct {
 	data   any
 	parent *FreqNode[T]
+
+	// last_access is the value of the cache's clock when the item was
+	// last inserted or accessed, used to order items within a bucket.
+	last_access uint64
+	// count is the number of references to the item since it was
+	// inserted, which DynamicAging adds L to when keying the item.
+	count int
+
+	// expires is when an item inserted with InsertWithTTL stops being
+	// served, zero for items that never expire. expiryIndex is the
+	// item's position in the cache's expiring heap.
+	expires     time.Time
+	expiryIndex int
+
+	key   T
+	older *LFU_Item[T]
+	newer *LFU_Item[T]
 }
 
 func NewLfuItem[T comparable](data any, parent *FreqNode[T]) *LFU_Item[T] {
@@ -56,11 +195,76 @@ func NewLfuItem[T comparable](data any, parent *FreqNode[T]) *LFU_Item[T] {
 }
 
 type LFU_Cache[T comparable] struct {
+	// Mu guards every structural change to the frequency list and
+	// bykey, so Insert, Access, AccessN, Decay, ResetFrequencies and
+	// Evict can be called from several goroutines.
+	Mu sync.Mutex
+
 	size      int
 	bykey     map[T]*LFU_Item[T]
 	freq_Head *FreqNode[T]
+	clock     uint64
+
+	// DynamicAging turns the cache into LFU-DA: every item is keyed on
+	// its reference count plus the age L, and L rises to the key of each
+	// evicted item, so keys that were hot long ago eventually lose to
+	// new ones instead of squatting forever.
+	DynamicAging bool
+	age          int
+
+	// TieBreak picks which of the least frequently used items is
+	// evicted, the least recently accessed one by default.
+	TieBreak TieBreak
+
+	// OnFreqChange is called with the old and new reference count of a
+	// key whenever Access, AccessN, Decay or ResetFrequencies changes it.
+	// The calls are made once the frequency list is consistent again and
+	// the lock is released, so they may call back into the cache.
+	OnFreqChange func(key T, oldFreq, newFreq int)
+	freqChanges  []freqChange[T]
+
+	// accesses is the sum of the reference counts of all resident items.
+	accesses uint64
+
+	// freeNodes is a list, linked through next, of up to maxFreeNodes
+	// frequency nodes that emptied and were unlinked, kept so that an
+	// item stepping up from a node of its own reuses the node it leaves
+	// instead of allocating a new one each time.
+	freeNodes    *FreqNode[T]
+	numFreeNodes int
+
+	// expiring holds the items inserted with a TTL, the one expiring
+	// first on top. now is the clock they are checked against,
+	// time.Now unless a test replaces it.
+	expiring expiryHeap[T]
+	now      func() time.Time
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+type freqChange[T comparable] struct {
+	key              T
+	oldFreq, newFreq int
 }
 
+// TieBreak is the choice of victim among items sharing the lowest
+// frequency.
+type TieBreak int
+
+const (
+	// TieBreakOldest evicts the least recently accessed item, LRU
+	// within LFU.
+	TieBreakOldest TieBreak = iota
+	// TieBreakNewest evicts the most recently accessed item, MRU within
+	// LFU.
+	TieBreakNewest
+	// TieBreakArbitrary evicts whichever item the bucket's map yields
+	// first.
+	TieBreakArbitrary
+)
+
 func NewLfuCache[T comparable]() *LFU_Cache[T] {
 
 	return &LFU_Cache[T]{
@@ -73,7 +277,62 @@ func NewLfuCache[T comparable]() *LFU_Cache[T] {
 	}
 }
 
+// NewLfuCacheWithSize creates an LFU cache holding at most size items.
+// A cache has to hold at least one item, so size 0 is rejected here
+// rather than turning every Insert into an eviction from an empty cache.
+func NewLfuCacheWithSize[T comparable](size int) *LFU_Cache[T] {
+	if size <= 0 {
+		panic("size has to be greater than 0")
+	}
+
+	lfuCache := NewLfuCache[T]()
+	lfuCache.size = size
+	return lfuCache
+}
+
+// Insert adds key with frequency 1, evicting the least frequently used
+// item when the cache is full. It panics if key is already present or
+// if the cache was created without a size.
 func (lfuCache *LFU_Cache[T]) Insert(key T, value any) {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	lfuCache.insert(key, value, 1)
+}
+
+// Entry is a key to bulk load with InsertMany at a starting frequency.
+type Entry[T comparable] struct {
+	Key       T
+	Value     any
+	Frequency int
+}
+
+// InsertMany inserts entries in order under a single lock, each one
+// placed straight at its Frequency. The frequency list ends up the same
+// as after inserting every key and accessing it up to its frequency,
+// evicting the least frequently used item whenever the cache is full,
+// but without a walk per access and without counting the loads as hits.
+func (lfuCache *LFU_Cache[T]) InsertMany(entries []Entry[T]) {
+	for _, entry := range entries {
+		if entry.Frequency <= 0 {
+			panic("frequency has to be greater than 0")
+		}
+	}
+
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	for _, entry := range entries {
+		lfuCache.insert(entry.Key, entry.Value, entry.Frequency)
+	}
+}
+
+// insert adds key with the given reference count, evicting first if
+// the cache is full.
+func (lfuCache *LFU_Cache[T]) insert(key T, value any, count int) {
+	if lfuCache.size <= 0 {
+		panic("the cache has no capacity")
+	}
 
 	_, present := lfuCache.bykey[key]
 	if present {
@@ -81,46 +340,446 @@ func (lfuCache *LFU_Cache[T]) Insert(key T, value any) {
 	}
 
 	if len(lfuCache.bykey) == lfuCache.size {
-		lfuCache.Evict()
+		lfuCache.evict()
 	}
+	lfuCache.place(key, value, count)
+}
 
-	freq := lfuCache.freq_Head.next
-	if freq == nil {
-		freq = GetNewNode(1, lfuCache.freq_Head, freq)
-	} else if freq.value != 1 {
-		freq = GetNewNode(1, lfuCache.freq_Head, freq)
-	}
+// place adds key with the given reference count without checking the
+// capacity.
+func (lfuCache *LFU_Cache[T]) place(key T, value any, count int) {
+	freq := lfuCache.nodeFor(lfuCache.key(count))
 
 	lfuItem := NewLfuItem(value, freq)
+	lfuItem.key = key
+	lfuCache.clock++
+	lfuItem.last_access = lfuCache.clock
+	lfuItem.count = count
+	lfuCache.accesses += uint64(count)
 	lfuCache.bykey[key] = lfuItem
-	freq.items[key] = lfuItem
+	freq.push(key, lfuItem)
 }
 
 func (lfuCache *LFU_Cache[T]) Access(key T) (value any) {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
 
-	tmp := lfuCache.bykey[key]
+	return lfuCache.bump(key, 1).data
+}
+
+// Peek returns the value of key without counting an access, so reads
+// for monitoring do not distort the popularity of the key.
+func (lfuCache *LFU_Cache[T]) Peek(key T) (any, bool) {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item, present := lfuCache.bykey[key]
+	if !present || lfuCache.expired(item) {
+		return nil, false
+	}
+	return item.data, true
+}
+
+// AccessIfPresent counts an access to key like Access and reports true
+// when key is in the cache, and reports false without changing anything,
+// not even the miss count, when it is not. An expired key is removed and
+// reported absent the same way. It lets a replayed access log refer to
+// keys that were evicted since, in one call and under one lock.
+func (lfuCache *LFU_Cache[T]) AccessIfPresent(key T) bool {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item, present := lfuCache.bykey[key]
+	if !present {
+		return false
+	}
+	if lfuCache.expired(item) {
+		lfuCache.remove(item)
+		return false
+	}
+	lfuCache.hits++
+	lfuCache.raise(key, item, 1)
+	return true
+}
+
+// AccessMinAware counts an access to key like Access and also reports
+// whether it raised the minimum frequency, the one the next eviction is
+// taken from: key was the only item at that frequency, so the cache as a
+// whole got warmer. A missing or expired key is counted as a miss and
+// reported with ok false instead of panicking.
+func (lfuCache *LFU_Cache[T]) AccessMinAware(key T) (value any, minFreqChanged, ok bool) {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	// The node itself cannot be compared, an emptied node is released
+	// and may be reused for the frequency the item moves to.
+	var min int
+	if lfuCache.freq_Head.next != nil {
+		min = lfuCache.freq_Head.next.value
+	}
+	item := lfuCache.tryBump(key, 1)
+	if item == nil {
+		return nil, false, false
+	}
+	return item.data, lfuCache.freq_Head.next.value != min, true
+}
+
+// Get is AccessIfPresent returning the value, except that a miss is
+// counted. With Set and Delete it makes the cache a cachego.Cache, so
+// that the wrappers of cache_go, such as tagged for group invalidation,
+// layer on it.
+func (lfuCache *LFU_Cache[T]) Get(key T) (any, bool) {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item := lfuCache.tryBump(key, 1)
+	if item == nil {
+		return nil, false
+	}
+	return item.data, true
+}
+
+// Set inserts key with frequency 1 like Insert, or replaces the value of
+// a present key, counting the write as an access to it but not as a
+// hit. An expired key is replaced as if it were missing.
+func (lfuCache *LFU_Cache[T]) Set(key T, value any) {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	if item, present := lfuCache.bykey[key]; present {
+		if !lfuCache.expired(item) {
+			item.data = value
+			lfuCache.raise(key, item, 1)
+			return
+		}
+		lfuCache.remove(item)
+	}
+	lfuCache.insert(key, value, 1)
+}
+
+// Delete removes key whatever its frequency and reports whether it was
+// present. An expired key is removed too but reported absent.
+func (lfuCache *LFU_Cache[T]) Delete(key T) bool {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item, present := lfuCache.bykey[key]
+	if !present {
+		return false
+	}
+	expired := lfuCache.expired(item)
+	lfuCache.remove(item)
+	return !expired
+}
+
+// AccessN counts n accesses to key at once, moving it straight to the
+// frequency node n steps up instead of stepping through every level.
+func (lfuCache *LFU_Cache[T]) AccessN(key T, n int) (value any) {
+	if n <= 0 {
+		panic("n has to be greater than 0")
+	}
+
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	return lfuCache.bump(key, n).data
+}
+
+// bump counts n accesses to key. An expired key is removed and counts as
+// a miss like a missing one, which panics.
+func (lfuCache *LFU_Cache[T]) bump(key T, n int) *LFU_Item[T] {
+	tmp := lfuCache.tryBump(key, n)
 	if tmp == nil {
 		panic("No such key")
 	}
+	return tmp
+}
+
+// tryBump is bump returning nil on a miss.
+func (lfuCache *LFU_Cache[T]) tryBump(key T, n int) *LFU_Item[T] {
 
+	tmp := lfuCache.bykey[key]
+	if tmp != nil && lfuCache.expired(tmp) {
+		lfuCache.remove(tmp)
+		tmp = nil
+	}
+	if tmp == nil {
+		lfuCache.misses++
+		return nil
+	}
+	lfuCache.hits++
+	lfuCache.raise(key, tmp, n)
+	return tmp
+}
+
+// raise adds n references to item, moving it up the frequency list as
+// its most recently accessed item.
+func (lfuCache *LFU_Cache[T]) raise(key T, tmp *LFU_Item[T], n int) {
 	freq := tmp.parent
-	next_freq := freq.next
-	if next_freq == nil || next_freq.value != freq.value+1 {
-		next_freq = GetNewNode(freq.value+1, freq, next_freq)
+	lfuCache.recordFreqChange(key, tmp.count, tmp.count+n)
+	tmp.count += n
+	lfuCache.accesses += uint64(n)
+	target := freq.value + n
+	if lfuCache.DynamicAging {
+		target = lfuCache.key(tmp.count)
+	}
+
+	prev_freq := freq
+	for prev_freq.next != nil && prev_freq.next.value <= target {
+		prev_freq = prev_freq.next
+	}
+
+	next_freq := prev_freq
+	if next_freq.value != target {
+		next_freq = lfuCache.newNode(target, prev_freq, prev_freq.next)
+	}
+
+	freq.unlink(key, tmp)
+	lfuCache.clock++
+	tmp.last_access = lfuCache.clock
+	next_freq.push(key, tmp)
+
+	if freq.len() == 0 {
+		lfuCache.releaseNode(freq)
+	}
+}
+
+// recordFreqChange queues an OnFreqChange call, it must be called with
+// Mu held.
+func (lfuCache *LFU_Cache[T]) recordFreqChange(key T, oldFreq, newFreq int) {
+	if lfuCache.OnFreqChange == nil || oldFreq == newFreq {
+		return
+	}
+	lfuCache.freqChanges = append(lfuCache.freqChanges, freqChange[T]{key: key, oldFreq: oldFreq, newFreq: newFreq})
+}
+
+// fireFreqChanges makes the queued OnFreqChange calls. It is deferred
+// before Mu is taken, so it runs after the lock is released.
+func (lfuCache *LFU_Cache[T]) fireFreqChanges() {
+	lfuCache.Mu.Lock()
+	changes := lfuCache.freqChanges
+	lfuCache.freqChanges = nil
+	onFreqChange := lfuCache.OnFreqChange
+	lfuCache.Mu.Unlock()
+
+	if onFreqChange == nil {
+		return
+	}
+	for _, change := range changes {
+		onFreqChange(change.key, change.oldFreq, change.newFreq)
+	}
+}
+
+// Merge adds the frequencies of other to the cache, e.g. to aggregate
+// the popularity seen by several shards. A key present in both gets the
+// reference count of other added to its own, a key only in other is
+// inserted with its value and reference count, and once every key is in
+// the least frequently used items are evicted until the cache is back
+// within its size. other is read under its own lock first, so merging
+// two caches into each other at the same time cannot deadlock. Nothing
+// is counted as a hit, OnFreqChange is called for the keys that were
+// already present.
+func (lfuCache *LFU_Cache[T]) Merge(other *LFU_Cache[T]) {
+	type merged struct {
+		key   T
+		value any
+		count int
+	}
+
+	other.Mu.Lock()
+	items := make([]merged, 0, len(other.bykey))
+	for node := other.freq_Head.next; node != nil; node = node.next {
+		for item := node.oldest; item != nil; item = item.newer {
+			items = append(items, merged{key: item.key, value: item.data, count: item.count})
+		}
+	}
+	other.Mu.Unlock()
+
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	if lfuCache.size <= 0 {
+		panic("the cache has no capacity")
 	}
 
-	next_freq.items[key] = tmp
-	tmp.parent = next_freq
+	for _, item := range items {
+		if present, ok := lfuCache.bykey[item.key]; ok {
+			lfuCache.raise(item.key, present, item.count)
+		} else {
+			lfuCache.place(item.key, item.value, item.count)
+		}
+	}
+	for len(lfuCache.bykey) > lfuCache.size {
+		lfuCache.evict()
+	}
+}
+
+// Age returns the current aging factor L of an LFU-DA cache. It is
+// always 0 when DynamicAging is off.
+func (lfuCache *LFU_Cache[T]) Age() int {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
 
-	delete(freq.items, key)
-	if len(freq.items) == 0 {
-		DeleteNode(freq)
+	return lfuCache.age
+}
+
+// key returns the frequency node value an item referenced count times
+// belongs in.
+func (lfuCache *LFU_Cache[T]) key(count int) int {
+	if lfuCache.DynamicAging {
+		return count + lfuCache.age
 	}
+	return count
+}
 
-	return tmp.data
+// nodeFor returns the frequency node with the given value, creating it
+// in order if it does not exist yet. Without aging the value is always
+// 1, so the walk stops at the first node.
+func (lfuCache *LFU_Cache[T]) nodeFor(value int) *FreqNode[T] {
+	prev := lfuCache.freq_Head
+	for prev.next != nil && prev.next.value <= value {
+		prev = prev.next
+	}
+	if prev != lfuCache.freq_Head && prev.value == value {
+		return prev
+	}
+	return lfuCache.newNode(value, prev, prev.next)
+}
+
+// Decay halves the frequency of every item (never below 1) so that keys
+// which were popular a long time ago stop outranking recent ones.
+func (lfuCache *LFU_Cache[T]) Decay() {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	lfuCache.rebucket(func(value int) int {
+		return max(value/2, 1)
+	})
+}
+
+// ResetFrequencies drops every item back to frequency 1.
+func (lfuCache *LFU_Cache[T]) ResetFrequencies() {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	lfuCache.rebucket(func(int) int {
+		return 1
+	})
+}
+
+// Compact renumbers the frequency nodes 1, 2, 3 and so on from the
+// least frequent one, so that after a long run the frequencies are ranks
+// again rather than ever growing counts with gaps between them. Every
+// item keeps its node and its place in it, so the eviction order does not
+// change, and its reference count becomes the new value of its node,
+// reported to OnFreqChange like Decay does. With DynamicAging the age is
+// reset to 0 along with the counts.
+func (lfuCache *LFU_Cache[T]) Compact() {
+	defer lfuCache.fireFreqChanges()
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	value := 0
+	for node := lfuCache.freq_Head.next; node != nil; node = node.next {
+		value++
+		node.value = value
+		for item := node.oldest; item != nil; item = item.newer {
+			lfuCache.accesses -= uint64(item.count)
+			lfuCache.recordFreqChange(item.key, item.count, value)
+			item.count = value
+			lfuCache.accesses += uint64(item.count)
+		}
+	}
+	lfuCache.age = 0
+}
+
+// rebucket renumbers every frequency node and the reference count of
+// every item with f, merging neighbours that end up with the same value.
+// f has to be non-decreasing so the list stays sorted. With DynamicAging
+// the items are keyed again on f(count) + L instead, see rebucketAged.
+func (lfuCache *LFU_Cache[T]) rebucket(f func(value int) int) {
+	if lfuCache.DynamicAging {
+		lfuCache.rebucketAged(f)
+		return
+	}
+
+	node := lfuCache.freq_Head.next
+	for node != nil {
+		next := node.next
+		node.value = f(node.value)
+		for item := node.oldest; item != nil; item = item.newer {
+			lfuCache.accesses -= uint64(item.count)
+			lfuCache.recordFreqChange(item.key, item.count, f(item.count))
+			item.count = f(item.count)
+			lfuCache.accesses += uint64(item.count)
+		}
+
+		prev := node.prev
+		if prev != lfuCache.freq_Head && prev.value == node.value {
+			prev.absorb(node)
+			lfuCache.releaseNode(node)
+		}
+		node = next
+	}
+}
+
+// rebucketAged is rebucket for LFU-DA. A node value there is the count
+// plus the L of the item's last reference, so applying f to it would key
+// items below L and let the next eviction lower L. Every item is keyed
+// on f(count) + L instead, which may split the items of one node, so the
+// list is rebuilt ordered by the new key and then by last access.
+func (lfuCache *LFU_Cache[T]) rebucketAged(f func(value int) int) {
+	items := make([]*LFU_Item[T], 0, len(lfuCache.bykey))
+	for node := lfuCache.freq_Head.next; node != nil; node = node.next {
+		for item := node.oldest; item != nil; item = item.newer {
+			items = append(items, item)
+		}
+	}
+	for node := lfuCache.freq_Head.next; node != nil; {
+		next := node.next
+		lfuCache.releaseNode(node)
+		node = next
+	}
+
+	for _, item := range items {
+		lfuCache.accesses -= uint64(item.count)
+		lfuCache.recordFreqChange(item.key, item.count, f(item.count))
+		item.count = f(item.count)
+		lfuCache.accesses += uint64(item.count)
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].count != items[j].count {
+			return items[i].count < items[j].count
+		}
+		return items[i].last_access < items[j].last_access
+	})
+
+	node := lfuCache.freq_Head
+	for _, item := range items {
+		if value := lfuCache.key(item.count); node == lfuCache.freq_Head || node.value != value {
+			node = lfuCache.newNode(value, node, nil)
+		}
+		node.push(item.key, item)
+	}
 }
 
 func (lfuCache *LFU_Cache[T]) Evict() (T, any) {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	return lfuCache.evict()
+}
+
+func (lfuCache *LFU_Cache[T]) evict() (T, any) {
 
 	var zeroValue T
 
@@ -132,16 +791,219 @@ func (lfuCache *LFU_Cache[T]) Evict() (T, any) {
 		panic("the set is empty")
 	}
 
-	for item, present := range lfuCache.freq_Head.next.items {
-		delete(lfuCache.freq_Head.next.items, item)
-		delete(lfuCache.bykey, item)
+	// An expired item goes first whatever its frequency. It was not
+	// pushed out by competition, so it does not raise the age either.
+	victim := lfuCache.expiredItem()
+	if victim == nil {
+		node := lfuCache.freq_Head.next
+		victim = node.oldest
+		switch lfuCache.TieBreak {
+		case TieBreakNewest:
+			victim = node.newest
+		case TieBreakArbitrary:
+			for _, item := range node.items {
+				victim = item
+				break
+			}
+		}
+		if victim == nil {
+			return zeroValue, nil
+		}
+
+		// L never decreases, a victim keyed before L last rose must
+		// not take it back down.
+		if lfuCache.DynamicAging {
+			lfuCache.age = max(lfuCache.age, node.value)
+		}
+	}
+	lfuCache.remove(victim)
+	lfuCache.evictions++
+	return victim.key, victim.data
+
+}
+
+// TotalAccesses returns the sum of the frequencies of all resident
+// items, kept as a running count so reading it is O(1). Divided by Len
+// it gives the mean access count, a cheap measure of skew.
+func (lfuCache *LFU_Cache[T]) TotalAccesses() uint64 {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	return lfuCache.accesses
+}
+
+func (lfuCache *LFU_Cache[T]) Len() int {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	return len(lfuCache.bykey)
+}
+
+// Entries returns every item from the least to the most frequently
+// used, the least recently accessed first within a frequency.
+func (lfuCache *LFU_Cache[T]) Entries() []cachego.Entry[T, any] {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	entries := make([]cachego.Entry[T, any], 0, len(lfuCache.bykey))
+	for node := lfuCache.freq_Head.next; node != nil; node = node.next {
+		for item := node.oldest; item != nil; item = item.newer {
+			entries = append(entries, cachego.Entry[T, any]{Key: item.key, Value: item.data})
+		}
+	}
+	return entries
+}
+
+// String lists the frequency list from the least to the most frequent
+// node, e.g. "freq=1:{c}, freq=3:{a b}". Keys within a node are listed
+// from the least to the most recently accessed, so the output is stable
+// and the first key printed is the next one evicted.
+func (lfuCache *LFU_Cache[T]) String() string {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	var b strings.Builder
+	for node := lfuCache.freq_Head.next; node != nil; node = node.next {
+		if node != lfuCache.freq_Head.next {
+			b.WriteString(", ")
+		}
+		fmt.Fprintf(&b, "freq=%d:{", node.value)
+		for item := node.oldest; item != nil; item = item.newer {
+			if item != node.oldest {
+				b.WriteByte(' ')
+			}
+			fmt.Fprint(&b, item.key)
+		}
+		b.WriteByte('}')
+	}
+	return b.String()
+}
+
+func (lfuCache *LFU_Cache[T]) Stats() cachego.Stats {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      lfuCache.hits,
+		Misses:    lfuCache.misses,
+		Evictions: lfuCache.evictions,
+		Len:       len(lfuCache.bykey),
+		Cap:       lfuCache.size,
+	}
+}
 
-		if len(lfuCache.freq_Head.next.items) == 0 {
-			DeleteNode(lfuCache.freq_Head.next)
+// KeysInFreqRange returns every key whose frequency is between lo and
+// hi inclusive, least frequent first. With DynamicAging the frequency is
+// the aged one items are keyed on. Only the nodes up to hi are visited
+// and nothing is counted as an access.
+func (lfuCache *LFU_Cache[T]) KeysInFreqRange(lo, hi int) []T {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	keys := make([]T, 0)
+	for node := lfuCache.freq_Head.next; node != nil && node.value <= hi; node = node.next {
+		if node.value < lo {
+			continue
+		}
+		for item := node.oldest; item != nil; item = item.newer {
+			keys = append(keys, item.key)
 		}
-		return item, present.data
 	}
+	return keys
+}
 
-	return zeroValue, nil
+// Rank returns the position of key when every key is ordered by
+// frequency, most frequent first, with ties going to the most recently
+// accessed key. Rank 1 is the most popular key; total is the number of
+// keys in the cache.
+func (lfuCache *LFU_Cache[T]) Rank(key T) (rank, total int, ok bool) {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	item, present := lfuCache.bykey[key]
+	if !present {
+		return 0, len(lfuCache.bykey), false
+	}
 
+	total = len(lfuCache.bykey)
+	rank = 1
+	for node := item.parent.next; node != nil; node = node.next {
+		rank += node.len()
+	}
+	for other := item.newer; other != nil; other = other.newer {
+		rank++
+	}
+	return rank, total, true
+}
+
+// CheckInvariants walks the frequency list and reports the first
+// inconsistency between it and bykey: frequencies must be strictly
+// ascending from the head, links must agree in both directions, no node
+// may be empty, every item must sit in the node its parent names, each
+// node's items must be linked in access order, and the expiring heap
+// must hold exactly the items with a TTL, each at its expiryIndex.
+func (lfuCache *LFU_Cache[T]) CheckInvariants() error {
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	count, withTTL := 0, 0
+	prev := lfuCache.freq_Head
+	for node := lfuCache.freq_Head.next; node != nil; node = node.next {
+		if node.prev != prev {
+			return fmt.Errorf("frequency node %d has a broken prev link", node.value)
+		}
+		if node.value <= prev.value {
+			return fmt.Errorf("frequency node %d follows %d", node.value, prev.value)
+		}
+		if node.len() == 0 {
+			return fmt.Errorf("frequency node %d is empty", node.value)
+		}
+		if node.items != nil && len(node.items) != node.len() {
+			return fmt.Errorf("frequency node %d maps %d of its %d items", node.value, len(node.items), node.len())
+		}
+		linked := 0
+		var older *LFU_Item[T]
+		for item := node.oldest; item != nil; item = item.newer {
+			if item.older != older {
+				return fmt.Errorf("key %v in frequency node %d has a broken older link", item.key, node.value)
+			}
+			if older != nil && older.last_access > item.last_access {
+				return fmt.Errorf("key %v in frequency node %d is out of access order", item.key, node.value)
+			}
+			if node.items != nil && node.items[item.key] != item {
+				return fmt.Errorf("key %v is linked in frequency node %d but not in its items", item.key, node.value)
+			}
+			if item.parent != node {
+				return fmt.Errorf("key %v is in frequency node %d but its parent is %d", item.key, node.value, item.parent.value)
+			}
+			if lfuCache.bykey[item.key] != item {
+				return fmt.Errorf("key %v in frequency node %d is not in bykey", item.key, node.value)
+			}
+			if !item.expires.IsZero() {
+				withTTL++
+				if i := item.expiryIndex; i < 0 || i >= len(lfuCache.expiring) || lfuCache.expiring[i] != item {
+					return fmt.Errorf("key %v has a TTL but is not at its place in the expiring heap", item.key)
+				}
+			}
+			linked++
+			if linked > node.len() {
+				return fmt.Errorf("frequency node %d links more items than it holds", node.value)
+			}
+			older = item
+		}
+		if node.newest != older || linked != node.len() {
+			return fmt.Errorf("frequency node %d links %d of its %d items", node.value, linked, node.len())
+		}
+
+		count += node.len()
+		prev = node
+	}
+
+	if count != len(lfuCache.bykey) {
+		return fmt.Errorf("frequency list holds %d items but bykey holds %d", count, len(lfuCache.bykey))
+	}
+	if withTTL != len(lfuCache.expiring) {
+		return fmt.Errorf("%d items have a TTL but the expiring heap holds %d", withTTL, len(lfuCache.expiring))
+	}
+	return nil
 }
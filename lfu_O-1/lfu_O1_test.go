@@ -1,9 +1,20 @@
 package lfuo1
 
 import (
+	"fmt"
+	"reflect"
+	"runtime"
+	"sort"
+	"sync"
 	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
+	"cache_go/tagged"
 )
 
+var _ cachego.Cache[string, any] = (*LFU_Cache[string])(nil)
+
 // TestNewLfuCache tests the creation of a new LFU cache
 func TestNewLfuCache(t *testing.T) {
 	cache := NewLfuCache[string]()
@@ -277,4 +288,992 @@ func TestFrequencyNodeCreationAndDeletion(t *testing.T) {
 	if cache.freq_Head.next != nil {
 		t.Fatal("Expected all frequency nodes to be deleted")
 	}
-}
\ No newline at end of file
+}
+// TestInsertAfterMinFreqEvicted tests that inserting after the only frequency 1
+// node was evicted creates exactly one frequency 1 node in front of the list
+func TestInsertAfterMinFreqEvicted(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 2
+
+	cache.Insert("key1", "value1")
+	cache.Insert("key2", "value2")
+	cache.Access("key2")
+
+	// key1 is the only item with frequency 1, evicting it removes that node
+	if key, _ := cache.Evict(); key != "key1" {
+		t.Fatalf("Expected key1 to be evicted, got %v", key)
+	}
+	if cache.freq_Head.next.value != 2 {
+		t.Fatalf("Expected frequency 2 node after head, got %d", cache.freq_Head.next.value)
+	}
+
+	cache.Insert("key3", "value3")
+
+	ones := 0
+	prev := cache.freq_Head
+	for node := cache.freq_Head.next; node != nil; node = node.next {
+		if node.prev != prev {
+			t.Errorf("Frequency node %d has a broken prev pointer", node.value)
+		}
+		if prev != cache.freq_Head && node.value <= prev.value {
+			t.Errorf("Frequency nodes not strictly ascending: %d after %d", node.value, prev.value)
+		}
+		if node.value == 1 {
+			ones++
+		}
+		prev = node
+	}
+
+	if ones != 1 {
+		t.Errorf("Expected exactly one frequency 1 node, got %d", ones)
+	}
+	if cache.freq_Head.next.value != 1 {
+		t.Errorf("Expected frequency 1 node right after head, got %d", cache.freq_Head.next.value)
+	}
+	if cache.bykey["key3"].parent != cache.freq_Head.next {
+		t.Error("Expected key3 to live in the frequency 1 node")
+	}
+}
+
+// TestAccessN tests that AccessN jumps straight to the target frequency
+func TestAccessN(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 10
+
+	cache.Insert("key1", "value1")
+	cache.Insert("key2", "value2")
+	cache.Access("key2")
+	cache.Access("key2") // key2 at frequency 3
+
+	val := cache.AccessN("key1", 2)
+	if val != "value1" {
+		t.Errorf("Expected 'value1', got %v", val)
+	}
+	if cache.bykey["key1"].parent != cache.bykey["key2"].parent {
+		t.Error("Expected key1 to join key2 in the existing frequency 3 node")
+	}
+
+	cache.AccessN("key1", 5)
+	if cache.bykey["key1"].parent.value != 8 {
+		t.Errorf("Expected frequency 8, got %d", cache.bykey["key1"].parent.value)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDecay tests that Decay halves frequencies and merges equal buckets
+func TestDecay(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 10
+
+	cache.Insert("key1", "value1") // frequency 1
+	cache.Insert("key2", "value2")
+	cache.AccessN("key2", 3) // frequency 4
+	cache.Insert("key3", "value3")
+	cache.AccessN("key3", 4) // frequency 5
+
+	cache.Decay()
+
+	expected := map[string]int{"key1": 1, "key2": 2, "key3": 2}
+	for key, freq := range expected {
+		if got := cache.bykey[key].parent.value; got != freq {
+			t.Errorf("Expected %s at frequency %d after Decay, got %d", key, freq, got)
+		}
+	}
+	if cache.bykey["key2"].parent != cache.bykey["key3"].parent {
+		t.Error("Expected key2 and key3 to share one frequency node after Decay")
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestResetFrequencies tests that every item drops back to frequency 1
+func TestResetFrequencies(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 10
+
+	cache.Insert("key1", "value1")
+	cache.Insert("key2", "value2")
+	cache.AccessN("key2", 6)
+
+	cache.ResetFrequencies()
+
+	if cache.freq_Head.next.value != 1 || cache.freq_Head.next.next != nil {
+		t.Fatal("Expected a single frequency 1 node after ResetFrequencies")
+	}
+	if cache.freq_Head.next.len() != 2 {
+		t.Errorf("Expected 2 items at frequency 1, got %d", cache.freq_Head.next.len())
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestCompact tests that Compact renumbers gapped frequencies to consecutive
+// ones and keeps the eviction order
+func TestCompact(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	var changes []string
+	cache.OnFreqChange = func(key string, oldFreq, newFreq int) {
+		changes = append(changes, fmt.Sprintf("%s:%d->%d", key, oldFreq, newFreq))
+	}
+
+	cache.Insert("a", "value-a") // frequency 1
+	cache.Insert("b", "value-b")
+	cache.AccessN("b", 4) // frequency 5
+	cache.Insert("c", "value-c")
+	cache.AccessN("c", 99) // frequency 100
+	cache.Insert("d", "value-d")
+	cache.AccessN("d", 4) // frequency 5, after b
+	changes = nil
+
+	cache.Compact()
+
+	if got := cache.String(); got != "freq=1:{a}, freq=2:{b d}, freq=3:{c}" {
+		t.Errorf("Expected consecutive frequencies, got %q", got)
+	}
+	if !reflect.DeepEqual(changes, []string{"b:5->2", "d:5->2", "c:100->3"}) {
+		t.Errorf("Unexpected frequency changes %v", changes)
+	}
+	if total := cache.TotalAccesses(); total != 1+2+2+3 {
+		t.Errorf("Expected the counts to follow the nodes, got a total of %d", total)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, want := range []string{"a", "b", "d"} {
+		if key, _ := cache.Evict(); key != want {
+			t.Errorf("Expected %s to be evicted, got %s", want, key)
+		}
+	}
+
+	// Accesses carry on from the new frequencies.
+	cache.Access("c")
+	if freq := cache.bykey["c"].parent.value; freq != 4 {
+		t.Errorf("Expected c at frequency 4, got %d", freq)
+	}
+}
+
+// TestCompactDynamicAging tests that Compact resets the age of an LFU-DA cache
+func TestCompactDynamicAging(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.DynamicAging = true
+	cache.Insert("hot", "value")
+	cache.AccessN("hot", 4) // key 5
+	cache.Insert("b", "value")
+	cache.Insert("c", "value") // evicts b, c at 1+L = 2
+
+	cache.Compact()
+
+	if got := cache.String(); got != "freq=1:{c}, freq=2:{hot}" || cache.Age() != 0 {
+		t.Errorf("Expected c at 1 and hot at 2 with L 0, got %q and L %d", got, cache.Age())
+	}
+	cache.Insert("d", "value") // evicts c, L becomes 1
+	if freq := cache.bykey["d"].parent.value; freq != 2 {
+		t.Errorf("Expected d keyed at 1+L = 2, got %d", freq)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestConcurrentDecayAndAccessN tests that Decay and AccessN can run at the
+// same time without corrupting the frequency list. Run with -race.
+func TestConcurrentDecayAndAccessN(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 50
+	for i := 0; i < 50; i++ {
+		cache.Insert(fmt.Sprintf("key%d", i), i)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				cache.AccessN(fmt.Sprintf("key%d", (id*7+j)%50), j%5+1)
+			}
+		}(g)
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for j := 0; j < 100; j++ {
+			cache.Decay()
+			if j%10 == 0 {
+				cache.ResetFrequencies()
+			}
+		}
+	}()
+
+	wg.Wait()
+
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+	if len(cache.bykey) != 50 {
+		t.Errorf("Expected 50 items, got %d", len(cache.bykey))
+	}
+}
+
+// TestStats tests the hit, miss and eviction counters
+func TestStats(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 2
+
+	cache.Insert("key1", "value1")
+	cache.Insert("key2", "value2")
+	cache.Access("key2")
+	cache.AccessN("key2", 3)
+
+	func() {
+		defer func() { recover() }()
+		cache.Access("missing")
+	}()
+
+	cache.Insert("key3", "value3") // evicts key1
+
+	stats := cache.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 eviction, got %+v", stats)
+	}
+	if stats.Len != 2 || stats.Cap != 2 {
+		t.Errorf("Expected Len 2 and Cap 2, got %+v", stats)
+	}
+}
+
+// TestRank tests ranking by frequency with ties broken by recency
+func TestRank(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 10
+
+	cache.Insert("key1", "value1")
+	cache.Insert("key2", "value2")
+	cache.Insert("key3", "value3")
+	cache.Insert("key4", "value4")
+	cache.AccessN("key3", 4) // frequency 5
+	cache.Access("key1")     // frequency 2
+	cache.Access("key2")     // frequency 2, more recent than key1
+
+	expected := map[string]int{"key3": 1, "key2": 2, "key1": 3, "key4": 4}
+	for key, want := range expected {
+		rank, total, ok := cache.Rank(key)
+		if !ok || total != 4 || rank != want {
+			t.Errorf("Expected %s to rank %d of 4, got %d of %d (ok=%v)", key, want, rank, total, ok)
+		}
+	}
+
+	if _, total, ok := cache.Rank("missing"); ok || total != 4 {
+		t.Errorf("Expected a missing key to report ok=false and total 4, got ok=%v total=%d", ok, total)
+	}
+}
+
+// TestPeek tests that Peek returns the value without changing frequency
+func TestPeek(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 10
+	cache.Insert("key1", "value1")
+	cache.Access("key1")
+
+	val, ok := cache.Peek("key1")
+	if !ok || val != "value1" {
+		t.Errorf("Expected ('value1', true), got (%v, %v)", val, ok)
+	}
+	if freq := cache.bykey["key1"].parent.value; freq != 2 {
+		t.Errorf("Expected frequency to stay 2 after Peek, got %d", freq)
+	}
+
+	val, ok = cache.Peek("missing")
+	if ok || val != nil {
+		t.Errorf("Expected (nil, false) for a missing key, got (%v, %v)", val, ok)
+	}
+}
+
+// TestAccessIfPresent tests that a present key is bumped and a missing one changes nothing
+func TestAccessIfPresent(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Insert("key1", "value1")
+
+	if !cache.AccessIfPresent("key1") {
+		t.Error("Expected key1 to be reported present")
+	}
+	if freq := cache.bykey["key1"].parent.value; freq != 2 {
+		t.Errorf("Expected frequency 2 after AccessIfPresent, got %d", freq)
+	}
+
+	before := cache.Stats()
+	if cache.AccessIfPresent("missing") {
+		t.Error("Expected missing to be reported absent")
+	}
+	if cache.Stats() != before || cache.Len() != 1 {
+		t.Errorf("Expected no side effects for a missing key, got %+v", cache.Stats())
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestGetSetDelete tests the cachego.Cache methods
+func TestGetSetDelete(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Set("a", "value-a")
+	cache.Set("a", "value-a2") // an access, not a hit
+	cache.Set("b", "value-b")
+
+	if value, ok := cache.Get("a"); !ok || value != "value-a2" {
+		t.Errorf("Expected (value-a2, true), got (%v, %v)", value, ok)
+	}
+	if _, ok := cache.Get("missing"); ok {
+		t.Error("Expected a miss for a missing key")
+	}
+	if got := cache.String(); got != "freq=1:{b}, freq=3:{a}" {
+		t.Errorf("Unexpected frequency list %q", got)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Misses != 1 {
+		t.Errorf("Expected 1 hit and 1 miss, got %+v", stats)
+	}
+
+	if !cache.Delete("a") || cache.Delete("a") {
+		t.Error("Expected Delete to report a only while it is present")
+	}
+	if got := cache.String(); got != "freq=1:{b}" {
+		t.Errorf("Expected the emptied frequency node to go, got %q", got)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTaggedLFU tests that the tagged wrapper evicts tagged items whatever their frequency
+func TestTaggedLFU(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	c := tagged.New[string, any](cache)
+	c.SetWithTags("hot", "value", []string{"users"})
+	cache.AccessN("hot", 10)
+	c.SetWithTags("cold", "value", []string{"users"})
+	c.SetWithTags("other", "value", []string{"orders"})
+
+	if n := c.EvictByTag("users"); n != 2 {
+		t.Errorf("Expected 2 items evicted, got %d", n)
+	}
+	if got := cache.String(); got != "freq=1:{other}" {
+		t.Errorf("Expected only other left, got %q", got)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestAccessMinAware tests that only an access emptying the minimum frequency node reports it raised
+func TestAccessMinAware(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](3)
+	cache.Insert("a", "value-a")
+	cache.Insert("b", "value-b")
+
+	steps := []struct {
+		key     string
+		changed bool
+	}{
+		{"a", false}, // b is still at 1
+		{"b", true},  // the minimum rises to 2
+		{"a", false}, // a leaves b alone at 2
+		{"b", true},  // b joins a at 3
+	}
+	for _, step := range steps {
+		value, changed, ok := cache.AccessMinAware(step.key)
+		if !ok || value != "value-"+step.key || changed != step.changed {
+			t.Errorf("Access of %s: expected (value-%s, %v, true), got (%v, %v, %v)", step.key, step.key, step.changed, value, changed, ok)
+		}
+	}
+	if got := cache.String(); got != "freq=3:{a b}" {
+		t.Errorf("Unexpected frequency list %q", got)
+	}
+
+	if _, changed, ok := cache.AccessMinAware("missing"); ok || changed {
+		t.Error("Expected a missing key to be reported absent")
+	}
+	if stats := cache.Stats(); stats.Hits != 4 || stats.Misses != 1 {
+		t.Errorf("Expected 4 hits and 1 miss, got %+v", stats)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestDynamicAging tests that LFU-DA raises L on eviction and keys new
+// items above it, so a key that was hot early is eventually evicted
+func TestDynamicAging(t *testing.T) {
+	cache := NewLfuCache[string]()
+	cache.size = 2
+	cache.DynamicAging = true
+
+	cache.Insert("hot", "value")
+	cache.AccessN("hot", 4) // key 5
+	cache.Insert("b", "value")
+	cache.Insert("c", "value") // evicts b at key 1
+
+	if age := cache.Age(); age != 1 {
+		t.Errorf("Expected L to be 1 after evicting b, got %d", age)
+	}
+	if freq := cache.bykey["c"].parent.value; freq != 2 {
+		t.Errorf("Expected c to be keyed at 1+L = 2, got %d", freq)
+	}
+
+	cache.Insert("d", "value") // evicts c at key 2, d at 3
+	cache.Access("d")          // count 2 + L 2 = 4
+	if freq := cache.bykey["d"].parent.value; freq != 4 {
+		t.Errorf("Expected d to be keyed at 2+L = 4, got %d", freq)
+	}
+
+	for _, key := range []string{"e", "f", "g"} {
+		cache.Insert(key, "value")
+		if err := cache.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := cache.Peek("hot"); ok {
+		t.Error("Expected the stale hot key to have been aged out")
+	}
+
+	plain := NewLfuCache[string]()
+	plain.size = 2
+	plain.Insert("hot", "value")
+	plain.AccessN("hot", 4)
+	for _, key := range []string{"b", "c", "d", "e", "f", "g"} {
+		plain.Insert(key, "value")
+	}
+	if _, ok := plain.Peek("hot"); !ok {
+		t.Error("Expected plain LFU to keep the hot key")
+	}
+	if age := plain.Age(); age != 0 {
+		t.Errorf("Expected L to stay 0 without DynamicAging, got %d", age)
+	}
+}
+
+// TestDynamicAgingRebucket tests that Decay and ResetFrequencies key
+// items on their new count plus L and that L never goes down
+func TestDynamicAgingRebucket(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.DynamicAging = true
+	cache.age = 5
+
+	cache.Insert("a", "value")
+	cache.AccessN("a", 3)      // count 4, key 9
+	cache.Insert("b", "value") // count 1, key 6
+
+	cache.ResetFrequencies()
+	for _, key := range []string{"a", "b"} {
+		if item := cache.bykey[key]; item.count != 1 || item.parent.value != 6 {
+			t.Errorf("Expected %s at count 1 and key 6, got %d and %d", key, item.count, item.parent.value)
+		}
+	}
+	cache.Insert("c", "value") // evicts a, the older of the two
+	if age := cache.Age(); age != 6 {
+		t.Errorf("Expected L to rise to 6, got %d", age)
+	}
+	if _, ok := cache.Peek("a"); ok {
+		t.Error("Expected a to be evicted as the least recently used at key 6")
+	}
+
+	cache.AccessN("c", 5) // count 6, key 12
+	cache.Decay()
+	if item := cache.bykey["c"]; item.count != 3 || item.parent.value != 9 {
+		t.Errorf("Expected c at count 3 and key 9, got %d and %d", item.count, item.parent.value)
+	}
+	if item := cache.bykey["b"]; item.count != 1 || item.parent.value != 7 {
+		t.Errorf("Expected b at count 1 and key 7, got %d and %d", item.count, item.parent.value)
+	}
+	cache.Insert("d", "value") // evicts b at key 7
+	if age := cache.Age(); age != 7 {
+		t.Errorf("Expected L to rise to 7, got %d", age)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A victim keyed before L last rose does not take it back down.
+	cache.bykey["d"].parent.value = 2
+	cache.Insert("e", "value")
+	if age := cache.Age(); age != 7 {
+		t.Errorf("Expected L to stay 7, got %d", age)
+	}
+}
+
+// TestZeroCapacity tests that a cache without capacity is rejected at
+// construction and that Insert on one panics without changing anything
+func TestZeroCapacity(t *testing.T) {
+	for _, size := range []int{0, -1} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected NewLfuCacheWithSize(%d) to panic", size)
+				}
+			}()
+			NewLfuCacheWithSize[string](size)
+		}()
+	}
+
+	cache := NewLfuCache[string]()
+	func() {
+		defer func() {
+			if r := recover(); r != "the cache has no capacity" {
+				t.Errorf("Expected Insert on a cache without capacity to panic, got %v", r)
+			}
+		}()
+		cache.Insert("key1", "value1")
+	}()
+
+	if cache.Len() != 0 {
+		t.Errorf("Expected Len 0, got %d", cache.Len())
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+
+	sized := NewLfuCacheWithSize[string](1)
+	sized.Insert("key1", "value1")
+	sized.Insert("key2", "value2")
+	if sized.Len() != 1 {
+		t.Errorf("Expected Len 1, got %d", sized.Len())
+	}
+	if _, ok := sized.Peek("key2"); !ok {
+		t.Error("Expected key2 to replace key1")
+	}
+}
+
+// TestKeysInFreqRange tests that only keys within the band are returned and nothing is bumped
+func TestKeysInFreqRange(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](10)
+	for key, n := range map[string]int{"a": 0, "b": 1, "c": 1, "d": 3, "e": 5} {
+		cache.Insert(key, "value")
+		if n > 0 {
+			cache.AccessN(key, n)
+		}
+	}
+
+	keys := cache.KeysInFreqRange(1, 2)
+	if len(keys) != 3 || keys[0] != "a" {
+		t.Errorf("Expected a first and then b and c, got %v", keys)
+	}
+	found := map[string]bool{}
+	for _, key := range keys {
+		found[key] = true
+	}
+	if !found["b"] || !found["c"] {
+		t.Errorf("Expected b and c in the band, got %v", keys)
+	}
+
+	if keys := cache.KeysInFreqRange(3, 4); len(keys) != 1 || keys[0] != "d" {
+		t.Errorf("Expected only d, got %v", keys)
+	}
+	if keys := cache.KeysInFreqRange(7, 10); len(keys) != 0 {
+		t.Errorf("Expected no keys, got %v", keys)
+	}
+	if keys := cache.KeysInFreqRange(2, 1); len(keys) != 0 {
+		t.Errorf("Expected an empty band for lo > hi, got %v", keys)
+	}
+
+	if freq := cache.bykey["a"].parent.value; freq != 1 {
+		t.Errorf("Expected KeysInFreqRange not to bump frequencies, got %d", freq)
+	}
+}
+
+// TestTotalAccesses tests that the running total follows inserts, accesses, evictions and decay
+func TestTotalAccesses(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Insert("a", "value")
+	cache.AccessN("a", 5) // a: 6
+	cache.Insert("b", "value")
+	cache.Access("b") // b: 2
+
+	if total := cache.TotalAccesses(); total != 8 {
+		t.Errorf("Expected 8 accesses, got %d", total)
+	}
+
+	cache.Insert("c", "value") // evicts b
+	if total := cache.TotalAccesses(); total != 7 {
+		t.Errorf("Expected 7 accesses after evicting b, got %d", total)
+	}
+
+	cache.Decay() // a: 3, c: 1
+	if total := cache.TotalAccesses(); total != 4 {
+		t.Errorf("Expected 4 accesses after decay, got %d", total)
+	}
+
+	sum := 0
+	for _, item := range cache.bykey {
+		sum += item.parent.value
+	}
+	if uint64(sum) != cache.TotalAccesses() {
+		t.Errorf("Expected the total to match the frequencies, %d vs %d", sum, cache.TotalAccesses())
+	}
+}
+
+// freqOf maps every key to the frequency node it sits in
+func freqOf[T comparable](cache *LFU_Cache[T]) map[T]int {
+	freqs := make(map[T]int)
+	for key, item := range cache.bykey {
+		freqs[key] = item.parent.value
+	}
+	return freqs
+}
+
+// TestInsertMany tests that a bulk load matches inserting and accessing each key
+func TestInsertMany(t *testing.T) {
+	entries := []Entry[string]{
+		{Key: "a", Value: "value-a", Frequency: 3},
+		{Key: "b", Value: "value-b", Frequency: 1},
+		{Key: "c", Value: "value-c", Frequency: 7},
+		{Key: "d", Value: "value-d", Frequency: 2}, // evicts b
+		{Key: "e", Value: "value-e", Frequency: 3}, // evicts d
+	}
+
+	bulk := NewLfuCacheWithSize[string](3)
+	bulk.InsertMany(entries)
+
+	oneByOne := NewLfuCacheWithSize[string](3)
+	for _, entry := range entries {
+		oneByOne.Insert(entry.Key, entry.Value)
+		if entry.Frequency > 1 {
+			oneByOne.AccessN(entry.Key, entry.Frequency-1)
+		}
+	}
+
+	if got, want := fmt.Sprint(freqOf(bulk)), fmt.Sprint(freqOf(oneByOne)); got != want {
+		t.Errorf("Expected frequencies %s, got %s", want, got)
+	}
+	if bulk.TotalAccesses() != oneByOne.TotalAccesses() {
+		t.Errorf("Expected %d total accesses, got %d", oneByOne.TotalAccesses(), bulk.TotalAccesses())
+	}
+	if value, ok := bulk.Peek("c"); !ok || value != "value-c" {
+		t.Errorf("Expected ('value-c', true), got (%v, %v)", value, ok)
+	}
+	if stats := bulk.Stats(); stats.Hits != 0 || stats.Evictions != 2 {
+		t.Errorf("Expected no hits and 2 evictions from the load, got %+v", stats)
+	}
+	if err := bulk.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("Expected a frequency of 0 to panic")
+		}
+		if bulk.Len() != 3 {
+			t.Error("Expected a rejected load to leave the cache untouched")
+		}
+	}()
+	bulk.InsertMany([]Entry[string]{{Key: "f", Frequency: 1}, {Key: "g", Frequency: 0}})
+}
+
+// TestTieBreak tests which of three keys at the same frequency each policy evicts
+func TestTieBreak(t *testing.T) {
+	for tieBreak, want := range map[TieBreak]string{TieBreakOldest: "a", TieBreakNewest: "c"} {
+		cache := NewLfuCacheWithSize[string](3)
+		cache.TieBreak = tieBreak
+		cache.Insert("a", "value")
+		cache.Insert("b", "value")
+		cache.Insert("c", "value")
+
+		if key, _ := cache.Evict(); key != want {
+			t.Errorf("TieBreak %d: expected %s to be evicted, got %s", tieBreak, want, key)
+		}
+		if err := cache.CheckInvariants(); err != nil {
+			t.Error(err)
+		}
+	}
+
+	cache := NewLfuCacheWithSize[string](3)
+	cache.TieBreak = TieBreakArbitrary
+	cache.Insert("a", "value")
+	cache.Insert("b", "value")
+	cache.Insert("c", "value")
+	if key, _ := cache.Evict(); key != "a" && key != "b" && key != "c" {
+		t.Errorf("TieBreakArbitrary: expected one of the three keys, got %s", key)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestTieBreakAfterAccessAndDecay tests that access order survives bumps and bucket merges
+func TestTieBreakAfterAccessAndDecay(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	cache.Insert("a", "value")
+	cache.Insert("b", "value")
+	cache.Insert("c", "value")
+	cache.Access("a") // a: 2, newest
+	cache.Access("b") // b: 2
+	cache.Insert("d", "value")
+
+	cache.ResetFrequencies() // every key at 1, in access order c, a, b, d
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	var evicted []string
+	for i := 0; i < 4; i++ {
+		key, _ := cache.Evict()
+		evicted = append(evicted, key)
+	}
+	if fmt.Sprint(evicted) != "[c a b d]" {
+		t.Errorf("Expected eviction order [c a b d], got %v", evicted)
+	}
+}
+
+// TestEntries tests that Entries lists items by frequency and then by access
+func TestEntries(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	cache.Insert("a", "value-a")
+	cache.Insert("b", "value-b")
+	cache.Insert("c", "value-c")
+	cache.AccessN("a", 2)
+	cache.Access("c")
+
+	var keys []string
+	for _, entry := range cache.Entries() {
+		keys = append(keys, entry.Key)
+		if entry.Value != "value-"+entry.Key {
+			t.Errorf("Expected the value of %s, got %v", entry.Key, entry.Value)
+		}
+	}
+	if fmt.Sprint(keys) != "[b c a]" {
+		t.Errorf("Expected [b c a], got %v", keys)
+	}
+}
+
+// TestOnFreqChange tests that every frequency change is reported once the cache is consistent
+func TestOnFreqChange(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	var changes []string
+	cache.OnFreqChange = func(key string, oldFreq, newFreq int) {
+		if err := cache.CheckInvariants(); err != nil {
+			t.Errorf("Expected a consistent cache in the callback: %v", err)
+		}
+		if item := cache.bykey[key]; item.parent.value != newFreq {
+			t.Errorf("Expected %s to sit at frequency %d, got %d", key, newFreq, item.parent.value)
+		}
+		changes = append(changes, fmt.Sprintf("%s:%d->%d", key, oldFreq, newFreq))
+	}
+
+	cache.Insert("a", 1)
+	cache.Insert("b", 2)
+	cache.Access("a")
+	cache.AccessN("b", 4)
+	if fmt.Sprint(changes) != "[a:1->2 b:1->5]" {
+		t.Errorf("Expected the accesses to be reported, got %v", changes)
+	}
+
+	changes = nil
+	cache.Decay()
+	if fmt.Sprint(changes) != "[a:2->1 b:5->2]" {
+		t.Errorf("Expected Decay to report both keys, got %v", changes)
+	}
+
+	changes = nil
+	cache.Access("a")
+	cache.ResetFrequencies()
+	sort.Strings(changes[1:]) // a and b share a bucket, in no set order
+	if fmt.Sprint(changes) != "[a:1->2 a:2->1 b:2->1]" {
+		t.Errorf("Expected ResetFrequencies to report only changed keys, got %v", changes)
+	}
+
+	changes = nil
+	cache.ResetFrequencies()
+	if len(changes) != 0 {
+		t.Errorf("Expected no calls when nothing changed, got %v", changes)
+	}
+}
+
+// TestMerge tests that frequencies are added up and the capacity is kept
+func TestMerge(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](3)
+	cache.Insert("a", "value-a")
+	cache.Insert("b", "value-b")
+	cache.AccessN("a", 2) // a:3 b:1
+
+	other := NewLfuCacheWithSize[string](3)
+	other.Insert("b", "other-b")
+	other.Insert("c", "value-c")
+	other.Insert("d", "value-d")
+	other.AccessN("b", 4) // b:5
+	other.AccessN("c", 1) // c:2 d:1
+
+	var changes []string
+	cache.OnFreqChange = func(key string, oldFreq, newFreq int) {
+		changes = append(changes, fmt.Sprintf("%s:%d->%d", key, oldFreq, newFreq))
+	}
+	cache.Merge(other)
+
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]int{"a": 3, "b": 6, "c": 2}
+	if cache.Len() != len(want) {
+		t.Errorf("Expected %d keys after the merge, got %d", len(want), cache.Len())
+	}
+	freqs := freqOf(cache)
+	for key, freq := range want {
+		if got := freqs[key]; got != freq {
+			t.Errorf("Expected %s at frequency %d, got %d", key, freq, got)
+		}
+	}
+	if value, _ := cache.Peek("b"); value != "value-b" {
+		t.Errorf("Expected a merged key to keep its own value, got %v", value)
+	}
+	if cache.TotalAccesses() != 11 {
+		t.Errorf("Expected 11 accesses, got %d", cache.TotalAccesses())
+	}
+	if fmt.Sprint(changes) != "[b:1->6]" {
+		t.Errorf("Expected a frequency change for b only, got %v", changes)
+	}
+	if stats := cache.Stats(); stats.Hits != 1 || stats.Evictions != 1 {
+		t.Errorf("Expected the merge to count one eviction and no hits, got %+v", stats)
+	}
+
+	if other.Len() != 3 || freqOf(other)["b"] != 5 {
+		t.Error("Expected the merged cache to be left alone")
+	}
+}
+
+// benchmarkMemoryPerEntry reports the heap bytes a cache of n keys uses
+// per key, with every key accessed freq(i) times
+func benchmarkMemoryPerEntry(b *testing.B, n int, freq func(i int) int) {
+	var before, after runtime.MemStats
+	var bytes uint64
+	for i := 0; i < b.N; i++ {
+		runtime.GC()
+		runtime.ReadMemStats(&before)
+
+		cache := NewLfuCacheWithSize[int](n)
+		for key := 0; key < n; key++ {
+			cache.Insert(key, nil)
+			if extra := freq(key) - 1; extra > 0 {
+				cache.AccessN(key, extra)
+			}
+		}
+
+		runtime.GC()
+		runtime.ReadMemStats(&after)
+		bytes += after.HeapAlloc - before.HeapAlloc
+		runtime.KeepAlive(cache)
+	}
+	b.ReportMetric(float64(bytes)/float64(b.N)/float64(n), "B/entry")
+}
+
+// BenchmarkLFU_MemoryDistinctFrequencies measures a cache where every key has its own bucket
+func BenchmarkLFU_MemoryDistinctFrequencies(b *testing.B) {
+	benchmarkMemoryPerEntry(b, 10000, func(i int) int { return i + 1 })
+}
+
+// BenchmarkLFU_MemorySharedFrequency measures a cache where every key shares one bucket
+func BenchmarkLFU_MemorySharedFrequency(b *testing.B) {
+	benchmarkMemoryPerEntry(b, 10000, func(int) int { return 1 })
+}
+
+// TestAccessReusesFreqNodes tests that stepping an item up from a node of
+// its own reuses the node it leaves instead of allocating
+func TestAccessReusesFreqNodes(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Insert("a", "value-a")
+	cache.Insert("b", "value-b")
+	cache.Access("a") // a and b leapfrog, each alone in its node
+
+	allocs := testing.AllocsPerRun(100, func() {
+		cache.AccessN("b", 2)
+		cache.AccessN("a", 2)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations per bump, got %v", allocs)
+	}
+	if cache.numFreeNodes > maxFreeNodes {
+		t.Errorf("Expected at most %d free nodes, got %d", maxFreeNodes, cache.numFreeNodes)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Decay merges every node into one, releasing more nodes than the
+	// free list keeps.
+	big := NewLfuCacheWithSize[int](2 * maxFreeNodes)
+	for i := 0; i < 2*maxFreeNodes; i++ {
+		big.Insert(i, i)
+		big.AccessN(i, i+1)
+	}
+	big.ResetFrequencies()
+	if big.numFreeNodes != maxFreeNodes {
+		t.Errorf("Expected the free list to stop at %d nodes, got %d", maxFreeNodes, big.numFreeNodes)
+	}
+	if err := big.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkLFU_AlternatingBumps measures two keys taking turns stepping
+// over each other, each one leaving a node behind and needing a new one
+func BenchmarkLFU_AlternatingBumps(b *testing.B) {
+	cache := NewLfuCacheWithSize[string](2)
+	cache.Insert("a", "value-a")
+	cache.Insert("b", "value-b")
+	cache.Access("a")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if i%2 == 0 {
+			cache.AccessN("b", 2)
+		} else {
+			cache.AccessN("a", 2)
+		}
+	}
+}
+
+// TestString tests that String lists the frequency list in order
+func TestString(t *testing.T) {
+	cache := NewLfuCacheWithSize[string](4)
+	if cache.String() != "" {
+		t.Errorf("Expected an empty dump, got %q", cache.String())
+	}
+
+	cache.Insert("a", 1)
+	cache.Insert("b", 2)
+	cache.Insert("c", 3)
+	cache.AccessN("b", 2)
+	cache.AccessN("a", 2)
+
+	var _ fmt.Stringer = cache
+	if got := fmt.Sprint(cache); got != "freq=1:{c}, freq=3:{b a}" {
+		t.Errorf("Unexpected dump %q", got)
+	}
+}
+
+// FuzzLFU tests that no stream of operations leaves the frequency list inconsistent, with and without aging
+func FuzzLFU(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		for _, aging := range []bool{false, true} {
+			cache := NewLfuCacheWithSize[int](4)
+			cache.DynamicAging = aging
+
+			cachetest.Run(t, data, cachetest.Policy{
+				Get: func(key int) { cache.AccessIfPresent(key) },
+				Set: func(key, value int) {
+					if !cache.AccessIfPresent(key) {
+						cache.Insert(key, value)
+					}
+				},
+				Delete: func(key int) { cache.Delete(key) },
+				Evict: func() {
+					if cache.Len() > 0 {
+						cache.Evict()
+					}
+				},
+				CheckInvariants: cache.CheckInvariants,
+			})
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package lfuo1
+
+import (
+	"container/heap"
+	"time"
+)
+
+// InsertWithTTL is Insert for an item that expires ttl from now. Once
+// expired the item is no longer served: Access and AccessN treat it as
+// a missing key and Peek does not return it. It is removed lazily, by
+// the first access that finds it expired or by an eviction, which
+// always takes an expired item before any live one regardless of
+// frequency.
+func (lfuCache *LFU_Cache[T]) InsertWithTTL(key T, value any, ttl time.Duration) {
+	if ttl <= 0 {
+		panic("ttl has to be greater than 0")
+	}
+
+	lfuCache.Mu.Lock()
+	defer lfuCache.Mu.Unlock()
+
+	lfuCache.insert(key, value, 1)
+	item := lfuCache.bykey[key]
+	item.expires = lfuCache.clockNow().Add(ttl)
+	heap.Push(&lfuCache.expiring, item)
+}
+
+func (lfuCache *LFU_Cache[T]) clockNow() time.Time {
+	if lfuCache.now == nil {
+		return time.Now()
+	}
+	return lfuCache.now()
+}
+
+// expired reports whether item had a TTL that has run out.
+func (lfuCache *LFU_Cache[T]) expired(item *LFU_Item[T]) bool {
+	return !item.expires.IsZero() && !lfuCache.clockNow().Before(item.expires)
+}
+
+// expiredItem returns the item that expired first, or nil when no item
+// has expired.
+func (lfuCache *LFU_Cache[T]) expiredItem() *LFU_Item[T] {
+	if len(lfuCache.expiring) == 0 || !lfuCache.expired(lfuCache.expiring[0]) {
+		return nil
+	}
+	return lfuCache.expiring[0]
+}
+
+// remove takes item out of the frequency list, bykey and the expiring
+// heap, deleting its frequency node once empty.
+func (lfuCache *LFU_Cache[T]) remove(item *LFU_Item[T]) {
+	node := item.parent
+	node.unlink(item.key, item)
+	delete(lfuCache.bykey, item.key)
+	lfuCache.accesses -= uint64(item.count)
+	if node.len() == 0 {
+		lfuCache.releaseNode(node)
+	}
+	if !item.expires.IsZero() {
+		heap.Remove(&lfuCache.expiring, item.expiryIndex)
+	}
+}
+
+// expiryHeap is a min-heap of items by expiry that keeps every item's
+// expiryIndex up to date, so any item can be removed from it.
+type expiryHeap[T comparable] []*LFU_Item[T]
+
+func (h expiryHeap[T]) Len() int           { return len(h) }
+func (h expiryHeap[T]) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+
+func (h expiryHeap[T]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].expiryIndex = i
+	h[j].expiryIndex = j
+}
+
+func (h *expiryHeap[T]) Push(x any) {
+	item := x.(*LFU_Item[T])
+	item.expiryIndex = len(*h)
+	*h = append(*h, item)
+}
+
+func (h *expiryHeap[T]) Pop() any {
+	old := *h
+	item := old[len(old)-1]
+	old[len(old)-1] = nil
+	item.expiryIndex = -1
+	*h = old[:len(old)-1]
+	return item
+}
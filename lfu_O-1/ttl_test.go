@@ -0,0 +1,114 @@
+package lfuo1
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock a test moves by hand
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTTLCache(size int) (*LFU_Cache[string], *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1000, 0)}
+	cache := NewLfuCacheWithSize[string](size)
+	cache.now = clock.now
+	return cache, clock
+}
+
+// TestInsertWithTTL_EvictsExpiredFirst tests that an expired hot item is
+// evicted before a fresh cold one
+func TestInsertWithTTL_EvictsExpiredFirst(t *testing.T) {
+	cache, clock := newTTLCache(2)
+	cache.InsertWithTTL("hot", "value-hot", time.Minute)
+	cache.AccessN("hot", 10)
+	cache.Insert("cold", "value-cold")
+
+	clock.t = clock.t.Add(2 * time.Minute)
+	cache.Insert("new", "value-new")
+
+	if _, ok := cache.Peek("hot"); ok {
+		t.Error("Expected the expired hot item to be evicted")
+	}
+	if _, ok := cache.Peek("cold"); !ok {
+		t.Error("Expected the fresh cold item to stay")
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInsertWithTTL_AccessExpired tests that accessing an expired item is
+// a miss that removes it
+func TestInsertWithTTL_AccessExpired(t *testing.T) {
+	cache, clock := newTTLCache(2)
+	cache.InsertWithTTL("a", "value-a", time.Second)
+	cache.InsertWithTTL("b", "value-b", time.Second)
+
+	if cache.Access("a") != "value-a" {
+		t.Error("Expected a to be served before it expires")
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if _, ok := cache.Peek("a"); ok {
+		t.Error("Expected Peek not to return an expired item")
+	}
+	if cache.AccessIfPresent("a") {
+		t.Error("Expected AccessIfPresent to report an expired item absent")
+	}
+	if cache.Len() != 1 {
+		t.Errorf("Expected a to be removed, %d items left", cache.Len())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Expected Access on an expired item to panic like a missing key")
+			}
+		}()
+		cache.Access("b")
+	}()
+	if stats := cache.Stats(); stats.Len != 0 || stats.Misses != 1 || stats.Evictions != 0 {
+		t.Errorf("Expected b removed as a miss, got %+v", stats)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestInsertWithTTL_Heap tests that the expiring heap follows items
+// through evictions in any order
+func TestInsertWithTTL_Heap(t *testing.T) {
+	cache, clock := newTTLCache(4)
+	for i, key := range []string{"a", "b", "c", "d"} {
+		cache.InsertWithTTL(key, key, time.Duration(4-i)*time.Second)
+	}
+
+	// d expires first and is evicted first, then c.
+	clock.t = clock.t.Add(2 * time.Second)
+	for _, want := range []string{"d", "c"} {
+		if key, _ := cache.Evict(); key != want {
+			t.Errorf("Expected %s to be evicted, got %s", want, key)
+		}
+		if err := cache.CheckInvariants(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing else has expired, b is the least recently used.
+	cache.Access("a")
+	if key, _ := cache.Evict(); key != "b" {
+		t.Errorf("Expected b to be evicted by frequency, got %s", key)
+	}
+	if err := cache.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a non-positive ttl to panic")
+		}
+	}()
+	cache.InsertWithTTL("e", "e", 0)
+}
@@ -0,0 +1,298 @@
+package lfuheap
+
+import (
+	"container/heap"
+	"fmt"
+	"sort"
+	"sync"
+
+	cachego "cache_go"
+)
+
+// item is a heap element. index is its position in the heap so that a
+// single item can be re-sifted after its frequency changes.
+type item[K comparable, V any] struct {
+	key       K
+	value     V
+	frequency int
+	sequence  uint64
+	index     int
+}
+
+// minHeap orders items by frequency and, within the same frequency, by
+// the sequence number of their last access, so the root is always the
+// least frequently and, among those, least recently used item.
+type minHeap[K comparable, V any] []*item[K, V]
+
+func (h minHeap[K, V]) Len() int { return len(h) }
+
+func (h minHeap[K, V]) Less(i, j int) bool {
+	return before(h[i], h[j])
+}
+
+// before reports whether a is evicted before b: it is less frequently
+// used or, as frequently, less recently used.
+func before[K comparable, V any](a, b *item[K, V]) bool {
+	if a.frequency != b.frequency {
+		return a.frequency < b.frequency
+	}
+	return a.sequence < b.sequence
+}
+
+func (h minHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *minHeap[K, V]) Push(x any) {
+	it := x.(*item[K, V])
+	it.index = len(*h)
+	*h = append(*h, it)
+}
+
+func (h *minHeap[K, V]) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	it.index = -1
+	return it
+}
+
+// LFUHeap is an LFU cache backed by an indexed min-heap instead of the
+// frequency list used by the O(1) LFU. Access and eviction are
+// O(log n), in exchange the items are kept in a single array which is
+// cheap to scan for analytics, see TopK and Rank.
+type LFUHeap[K comparable, V any] struct {
+	Mu       sync.Mutex
+	Capacity int
+
+	items    map[K]*item[K, V]
+	heap     minHeap[K, V]
+	sequence uint64
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+func NewLFUHeap[K comparable, V any](capacity int) *LFUHeap[K, V] {
+	if capacity <= 0 {
+		panic("capacity has to be greater than 0")
+	}
+
+	return &LFUHeap[K, V]{
+		Capacity: capacity,
+		items:    make(map[K]*item[K, V], capacity),
+		heap:     make(minHeap[K, V], 0, capacity),
+	}
+}
+
+func (c *LFUHeap[K, V]) touch(it *item[K, V]) {
+	c.sequence++
+	it.sequence = c.sequence
+	it.frequency++
+	heap.Fix(&c.heap, it.index)
+}
+
+// Get returns the value of key and counts an access to it.
+func (c *LFUHeap[K, V]) Get(key K) (V, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	it, present := c.items[key]
+	if !present {
+		c.misses++
+		var zeroValue V
+		return zeroValue, false
+	}
+
+	c.hits++
+	c.touch(it)
+	return it.value, true
+}
+
+// Set stores value under key. Updating a resident key counts as an
+// access; a new key starts at frequency 1 and evicts the least
+// frequently used item if the cache is full.
+func (c *LFUHeap[K, V]) Set(key K, value V) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if it, present := c.items[key]; present {
+		it.value = value
+		c.touch(it)
+		return
+	}
+
+	if len(c.items) >= c.Capacity {
+		c.evict()
+	}
+
+	c.sequence++
+	it := &item[K, V]{
+		key:       key,
+		value:     value,
+		frequency: 1,
+		sequence:  c.sequence,
+	}
+	heap.Push(&c.heap, it)
+	c.items[key] = it
+}
+
+func (c *LFUHeap[K, V]) Delete(key K) bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	it, present := c.items[key]
+	if !present {
+		return false
+	}
+
+	heap.Remove(&c.heap, it.index)
+	delete(c.items, key)
+	return true
+}
+
+// Evict removes and returns the least frequently used item.
+func (c *LFUHeap[K, V]) Evict() (K, V, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if len(c.heap) == 0 {
+		var zeroKey K
+		var zeroValue V
+		return zeroKey, zeroValue, false
+	}
+
+	it := c.evict()
+	return it.key, it.value, true
+}
+
+func (c *LFUHeap[K, V]) evict() *item[K, V] {
+	it := heap.Pop(&c.heap).(*item[K, V])
+	delete(c.items, it.key)
+	c.evictions++
+	return it
+}
+
+// Frequency returns how many times key has been accessed, including the
+// insert, without counting as an access itself.
+func (c *LFUHeap[K, V]) Frequency(key K) (int, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	it, present := c.items[key]
+	if !present {
+		return 0, false
+	}
+	return it.frequency, true
+}
+
+// TopK returns the k most frequently used items, most frequent first,
+// with ties going to the most recently accessed item. It sorts a copy of
+// the heap array, O(n log n), and counts nothing as an access.
+func (c *LFUHeap[K, V]) TopK(k int) []cachego.Entry[K, V] {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	items := append([]*item[K, V](nil), c.heap...)
+	sort.Slice(items, func(i, j int) bool {
+		return before(items[j], items[i])
+	})
+
+	entries := make([]cachego.Entry[K, V], 0, min(max(k, 0), len(items)))
+	for _, it := range items[:cap(entries)] {
+		entries = append(entries, cachego.Entry[K, V]{Key: it.key, Value: it.value})
+	}
+	return entries
+}
+
+// Rank returns the position of key when every key is ordered as TopK
+// orders them. Rank 1 is the most popular key; total is the number of
+// keys in the cache. It is a single scan of the heap array.
+func (c *LFUHeap[K, V]) Rank(key K) (rank, total int, ok bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	it, present := c.items[key]
+	if !present {
+		return 0, len(c.items), false
+	}
+
+	rank = 1
+	for _, other := range c.heap {
+		if before(it, other) {
+			rank++
+		}
+	}
+	return rank, len(c.items), true
+}
+
+func (c *LFUHeap[K, V]) Len() int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return len(c.items)
+}
+
+// Entries returns every item in heap order, which is not sorted beyond
+// the least frequently used item coming first.
+func (c *LFUHeap[K, V]) Entries() []cachego.Entry[K, V] {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	entries := make([]cachego.Entry[K, V], 0, len(c.heap))
+	for _, it := range c.heap {
+		entries = append(entries, cachego.Entry[K, V]{Key: it.key, Value: it.value})
+	}
+	return entries
+}
+
+func (c *LFUHeap[K, V]) Stats() cachego.Stats {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       len(c.items),
+		Cap:       c.Capacity,
+	}
+}
+
+// CheckInvariants reports the first inconsistency between the heap and
+// the items map: at most Capacity items, each in the map under its key
+// at the index it records, a frequency of at least 1, and no item ahead
+// of its parent in the heap order.
+func (c *LFUHeap[K, V]) CheckInvariants() error {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	if len(c.items) > c.Capacity {
+		return fmt.Errorf("%d items for a capacity of %d", len(c.items), c.Capacity)
+	}
+	if len(c.heap) != len(c.items) {
+		return fmt.Errorf("heap holds %d items but the map holds %d", len(c.heap), len(c.items))
+	}
+	for i, it := range c.heap {
+		if it.index != i {
+			return fmt.Errorf("key %v is at %d of the heap but records %d", it.key, i, it.index)
+		}
+		if c.items[it.key] != it {
+			return fmt.Errorf("key %v is in the heap but not in the map", it.key)
+		}
+		if it.frequency < 1 {
+			return fmt.Errorf("key %v has frequency %d", it.key, it.frequency)
+		}
+		if it.sequence > c.sequence {
+			return fmt.Errorf("key %v was accessed at %d, after the last access %d", it.key, it.sequence, c.sequence)
+		}
+		if parent := (i - 1) / 2; i > 0 && c.heap.Less(i, parent) {
+			return fmt.Errorf("key %v is ahead of its parent %v in the heap", it.key, c.heap[parent].key)
+		}
+	}
+	return nil
+}
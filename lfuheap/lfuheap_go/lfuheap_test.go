@@ -0,0 +1,199 @@
+package lfuheap
+
+import (
+	"reflect"
+	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
+)
+
+var _ cachego.Cache[string, int] = (*LFUHeap[string, int])(nil)
+
+// checkHeap fails the test if the heap and the map are inconsistent
+func checkHeap[K comparable, V any](t *testing.T, c *LFUHeap[K, V]) {
+	t.Helper()
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewLFUHeapPanics tests that a non positive capacity is rejected
+func TestNewLFUHeapPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Fatal("Expected panic for capacity 0")
+		}
+	}()
+	NewLFUHeap[string, int](0)
+}
+
+// TestGetSet tests basic reads and writes
+func TestGetSet(t *testing.T) {
+	c := NewLFUHeap[string, int](3)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected (1, true), got (%v, %v)", v, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected a miss for an unknown key")
+	}
+
+	c.Set("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("Expected updated value 10, got %v", v)
+	}
+	if f, _ := c.Frequency("a"); f != 4 {
+		t.Errorf("Expected frequency 4 after insert, get, set and get, got %d", f)
+	}
+	if c.Len() != 2 {
+		t.Errorf("Expected Len 2, got %d", c.Len())
+	}
+	checkHeap(t, c)
+}
+
+// TestEvictionOrder tests that the least frequent item is evicted, oldest first on ties
+func TestEvictionOrder(t *testing.T) {
+	c := NewLFUHeap[string, int](3)
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Get("a")
+	c.Get("c")
+
+	// b is at frequency 1, it goes first
+	c.Set("d", 4)
+	if _, ok := c.Get("b"); ok {
+		t.Error("Expected b to be evicted")
+	}
+
+	// d was just inserted at frequency 1, below c at frequency 2
+	key, _, ok := c.Evict()
+	if !ok || key != "d" {
+		t.Errorf("Expected d to be evicted, got %v", key)
+	}
+
+	// c is now the least frequent
+	key, _, _ = c.Evict()
+	if key != "c" {
+		t.Errorf("Expected c to be evicted, got %v", key)
+	}
+	checkHeap(t, c)
+}
+
+// TestTieBreakOldestFirst tests that equal frequencies evict the least recently used
+func TestTieBreakOldestFirst(t *testing.T) {
+	c := NewLFUHeap[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")
+	c.Get("b")
+	c.Get("c") // all at frequency 2, a was touched longest ago
+
+	if key, _, _ := c.Evict(); key != "a" {
+		t.Errorf("Expected a to be evicted, got %v", key)
+	}
+}
+
+// TestDelete tests removing items from the middle of the heap
+func TestDelete(t *testing.T) {
+	c := NewLFUHeap[int, int](10)
+	for i := 0; i < 10; i++ {
+		c.Set(i, i)
+		for j := 0; j < i%4; j++ {
+			c.Get(i)
+		}
+	}
+
+	if !c.Delete(5) {
+		t.Error("Expected Delete to report the key was present")
+	}
+	if c.Delete(5) {
+		t.Error("Expected a second Delete to report false")
+	}
+	if _, ok := c.Get(5); ok {
+		t.Error("Expected deleted key to be gone")
+	}
+	checkHeap(t, c)
+
+	if _, _, ok := NewLFUHeap[int, int](1).Evict(); ok {
+		t.Error("Expected Evict on an empty cache to report false")
+	}
+}
+
+// TestEntriesAndStats tests the common interface accessors
+func TestEntriesAndStats(t *testing.T) {
+	c := NewLFUHeap[string, int](2)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Get("a")
+	c.Get("missing")
+	c.Set("c", 3) // evicts b
+
+	entries := c.Entries()
+	if len(entries) != 2 || entries[0].Key != "c" {
+		t.Errorf("Expected 2 entries with c first, got %v", entries)
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Evictions != 1 || stats.Len != 2 || stats.Cap != 2 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// TestTopKAndRank tests that items are ranked by frequency, most recent first on ties, without counting as accesses
+func TestTopKAndRank(t *testing.T) {
+	c := NewLFUHeap[string, int](5)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		c.Set(key, 0)
+	}
+	c.Get("c")
+	c.Get("c")
+	c.Get("a")
+	c.Get("d") // a and d tie at 2, d is more recent
+
+	var keys []string
+	for _, entry := range c.TopK(3) {
+		keys = append(keys, entry.Key)
+	}
+	if !reflect.DeepEqual(keys, []string{"c", "d", "a"}) {
+		t.Errorf("Expected top 3 [c d a], got %v", keys)
+	}
+	if len(c.TopK(10)) != 4 || len(c.TopK(0)) != 0 || len(c.TopK(-1)) != 0 {
+		t.Error("Expected TopK to return at most every item and nothing for k <= 0")
+	}
+
+	for want, key := range []string{"c", "d", "a", "b"} {
+		if rank, total, ok := c.Rank(key); !ok || rank != want+1 || total != 4 {
+			t.Errorf("Expected %s ranked %d of 4, got (%d, %d, %v)", key, want+1, rank, total, ok)
+		}
+	}
+	if _, total, ok := c.Rank("missing"); ok || total != 4 {
+		t.Errorf("Expected a missing key to report (false, 4), got (%v, %d)", ok, total)
+	}
+	if frequency, _ := c.Frequency("b"); frequency != 1 {
+		t.Errorf("Expected analytics not to count as accesses, b has frequency %d", frequency)
+	}
+	checkHeap(t, c)
+}
+
+// FuzzLFUHeap tests that no stream of operations breaks the heap
+func FuzzLFUHeap(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewLFUHeap[int, int](4)
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { c.Get(key) },
+			Set:             func(key, value int) { c.Set(key, value) },
+			Delete:          func(key int) { c.Delete(key) },
+			Evict:           func() { c.Evict() },
+			CheckInvariants: c.CheckInvariants,
+		})
+	})
+}
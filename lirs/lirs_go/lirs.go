@@ -0,0 +1,437 @@
+package lirs
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	cachego "cache_go"
+)
+
+// status is the status LIRS gives a block.
+type status int
+
+const (
+	// lir blocks have a small inter-reference recency, they are always
+	// resident and only ever demoted to hir.
+	lir status = iota
+	// hir blocks are resident but have not shown a small enough reuse
+	// distance yet, they are the ones replaced.
+	hir
+	// ghost blocks are hir blocks that were replaced but are still on
+	// the stack, remembered without their value, so that a reuse within
+	// the recency of the stack can be recognised.
+	ghost
+)
+
+// Each block can be on two lists at once: the stack S and either the
+// queue Q, while it is a resident hir block, or the ghost list, while
+// it is a ghost.
+const (
+	onStack = iota
+	onQueue
+)
+
+type links[K comparable, V any] struct {
+	prev *block[K, V]
+	next *block[K, V]
+}
+
+type block[K comparable, V any] struct {
+	key    K
+	value  V
+	status status
+	links  [2]links[K, V]
+}
+
+// list is a doubly linked list threaded through one of the links of
+// its blocks, with a sentinel so that the ends need no special case.
+// The front is the most recent block, the back the least recent.
+type list[K comparable, V any] struct {
+	root  block[K, V]
+	which int
+	len   int
+}
+
+func (l *list[K, V]) init(which int) {
+	l.which = which
+	l.root.links[which] = links[K, V]{prev: &l.root, next: &l.root}
+}
+
+func (l *list[K, V]) contains(b *block[K, V]) bool {
+	return b.links[l.which].next != nil
+}
+
+func (l *list[K, V]) pushFront(b *block[K, V]) {
+	first := l.root.links[l.which].next
+	b.links[l.which] = links[K, V]{prev: &l.root, next: first}
+	first.links[l.which].prev = b
+	l.root.links[l.which].next = b
+	l.len++
+}
+
+func (l *list[K, V]) remove(b *block[K, V]) {
+	link := b.links[l.which]
+	link.prev.links[l.which].next = link.next
+	link.next.links[l.which].prev = link.prev
+	b.links[l.which] = links[K, V]{}
+	l.len--
+}
+
+// moveToFront puts b at the front, whether or not it was on the list.
+func (l *list[K, V]) moveToFront(b *block[K, V]) {
+	if l.contains(b) {
+		l.remove(b)
+	}
+	l.pushFront(b)
+}
+
+// back returns the least recent block, or nil when the list is empty.
+func (l *list[K, V]) back() *block[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.root.links[l.which].prev
+}
+
+// LIRS is a Low Inter-reference Recency Set cache. It ranks blocks by
+// the recency of their last two references instead of only the last
+// one. The stack S holds every lir block and the hir blocks, resident
+// or not, referenced since the least recent lir block, which is kept
+// at its bottom by pruning. The queue Q holds the resident hir blocks
+// in the order they are replaced. A hir block referenced again while
+// on S was reused closer than the least recent lir block, so it is
+// promoted to lir and that lir block is demoted to hir in its place.
+// Blocks seen only once never get past Q, so a scan only replaces the
+// small hir share of the cache.
+type LIRS[K comparable, V any] struct {
+	Mu       sync.Mutex
+	Capacity int
+
+	// HIRCapacity is the number of resident blocks that are kept hir,
+	// the lir blocks get the rest of the capacity.
+	HIRCapacity int
+
+	blocks map[K]*block[K, V]
+
+	stack  list[K, V]
+	queue  list[K, V]
+	ghosts list[K, V]
+
+	countLIR int
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewLIRS creates a cache holding at most capacity values, 1% of them,
+// and at least one, as hir blocks, and remembering at most capacity
+// replaced keys.
+func NewLIRS[K comparable, V any](capacity int) *LIRS[K, V] {
+	return NewLIRSWithHIR[K, V](capacity, max(capacity/100, 1))
+}
+
+// NewLIRSWithHIR is NewLIRS with hirCapacity of the capacity kept as
+// hir blocks.
+func NewLIRSWithHIR[K comparable, V any](capacity, hirCapacity int) *LIRS[K, V] {
+	if capacity <= 0 {
+		panic("capacity has to be greater than 0")
+	}
+	if hirCapacity <= 0 || hirCapacity > capacity {
+		panic("hir capacity has to be between 1 and the capacity")
+	}
+
+	c := &LIRS[K, V]{
+		Capacity:    capacity,
+		HIRCapacity: hirCapacity,
+		blocks:      make(map[K]*block[K, V], 2*capacity),
+	}
+	c.stack.init(onStack)
+	c.queue.init(onQueue)
+	c.ghosts.init(onQueue)
+	return c
+}
+
+// prune removes the hir blocks from the bottom of S until a lir block
+// is there, forgetting the ghosts among them. Without any lir block,
+// which a capacity with no lir share leaves, S ends up empty.
+func (c *LIRS[K, V]) prune() {
+	for b := c.stack.back(); b != nil && b.status != lir; b = c.stack.back() {
+		c.stack.remove(b)
+		if b.status == ghost {
+			c.forget(b)
+		}
+	}
+}
+
+// forget removes the ghost b from the ghost list and the map.
+func (c *LIRS[K, V]) forget(b *block[K, V]) {
+	c.ghosts.remove(b)
+	delete(c.blocks, b.key)
+}
+
+// demote turns the lir block at the bottom of S into a resident hir
+// block, once a promotion has left one lir block too many.
+func (c *LIRS[K, V]) demote() {
+	if c.countLIR <= c.Capacity-c.HIRCapacity {
+		return
+	}
+
+	b := c.stack.back()
+	c.stack.remove(b)
+	b.status = hir
+	c.queue.pushFront(b)
+	c.countLIR--
+	c.prune()
+}
+
+// promote makes the hir block or ghost b a lir block on top of S.
+func (c *LIRS[K, V]) promote(b *block[K, V]) {
+	b.status = lir
+	c.stack.moveToFront(b)
+	c.countLIR++
+	c.demote()
+}
+
+// access records a reference to the resident block b.
+func (c *LIRS[K, V]) access(b *block[K, V]) {
+	switch {
+	case b.status == lir:
+		bottom := c.stack.back() == b
+		c.stack.moveToFront(b)
+		if bottom {
+			c.prune()
+		}
+
+	case c.stack.contains(b):
+		c.queue.remove(b)
+		c.promote(b)
+
+	default:
+		c.stack.pushFront(b)
+		c.queue.moveToFront(b)
+		c.prune()
+	}
+}
+
+// replace turns the resident hir block at the back of Q into a ghost,
+// or forgets it when it is no longer on S, to make room for one more
+// resident block.
+func (c *LIRS[K, V]) replace() {
+	if c.countLIR+c.queue.len < c.Capacity {
+		return
+	}
+
+	b := c.queue.back()
+	c.queue.remove(b)
+	c.evictions++
+	if !c.stack.contains(b) {
+		delete(c.blocks, b.key)
+		return
+	}
+
+	var zeroValue V
+	b.value = zeroValue
+	b.status = ghost
+	c.ghosts.pushFront(b)
+	if c.ghosts.len > c.Capacity {
+		oldest := c.ghosts.back()
+		c.stack.remove(oldest)
+		c.forget(oldest)
+	}
+}
+
+// Get returns the value of a resident key and records the reference.
+// A key only remembered as a ghost is a miss.
+func (c *LIRS[K, V]) Get(key K) (V, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	b, present := c.blocks[key]
+	if !present || b.status == ghost {
+		c.misses++
+		var zeroValue V
+		return zeroValue, false
+	}
+
+	c.hits++
+	c.access(b)
+	return b.value, true
+}
+
+// Set stores value under key. A resident key is updated and referenced.
+// While the lir blocks do not fill their share any new key becomes one.
+// After that a ghost comes back as a lir block, having been reused
+// within the recency of S, and any other key is admitted as a hir block.
+func (c *LIRS[K, V]) Set(key K, value V) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	b, present := c.blocks[key]
+	if present && b.status != ghost {
+		b.value = value
+		c.access(b)
+		return
+	}
+
+	c.replace()
+	if present {
+		// replace may have forgotten the ghost to keep the ghosts
+		// within the capacity.
+		b, present = c.blocks[key]
+	}
+	if present {
+		c.ghosts.remove(b)
+	} else {
+		b = &block[K, V]{key: key}
+		c.blocks[key] = b
+	}
+	b.value = value
+
+	switch {
+	case c.countLIR < c.Capacity-c.HIRCapacity || present:
+		c.promote(b)
+	default:
+		b.status = hir
+		c.stack.pushFront(b)
+		c.queue.pushFront(b)
+		c.prune()
+	}
+}
+
+// Delete removes key, forgetting it entirely if it is only a ghost. It
+// reports whether the key was resident.
+func (c *LIRS[K, V]) Delete(key K) bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	b, present := c.blocks[key]
+	if !present {
+		return false
+	}
+
+	if c.stack.contains(b) {
+		c.stack.remove(b)
+	}
+	switch b.status {
+	case lir:
+		c.countLIR--
+		delete(c.blocks, key)
+	case hir:
+		c.queue.remove(b)
+		delete(c.blocks, key)
+	default:
+		c.forget(b)
+	}
+	c.prune()
+	return b.status != ghost
+}
+
+func (c *LIRS[K, V]) Len() int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return c.countLIR + c.queue.len
+}
+
+// Entries returns every resident key, the lir blocks from the least to
+// the most recently referenced and then the hir blocks in the order
+// they would be replaced.
+func (c *LIRS[K, V]) Entries() []cachego.Entry[K, V] {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	entries := make([]cachego.Entry[K, V], 0, c.countLIR+c.queue.len)
+	for b := c.stack.back(); b != nil && b != &c.stack.root; b = b.links[onStack].prev {
+		if b.status == lir {
+			entries = append(entries, cachego.Entry[K, V]{Key: b.key, Value: b.value})
+		}
+	}
+	for b := c.queue.back(); b != nil && b != &c.queue.root; b = b.links[onQueue].prev {
+		entries = append(entries, cachego.Entry[K, V]{Key: b.key, Value: b.value})
+	}
+	return entries
+}
+
+func (c *LIRS[K, V]) Stats() cachego.Stats {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       c.countLIR + c.queue.len,
+		Cap:       c.Capacity,
+	}
+}
+
+// CheckInvariants walks both lists and reports the first inconsistency:
+// every list has to be doubly linked and hold only blocks of the map,
+// S has to hold every lir block and have one at its bottom, Q has to
+// hold exactly the resident hir blocks and the ghost list exactly the
+// ghosts, all of which are on S, the lir count has to match and fit
+// its share, and the resident blocks and the ghosts have to fit in the
+// capacity.
+func (c *LIRS[K, V]) CheckInvariants() error {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	counts := map[status]int{}
+	for _, b := range c.blocks {
+		if c.blocks[b.key] != b {
+			return fmt.Errorf("block %v is filed under another key", b.key)
+		}
+		counts[b.status]++
+		if b.status != hir && !c.stack.contains(b) {
+			return fmt.Errorf("block %v of status %d is not on the stack", b.key, b.status)
+		}
+		if b.status == lir && b.links[onQueue].next != nil {
+			return fmt.Errorf("lir block %v is on the queue", b.key)
+		}
+	}
+
+	for _, l := range []*list[K, V]{&c.stack, &c.queue, &c.ghosts} {
+		n := 0
+		for b := l.root.links[l.which].next; b != &l.root; b = b.links[l.which].next {
+			if b.links[l.which].next.links[l.which].prev != b {
+				return fmt.Errorf("block %v has a broken next link", b.key)
+			}
+			if c.blocks[b.key] != b {
+				return fmt.Errorf("block %v on a list is not the one in the map", b.key)
+			}
+			if l == &c.queue && b.status != hir {
+				return fmt.Errorf("block %v of status %d is on the queue", b.key, b.status)
+			}
+			if l == &c.ghosts && b.status != ghost {
+				return fmt.Errorf("block %v of status %d is on the ghost list", b.key, b.status)
+			}
+			n++
+			if n > len(c.blocks) {
+				return errors.New("a list holds more blocks than the map")
+			}
+		}
+		if n != l.len {
+			return fmt.Errorf("list holds %d blocks but records %d", n, l.len)
+		}
+	}
+
+	if bottom := c.stack.back(); bottom != nil && bottom.status != lir {
+		return fmt.Errorf("block %v at the bottom of the stack is not lir", bottom.key)
+	}
+	if counts[lir] != c.countLIR {
+		return fmt.Errorf("counted %d lir blocks but recorded %d", counts[lir], c.countLIR)
+	}
+	if counts[hir] != c.queue.len || counts[ghost] != c.ghosts.len {
+		return fmt.Errorf("counted %d hir blocks and %d ghosts but the lists hold %d and %d",
+			counts[hir], counts[ghost], c.queue.len, c.ghosts.len)
+	}
+	if c.countLIR > c.Capacity-c.HIRCapacity {
+		return fmt.Errorf("%d lir blocks exceed their share of %d", c.countLIR, c.Capacity-c.HIRCapacity)
+	}
+	if c.countLIR+c.queue.len > c.Capacity || c.ghosts.len > c.Capacity {
+		return fmt.Errorf("%d resident blocks and %d ghosts exceed the capacity of %d", c.countLIR+c.queue.len, c.ghosts.len, c.Capacity)
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package lirs
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
+)
+
+var _ cachego.Cache[string, int] = (*LIRS[string, int])(nil)
+
+// checkLIRS fails the test if the stacks are inconsistent
+func checkLIRS[K comparable, V any](t *testing.T, c *LIRS[K, V]) {
+	t.Helper()
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewLIRSPanics tests that a non positive capacity or a hir share outside it is rejected
+func TestNewLIRSPanics(t *testing.T) {
+	for _, sizes := range [][2]int{{0, 1}, {4, 0}, {4, 5}} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected panic for capacity %d and hir capacity %d", sizes[0], sizes[1])
+				}
+			}()
+			NewLIRSWithHIR[string, int](sizes[0], sizes[1])
+		}()
+	}
+	if c := NewLIRS[string, int](1000); c.HIRCapacity != 10 {
+		t.Errorf("Expected a hir capacity of 10, got %d", c.HIRCapacity)
+	}
+}
+
+// TestGetSet tests basic reads, writes and deletes
+func TestGetSet(t *testing.T) {
+	c := NewLIRS[string, int](3)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if v, ok := c.Get("a"); !ok || v != 1 {
+		t.Errorf("Expected (1, true), got (%v, %v)", v, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected a miss for an unknown key")
+	}
+
+	c.Set("a", 10)
+	if v, _ := c.Get("a"); v != 10 {
+		t.Errorf("Expected updated value 10, got %v", v)
+	}
+	if !c.Delete("a") || c.Delete("a") {
+		t.Error("Expected Delete to report the key only while it is resident")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Expected Len 1, got %d", c.Len())
+	}
+
+	c.Delete("b")
+	checkLIRS(t, c)
+	c.Set("c", 3)
+	if v, ok := c.Get("c"); !ok || v != 3 {
+		t.Errorf("Expected an emptied cache to take new keys, got (%v, %v)", v, ok)
+	}
+	checkLIRS(t, c)
+}
+
+// TestHIRReplacement tests that once the lir share is full new keys are replaced first
+func TestHIRReplacement(t *testing.T) {
+	c := NewLIRSWithHIR[string, int](3, 1)
+	c.Set("a", 1)
+	c.Set("b", 2) // a and b fill the lir share
+	c.Set("c", 3)
+	c.Set("d", 4) // c is replaced and kept as a ghost
+
+	if _, ok := c.Get("c"); ok {
+		t.Error("Expected c to be replaced")
+	}
+	if c.blocks["c"].status != ghost {
+		t.Error("Expected c to be kept as a ghost")
+	}
+	for _, key := range []string{"a", "b", "d"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("Expected %s to stay", key)
+		}
+	}
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Len != 3 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	checkLIRS(t, c)
+}
+
+// TestGhostPromotion tests that a ghost coming back is admitted as lir and demotes the least recent lir block
+func TestGhostPromotion(t *testing.T) {
+	c := NewLIRSWithHIR[string, int](3, 1)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Set("d", 4) // c becomes a ghost
+
+	c.Set("c", 5)
+	if c.blocks["c"].status != lir {
+		t.Errorf("Expected c to come back lir, got status %d", c.blocks["c"].status)
+	}
+	if c.blocks["a"].status != hir {
+		t.Errorf("Expected the least recent lir block a to be demoted, got status %d", c.blocks["a"].status)
+	}
+	if c.blocks["d"].status != ghost {
+		t.Error("Expected d to be replaced to make room for c")
+	}
+
+	want := []cachego.Entry[string, int]{{Key: "b", Value: 2}, {Key: "c", Value: 5}, {Key: "a", Value: 1}}
+	if got := c.Entries(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected entries %v, got %v", want, got)
+	}
+	checkLIRS(t, c)
+}
+
+// TestHIRHitOnStack tests that a resident hir block referenced again while on the stack is promoted
+func TestHIRHitOnStack(t *testing.T) {
+	c := NewLIRSWithHIR[string, int](3, 1)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+
+	c.Get("c")
+	if c.blocks["c"].status != lir || c.blocks["a"].status != hir {
+		t.Errorf("Expected c promoted and a demoted, got %d and %d", c.blocks["c"].status, c.blocks["a"].status)
+	}
+
+	// a left the stack when it was demoted, a hit only brings it back on top
+	c.Get("a")
+	if c.blocks["a"].status != hir || !c.stack.contains(c.blocks["a"]) {
+		t.Error("Expected a to stay hir and be back on the stack")
+	}
+	checkLIRS(t, c)
+}
+
+// TestScanResistance tests that a scan of one-off keys does not flush a reused working set
+func TestScanResistance(t *testing.T) {
+	c := NewLIRSWithHIR[int, int](100, 10)
+	hotKeys := 50
+
+	// Let the working set prove its reuse while one-off keys pass by.
+	next := 1000
+	for round := 0; round < 20; round++ {
+		for key := 0; key < hotKeys; key++ {
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, key)
+			}
+			c.Set(next, next)
+			next++
+		}
+	}
+
+	for i := 0; i < 1000; i++ {
+		c.Set(next, next)
+		next++
+	}
+
+	resident := 0
+	for key := 0; key < hotKeys; key++ {
+		if _, ok := c.Get(key); ok {
+			resident++
+		}
+	}
+	if resident < hotKeys*9/10 {
+		t.Errorf("Expected the working set to survive the scan, %d of %d keys are resident", resident, hotKeys)
+	}
+	checkLIRS(t, c)
+}
+
+// TestRandomizedInvariants tests that a random workload keeps the stacks consistent
+func TestRandomizedInvariants(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for _, sizes := range [][2]int{{1, 1}, {2, 1}, {7, 2}, {64, 1}, {64, 64}} {
+		c := NewLIRSWithHIR[int, int](sizes[0], sizes[1])
+		for i := 0; i < 5000; i++ {
+			key := rng.Intn(sizes[0] * 4)
+			switch op := rng.Intn(10); {
+			case op < 5:
+				c.Set(key, i)
+			case op < 9:
+				c.Get(key)
+			default:
+				c.Delete(key)
+			}
+			if err := c.CheckInvariants(); err != nil {
+				t.Fatalf("sizes %v, step %d: %v", sizes, i, err)
+			}
+		}
+		if len(c.Entries()) != c.Len() {
+			t.Errorf("Expected %d entries, got %d", c.Len(), len(c.Entries()))
+		}
+	}
+}
+
+// FuzzLIRS tests that no stream of operations leaves the stacks inconsistent
+func FuzzLIRS(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewLIRSWithHIR[int, int](4, 1)
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { c.Get(key) },
+			Set:             func(key, value int) { c.Set(key, value) },
+			Delete:          func(key int) { c.Delete(key) },
+			CheckInvariants: c.CheckInvariants,
+		})
+	})
+}
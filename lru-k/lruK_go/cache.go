@@ -0,0 +1,37 @@
+package lrukgo
+
+// Cache adapts an LRU_K to cachego.Cache, whose Set does not report
+// whether the page was stored, so tooling written against that
+// interface works with LRU-K. When Clock is set Get and Set reference
+// pages at the time it returns, as GetAt and SetAt do, e.g. a logical
+// clock that ticks once per operation when a trace is replayed faster
+// than the one second resolution of the wall clock. Clock has to return
+// times greater than 0, as GetAt and SetAt require. Every other method
+// is the one of LRU_K.
+type Cache[T comparable] struct {
+	*LRU_K[T]
+	Clock func() int64
+}
+
+// AsCache returns lru as a cachego.Cache on the wall clock.
+func (lru *LRU_K[T]) AsCache() Cache[T] {
+	return Cache[T]{LRU_K: lru}
+}
+
+// Get is LRU_K.Get, or GetAt the time of Clock.
+func (c Cache[T]) Get(key T) ([]byte, bool) {
+	if c.Clock == nil {
+		return c.LRU_K.Get(key)
+	}
+	return c.GetAt(key, c.Clock())
+}
+
+// Set is LRU_K.Set, or SetAt the time of Clock, without the report of
+// whether the page was stored.
+func (c Cache[T]) Set(key T, data []byte) {
+	if c.Clock == nil {
+		c.LRU_K.Set(key, data)
+		return
+	}
+	c.SetAt(key, data, c.Clock())
+}
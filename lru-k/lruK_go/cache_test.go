@@ -0,0 +1,29 @@
+package lrukgo
+
+import (
+	"testing"
+
+	cachego "cache_go"
+)
+
+var _ cachego.Cache[string, []byte] = Cache[string]{}
+
+// TestLRUK_AsCache tests the adapter on the wall clock and on a logical one
+func TestLRUK_AsCache(t *testing.T) {
+	var c cachego.Cache[string, []byte] = NewLRU[string](2, 2, 0).AsCache()
+	c.Set("a", []byte("a"))
+	if data, ok := c.Get("a"); !ok || string(data) != "a" {
+		t.Errorf("Expected (a, true), got (%s, %v)", data, ok)
+	}
+	if !c.Delete("a") || c.Len() != 0 {
+		t.Errorf("Expected Delete to empty the cache, Len %d", c.Len())
+	}
+
+	tick := int64(0)
+	logical := Cache[string]{LRU_K: NewLRU[string](2, 2, 0), Clock: func() int64 { tick++; return tick }}
+	logical.Set("a", []byte("a"))
+	logical.Get("a")
+	if hist := logical.HIST.hist["a"]; hist[0] != 2 || hist[1] != 1 {
+		t.Errorf("Expected references at ticks 2 and 1, got %v", hist)
+	}
+}
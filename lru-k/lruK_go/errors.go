@@ -0,0 +1,93 @@
+package lrukgo
+
+import (
+	"fmt"
+	"time"
+
+	cachego "cache_go"
+)
+
+// The Try variants below behave like their namesakes but return one of
+// the cachego errors instead of panicking, for callers that take their
+// parameters from configuration and would rather not recover().
+
+// TryNewLRU is NewLRU returning cachego.ErrInvalidCapacity for a
+// capacity that is not greater than 0, and cachego.ErrInvalidArgument
+// for a K that is not greater than 0 or a negative CRP.
+func TryNewLRU[T comparable](k int, cap int, crp int64) (*LRU_K[T], error) {
+	if cap <= 0 {
+		return nil, fmt.Errorf("%w: got %d", cachego.ErrInvalidCapacity, cap)
+	}
+	if k <= 0 {
+		return nil, fmt.Errorf("%w: K has to be greater than 0, got %d", cachego.ErrInvalidArgument, k)
+	}
+	if crp < 0 {
+		return nil, fmt.Errorf("%w: CRP cannot be negative, got %d", cachego.ErrInvalidArgument, crp)
+	}
+	return NewLRU[T](k, cap, crp), nil
+}
+
+// TryNewLRUWithBatch is NewLRUWithBatch returning the errors of
+// TryNewLRU, and cachego.ErrInvalidArgument for a batch that is not
+// between 1 and the capacity.
+func TryNewLRUWithBatch[T comparable](k int, cap int, crp int64, batch int) (*LRU_K[T], error) {
+	lru, err := TryNewLRU[T](k, cap, crp)
+	if err != nil {
+		return nil, err
+	}
+	if batch <= 0 || batch > cap {
+		return nil, fmt.Errorf("%w: batch has to be between 1 and %d, got %d", cachego.ErrInvalidArgument, cap, batch)
+	}
+	lru.EvictionBatch = batch
+	return lru, nil
+}
+
+// TrySetWithK is SetWithK returning cachego.ErrInvalidArgument for a K
+// that is not greater than 0. success reports, as for SetWithK, whether
+// the page was stored.
+func (lru *LRU_K[T]) TrySetWithK(key T, data []byte, k int) (success bool, err error) {
+	if k <= 0 {
+		return false, fmt.Errorf("%w: K has to be greater than 0, got %d", cachego.ErrInvalidArgument, k)
+	}
+	return lru.SetWithK(key, data, k), nil
+}
+
+// TrySetMiss is SetMiss returning cachego.ErrInvalidArgument for a ttl
+// that is not greater than 0.
+func (lru *LRU_K[T]) TrySetMiss(key T, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl has to be greater than 0, got %v", cachego.ErrInvalidArgument, ttl)
+	}
+	lru.SetMiss(key, ttl)
+	return nil
+}
+
+// TryGetAt is GetAt returning cachego.ErrInvalidArgument for a t that is
+// not greater than 0.
+func (lru *LRU_K[T]) TryGetAt(key T, t int64) ([]byte, bool, error) {
+	if t <= 0 {
+		return nil, false, fmt.Errorf("%w: t has to be greater than 0, got %d", cachego.ErrInvalidArgument, t)
+	}
+	data, present := lru.GetAt(key, t)
+	return data, present, nil
+}
+
+// TrySetAt is SetAt returning cachego.ErrInvalidArgument for a t that is
+// not greater than 0. success reports, as for SetAt, whether the page
+// was stored.
+func (lru *LRU_K[T]) TrySetAt(key T, data []byte, t int64) (success bool, err error) {
+	if t <= 0 {
+		return false, fmt.Errorf("%w: t has to be greater than 0, got %d", cachego.ErrInvalidArgument, t)
+	}
+	return lru.SetAt(key, data, t), nil
+}
+
+// TryReplayAt is ReplayAt returning cachego.ErrInvalidArgument for a t
+// that is not greater than 0.
+func (lru *LRU_K[T]) TryReplayAt(key T, t int64) error {
+	if t <= 0 {
+		return fmt.Errorf("%w: t has to be greater than 0, got %d", cachego.ErrInvalidArgument, t)
+	}
+	lru.ReplayAt(key, t)
+	return nil
+}
@@ -0,0 +1,97 @@
+package lrukgo
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	cachego "cache_go"
+)
+
+// TestLRUK_TryNewLRU tests that invalid parameters are errors instead of panics
+func TestLRUK_TryNewLRU(t *testing.T) {
+	for _, params := range []struct {
+		k, cap, batch int
+		crp           int64
+		want          error
+	}{
+		{k: 2, cap: 0, batch: 1, want: cachego.ErrInvalidCapacity},
+		{k: 0, cap: 4, batch: 1, want: cachego.ErrInvalidArgument},
+		{k: 2, cap: 4, batch: 1, crp: -1, want: cachego.ErrInvalidArgument},
+		{k: 2, cap: 4, batch: 0, want: cachego.ErrInvalidArgument},
+		{k: 2, cap: 4, batch: 5, want: cachego.ErrInvalidArgument},
+	} {
+		if _, err := TryNewLRUWithBatch[string](params.k, params.cap, params.crp, params.batch); !errors.Is(err, params.want) {
+			t.Errorf("%+v: Expected %v, got %v", params, params.want, err)
+		}
+	}
+	if _, err := TryNewLRU[string](0, 4, 0); !errors.Is(err, cachego.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument, got %v", err)
+	}
+
+	lru, err := TryNewLRUWithBatch[string](2, 4, 1, 2)
+	if err != nil || lru.Capacity != 4 || lru.EvictionBatch != 2 {
+		t.Errorf("Expected a cache of capacity 4 with a batch of 2, got %v", err)
+	}
+}
+
+// TestLRUK_TrySetWithKAndSetMiss tests that an invalid K or ttl is an error and stores nothing
+func TestLRUK_TrySetWithKAndSetMiss(t *testing.T) {
+	lru := NewLRU[string](2, 2, 0)
+	if _, err := lru.TrySetWithK("a", []byte("a"), 0); !errors.Is(err, cachego.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument, got %v", err)
+	}
+	if err := lru.TrySetMiss("b", 0); !errors.Is(err, cachego.ErrInvalidArgument) {
+		t.Errorf("Expected ErrInvalidArgument, got %v", err)
+	}
+	if lru.Size() != 0 || lru.HistoryLen() != 0 {
+		t.Errorf("Expected nothing stored, got size %d and %d histories", lru.Size(), lru.HistoryLen())
+	}
+
+	if success, err := lru.TrySetWithK("a", []byte("a"), 3); !success || err != nil {
+		t.Errorf("Expected (true, nil), got (%v, %v)", success, err)
+	}
+	if lru.HIST.length("a") != 3 {
+		t.Errorf("Expected a history of 3 references, got %d", lru.HIST.length("a"))
+	}
+	if err := lru.TrySetMiss("b", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if _, state := lru.Lookup("b"); state != Miss {
+		t.Errorf("Expected a Miss, got %v", state)
+	}
+}
+
+// TestLRUK_TryAt tests that a time that is not greater than 0 is an error and records nothing
+func TestLRUK_TryAt(t *testing.T) {
+	lru := NewLRU[string](2, 2, 0)
+	for _, at := range []int64{0, -1} {
+		if _, err := lru.TrySetAt("a", []byte("a"), at); !errors.Is(err, cachego.ErrInvalidArgument) {
+			t.Errorf("SetAt at %d: Expected ErrInvalidArgument, got %v", at, err)
+		}
+		if err := lru.TryReplayAt("a", at); !errors.Is(err, cachego.ErrInvalidArgument) {
+			t.Errorf("ReplayAt at %d: Expected ErrInvalidArgument, got %v", at, err)
+		}
+		if _, _, err := lru.TryGetAt("a", at); !errors.Is(err, cachego.ErrInvalidArgument) {
+			t.Errorf("GetAt at %d: Expected ErrInvalidArgument, got %v", at, err)
+		}
+	}
+	if lru.Size() != 0 || lru.HistoryLen() != 0 {
+		t.Errorf("Expected nothing stored, got size %d and %d histories", lru.Size(), lru.HistoryLen())
+	}
+
+	expectPanic(t, func() { lru.SetAt("a", []byte("a"), 0) }, "SetAt at 0")
+	expectPanic(t, func() { lru.GetAt("a", 0) }, "GetAt at 0")
+	expectPanic(t, func() { lru.ReplayAt("a", 0) }, "ReplayAt at 0")
+
+	if success, err := lru.TrySetAt("a", []byte("a"), 1); !success || err != nil {
+		t.Errorf("Expected (true, nil), got (%v, %v)", success, err)
+	}
+	if data, present, err := lru.TryGetAt("a", 2); !present || err != nil || string(data) != "a" {
+		t.Errorf("Expected (a, true, nil), got (%q, %v, %v)", data, present, err)
+	}
+	if got := lru.HIST.hist["a"]; fmt.Sprint(got) != "[2 1]" {
+		t.Errorf("Expected HIST [2 1], got %v", got)
+	}
+}
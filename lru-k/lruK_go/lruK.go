@@ -1,15 +1,25 @@
 package lrukgo
 
 import (
-	"log"
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
+
+	cachego "cache_go"
 )
 
 type LRU_K[T comparable] struct {
 	K  int
 	Mu sync.Mutex
 
+	// nolock leaves Mu alone in lock and unlock, see NewLRUNoLock.
+	nolock bool
+
 	// These two data structures are maintained for all pages with a
 	// Backward K-distance that is smaller than the Retained
 	// Information Period. An asynchronous demon process should
@@ -18,13 +28,108 @@ type LRU_K[T comparable] struct {
 	HIST *History[T]
 	LAST *Last[T]
 
+	// CRP is the Correlated Reference Period, a reference at most CRP
+	// after the last one is correlated to it. 0 turns correlation off:
+	// every reference counts, even two within the same second.
 	CRP int64
+
+	// RIP is the Retained Information Period: the history of a page is
+	// purged by the demon process once t - HIST(p,K) > RIP, see
+	// beyondRIP. 0 retains every history.
 	RIP int64
 
 	Buffer map[T][]byte
 
 	Capacity        int
 	CleanupInterval time.Duration
+
+	// MinCleanupInterval and MaxCleanupInterval make the demon process
+	// adaptive: a pass that purges nothing doubles the interval up to
+	// the max, a pass that purges at least a quarter of the buffer
+	// halves it down to the min. When the max is not set the demon
+	// sleeps CleanupInterval every time.
+	MinCleanupInterval time.Duration
+	MaxCleanupInterval time.Duration
+
+	// sleep, when set, replaces the ticker of the demon, so tests can
+	// control its passes.
+	sleep func(time.Duration)
+
+	// now, when set, replaces the clock of the demon, so tests can
+	// control the time of its passes.
+	now func() int64
+
+	// CleanupConcurrency is the number of workers a cleanup pass purges
+	// pages with. Every purge takes Mu, so more than one worker only
+	// helps when purging overlaps with other work on the cache; 0 and 1
+	// purge from the sweeping goroutine itself. However many pages are
+	// eligible, a pass never runs more goroutines than this.
+	CleanupConcurrency int
+
+	// EvictionBatch is how many victims a single scan of the buffer
+	// selects. The extra victims are kept and used by the following
+	// evictions, so a cache churning at capacity scans the buffer once
+	// every EvictionBatch inserts instead of on every insert.
+	EvictionBatch int
+	victims       []victimCandidate[T]
+
+	// MaxHistoryEntries bounds the number of pages with a history,
+	// resident or not, 0 leaves it unbounded. When a new history pushes
+	// the count over it the ghost with the largest Backward K-distance
+	// is forgotten first.
+	MaxHistoryEntries int
+
+	// onRemove, when set, is called with Mu held for every page that
+	// leaves the buffer, evicted or purged, so a MetaLRU can drop the
+	// metadata it keeps for the page.
+	onRemove func(key T)
+
+	// pageK holds the K of pages stored with SetWithK, every other page
+	// uses the global K.
+	pageK map[T]int
+
+	// absent holds the expiry of the resident pages that were stored
+	// with SetMiss, see Lookup.
+	absent map[T]time.Time
+
+	// tags indexes the resident pages stored with SetWithTags by tag,
+	// keyTags holds the tags of each of them, see EvictByTag.
+	tags    map[string]map[T]struct{}
+	keyTags map[T][]string
+
+	// CanEvict, when set, is asked before a page is chosen as a victim
+	// and a page it returns false for is skipped, e.g. one with an
+	// outstanding latch. It is consulted at every eviction, so a page is
+	// only protected while the answer is false. If it vetoes every page
+	// an insert into a full buffer fails instead. It runs with Mu held
+	// and must not call back into the cache.
+	CanEvict func(key T) bool
+
+	// Admit, when set, is asked before a page that is not resident is
+	// stored, e.g. to keep pages over a size out of the buffer. A page
+	// it returns false for is not stored, nothing is evicted for it and
+	// no history is recorded, and the Set reports false. It runs with Mu
+	// held and must not call back into the cache.
+	Admit func(key T, data []byte) bool
+
+	// OnEvictDetailed, when set, is called for every page evicted, by a
+	// Set into a full buffer or by Evict, with its data and a copy of its
+	// HIST, most recent reference first, e.g. to log the access pattern
+	// of victims for offline analysis. It is called before the page is
+	// removed, with Mu held, and must not call back into the cache.
+	OnEvictDetailed func(key T, data []byte, history []int64)
+
+	// EnableTiming makes Get and Set record how long they hold the lock,
+	// see LatencyStats. When it is off the cost is a single check.
+	EnableTiming bool
+	latency      latencyHistogram
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	admissions   uint64
+	readmissions uint64
 }
 
 type Last[T comparable] struct {
@@ -79,6 +184,20 @@ func (Hist *History[T]) get(key T, index int) int64 {
 
 }
 
+// length returns how many references the history of key holds, which
+// is the K of that page.
+func (Hist *History[T]) length(key T) int {
+	return len(Hist.hist[key])
+}
+
+// resize changes the number of references kept for key, keeping the
+// most recent ones.
+func (Hist *History[T]) resize(key T, k int) {
+	reference_times := make([]int64, k)
+	copy(reference_times, Hist.hist[key])
+	Hist.hist[key] = reference_times
+}
+
 func (Hist *History[T]) init(key T, k int) {
 	Hist.hist[key] = make([]int64, k)
 }
@@ -127,88 +246,1020 @@ func (Hist *History[T]) set(key T, index int, time int64) {
 // and contains the last two reference
 // string subscripts i and j, where ri = rj = p, or just the last
 // reference if only one is known.
+//
+// FindVictim returns the zero value if CanEvict vetoes every page.
 func (lru *LRU_K[T]) FindVictim(t int64) T {
+	victim, _ := lru.findVictim(t)
+	return victim
+}
+
+// findVictim is FindVictim that reports whether any page could be
+// evicted.
+func (lru *LRU_K[T]) findVictim(t int64) (T, bool) {
 	min := t
 	var victim T
 	found := false
 
-	log.Println("size of lru cache is ", len(lru.Buffer))
-
 	for page := range lru.Buffer {
+		if !lru.evictable(page) {
+			continue
+		}
 		time_of_last_reference := lru.LAST.get(page)
-		if t-time_of_last_reference > lru.CRP && lru.HIST.get(page, lru.K-1) < min {
+		if !lru.withinCRP(t, time_of_last_reference) && lru.kthReference(page) < min {
 			found = true
 			victim = page
-			min = lru.HIST.get(page, lru.K-1)
+			min = lru.kthReference(page)
 		}
 	}
 
+	// Every page was referenced within the CRP, e.g. during a burst
+	// that filled the buffer. None of them is eligible, but one has to
+	// go or the buffer would outgrow its capacity, so the CRP is ignored
+	// and the page with the oldest K-th reference is evicted, the least
+	// recently used one among pages with the same.
 	if !found {
-		found = false
-		min=t
+		var victim_kth, victim_last int64
 		for page := range lru.Buffer {
-			if lru.HIST.get(page, lru.K-1) < min {
+			if !lru.evictable(page) {
+				continue
+			}
+			kth, last := lru.kthReference(page), lru.LAST.get(page)
+			if !found || kth < victim_kth || (kth == victim_kth && last < victim_last) {
 				found = true
 				victim = page
-				min = lru.HIST.get(page, lru.K-1)
+				victim_kth, victim_last = kth, last
 			}
 		}
 	}
 
-	if !found{
-		for page:=range lru.Buffer{
-			return page
+	return victim, found
+}
+
+// evictable reports whether CanEvict lets page be evicted.
+func (lru *LRU_K[T]) evictable(page T) bool {
+	return lru.CanEvict == nil || lru.CanEvict(page)
+}
+
+// shiftHistory makes t the most recent reference of key, moving every
+// older reference one slot back and advancing it by the correlation
+// period. A zero slot means the reference is not known yet and stays
+// zero rather than turning into a made up timestamp. The result is
+// clamped so that HIST(p,i) is never newer than HIST(p,i-1).
+func (lru *LRU_K[T]) shiftHistory(key T, t int64, correl_period int64) {
+	if correl_period < 0 {
+		correl_period = 0
+	}
+
+	k := lru.HIST.length(key)
+	for i := k - 1; i > 0; i-- {
+		prev_reference_time := lru.HIST.get(key, i-1)
+		if prev_reference_time == 0 {
+			lru.HIST.set(key, i, 0)
+			continue
+		}
+
+		shifted := prev_reference_time + correl_period
+		if shifted < prev_reference_time {
+			shifted = math.MaxInt64
+		}
+		lru.HIST.set(key, i, shifted)
+	}
+	lru.HIST.set(key, 0, t)
+
+	for i := 1; i < k; i++ {
+		if newer := lru.HIST.get(key, i-1); lru.HIST.get(key, i) > newer {
+			lru.HIST.set(key, i, newer)
 		}
 	}
+}
 
-	return victim
+// kthReference returns HIST(p,K) for a page, treating a slot that was
+// never filled as minus infinity so such pages are always evicted first.
+func (lru *LRU_K[T]) kthReference(page T) int64 {
+	kth_reference := lru.HIST.get(page, lru.kthIndex(page))
+	if kth_reference == 0 {
+		return math.MinInt64
+	}
+	return kth_reference
 }
 
-func NewLRU[T comparable](k int, cap int, crp int64) *LRU_K[T] {
-	last := NewLast[T]()
-	history := NewHistory[T](k)
+// kFor returns the K used for key: the one given to SetWithK, or the
+// global K.
+func (lru *LRU_K[T]) kFor(key T) int {
+	if k, present := lru.pageK[key]; present {
+		return k
+	}
+	return lru.K
+}
+
+// kthIndex is the index of HIST(p,K) in the history of page, bounded by
+// the history it actually holds.
+func (lru *LRU_K[T]) kthIndex(page T) int {
+	return min(lru.kFor(page), lru.HIST.length(page)) - 1
+}
 
-	if cap <= 0 || k <= 0 || crp <= 0 {
+// withinCRP reports whether a reference at t is correlated to the last
+// one, made at last. With a CRP of 0 no reference is.
+func (lru *LRU_K[T]) withinCRP(t int64, last int64) bool {
+	return lru.CRP > 0 && t-last <= lru.CRP
+}
+
+func NewLRU[T comparable](k int, cap int, crp int64) *LRU_K[T] {
+	if cap <= 0 || k <= 0 || crp < 0 {
 		panic("these parameters are not allowed")
 	}
 
+	// The maps are sized for a full buffer up front so warming up a
+	// large cache does not rehash them over and over.
+	last := &Last[T]{last: make(map[T]int64, cap)}
+	history := &History[T]{hist: make(map[T][]int64, cap)}
+
 	lru_k := &LRU_K[T]{
-		Mu:              sync.Mutex{},
 		K:               k,
 		CRP:             crp,
 		Capacity:        cap,
 		LAST:            last,
 		HIST:            history,
 		CleanupInterval: 2 * time.Minute,
-		Buffer:          make(map[T][]byte),
+		Buffer:          make(map[T][]byte, cap),
+	}
+	return lru_k
+}
+
+// NewLRUWithBatch creates an LRU-K cache that selects batch victims per
+// scan of the buffer, see EvictionBatch.
+func NewLRUWithBatch[T comparable](k int, cap int, crp int64, batch int) *LRU_K[T] {
+	if batch <= 0 || batch > cap {
+		panic("batch has to be between 1 and the capacity")
 	}
-	// lru_k.Buffer=make(map[T][]byte,Capacity)
+	lru_k := NewLRU[T](k, cap, crp)
+	lru_k.EvictionBatch = batch
 	return lru_k
 }
 
+type victimCandidate[T comparable] struct {
+	page T
+	// tier is 0 for pages referenced outside the CRP, which are always
+	// preferred, and 1 for the rest. Both are ordered by their K-th
+	// reference, then by their last reference as FindVictim's fallback
+	// is.
+	tier int
+	kth  int64
+	last int64
+}
+
+func (c victimCandidate[T]) before(other victimCandidate[T]) bool {
+	if c.tier != other.tier {
+		return c.tier < other.tier
+	}
+	if c.kth != other.kth {
+		return c.kth < other.kth
+	}
+	return c.tier == 1 && c.last < other.last
+}
+
+// victimHeap is a max-heap, its root is the worst of the best candidates
+// found so far and is the one replaced when a better page turns up.
+type victimHeap[T comparable] []victimCandidate[T]
+
+func (h victimHeap[T]) Len() int           { return len(h) }
+func (h victimHeap[T]) Less(i, j int) bool { return h[j].before(h[i]) }
+func (h victimHeap[T]) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *victimHeap[T]) Push(x any)        { *h = append(*h, x.(victimCandidate[T])) }
+func (h *victimHeap[T]) Pop() any {
+	old := *h
+	c := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return c
+}
+
+// findVictims selects up to n pages in one pass over the buffer, ordered
+// the same way FindVictim picks a single victim: pages last referenced
+// outside the CRP by the oldest K-th reference first, then the rest the
+// same way.
+func (lru *LRU_K[T]) findVictims(t int64, n int) []victimCandidate[T] {
+	h := make(victimHeap[T], 0, n)
+	for page := range lru.Buffer {
+		if !lru.evictable(page) {
+			continue
+		}
+		candidate := victimCandidate[T]{
+			page: page,
+			tier: 1,
+			kth:  lru.kthReference(page),
+			last: lru.LAST.get(page),
+		}
+		if !lru.withinCRP(t, candidate.last) {
+			candidate.tier = 0
+		}
+
+		if len(h) < n {
+			heap.Push(&h, candidate)
+		} else if candidate.before(h[0]) {
+			h[0] = candidate
+			heap.Fix(&h, 0)
+		}
+	}
+
+	victims := make([]victimCandidate[T], len(h))
+	for i := len(h) - 1; i >= 0; i-- {
+		victims[i] = heap.Pop(&h).(victimCandidate[T])
+	}
+	return victims
+}
+
+// nextVictim returns the page to evict for an insert at time t. With
+// batching it hands out the victims of the last scan, skipping any that
+// left the buffer, were referenced again or were vetoed by CanEvict
+// since they were selected. It reports false when no page can be
+// evicted.
+func (lru *LRU_K[T]) nextVictim(t int64) (T, bool) {
+	if lru.EvictionBatch <= 1 {
+		return lru.findVictim(t)
+	}
+
+	rescanned := false
+	for {
+		if len(lru.victims) == 0 {
+			if rescanned {
+				var none T
+				return none, false
+			}
+			lru.victims = lru.findVictims(t, lru.EvictionBatch)
+			rescanned = true
+			continue
+		}
+
+		victim := lru.victims[0]
+		lru.victims = lru.victims[1:]
+
+		if !lru.stillVictim(victim) {
+			continue
+		}
+		return victim.page, true
+	}
+}
+
+// stillVictim reports whether a victim selected by an earlier scan is
+// still resident, unreferenced since and allowed by CanEvict.
+func (lru *LRU_K[T]) stillVictim(victim victimCandidate[T]) bool {
+	if _, present := lru.Buffer[victim.page]; !present {
+		return false
+	}
+	return lru.LAST.get(victim.page) == victim.last && lru.evictable(victim.page)
+}
+
+// WouldEvict returns the page that a Set of a page that is not resident
+// would evict if it were made now, so that a write-back layer can flush
+// a dirty victim before the insert evicts it. It reports false when the
+// buffer has room or CanEvict vetoes every page. Nothing changes, not
+// even the victims kept for EvictionBatch, so a reference or a Set in
+// between can still make the actual victim a different page.
+func (lru *LRU_K[T]) WouldEvict() (T, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.peekVictim(time.Now().Unix())
+}
+
+// peekVictim is nextVictim for a full buffer, leaving the victims of the
+// last scan in place.
+func (lru *LRU_K[T]) peekVictim(t int64) (T, bool) {
+	if len(lru.Buffer) < lru.Capacity {
+		var none T
+		return none, false
+	}
+	if lru.EvictionBatch > 1 {
+		for _, victim := range lru.victims {
+			if lru.stillVictim(victim) {
+				return victim.page, true
+			}
+		}
+	}
+	return lru.findVictim(t)
+}
+
+// Size returns the number of buffer resident pages, markers stored with
+// SetMiss included, 0 for an empty cache. It takes Mu, so it is safe to
+// call while other goroutines use the cache, but the count can be stale
+// by the time it is read. The limit it is measured against is the
+// Capacity field, set before the cache is shared.
 func (lru *LRU_K[T]) Size() int {
-	lru.Mu.Lock()
-	defer lru.Mu.Unlock()
+	lru.lock()
+	defer lru.unlock()
 
 	size := len(lru.Buffer)
 	return size
 }
 
+// Len is Size under the name cachego.Cache uses.
+func (lru *LRU_K[T]) Len() int {
+	return lru.Size()
+}
+
+// CheckInvariants verifies that the buffer, the histories and the
+// indexes of markers and tags agree with each other, and
+// returns the first inconsistency found. It is meant for tests and
+// fuzzing.
+func (lru *LRU_K[T]) CheckInvariants() error {
+	lru.lock()
+	defer lru.unlock()
+
+	if len(lru.Buffer) > lru.Capacity {
+		return fmt.Errorf("%d pages resident, capacity is %d", len(lru.Buffer), lru.Capacity)
+	}
+	for page := range lru.Buffer {
+		if !lru.HIST.exists(page) {
+			return fmt.Errorf("resident page %v has no history", page)
+		}
+		if _, present := lru.LAST.last[page]; !present {
+			return fmt.Errorf("resident page %v has no LAST", page)
+		}
+	}
+	for page, history := range lru.HIST.hist {
+		if len(history) != lru.kFor(page) {
+			return fmt.Errorf("history of %v holds %d references, K is %d", page, len(history), lru.kFor(page))
+		}
+		if history[0] == 0 {
+			return fmt.Errorf("history of %v has no reference", page)
+		}
+		for i := 1; i < len(history); i++ {
+			if history[i] > history[i-1] || (history[i] != 0 && history[i-1] == 0) {
+				return fmt.Errorf("history of %v is out of order: %v", page, history)
+			}
+		}
+	}
+	for page := range lru.LAST.last {
+		if !lru.HIST.exists(page) {
+			return fmt.Errorf("LAST of %v without a history", page)
+		}
+	}
+	for page, k := range lru.pageK {
+		if k <= 0 {
+			return fmt.Errorf("page %v has a K of %d", page, k)
+		}
+		if !lru.HIST.exists(page) {
+			return fmt.Errorf("K of %v without a history", page)
+		}
+	}
+	for page := range lru.absent {
+		if _, resident := lru.Buffer[page]; !resident {
+			return fmt.Errorf("marker %v that is not resident", page)
+		}
+	}
+
+	tagged := 0
+	for page, tags := range lru.keyTags {
+		if _, resident := lru.Buffer[page]; !resident {
+			return fmt.Errorf("tags of %v that is not resident", page)
+		}
+		for _, tag := range tags {
+			if _, indexed := lru.tags[tag][page]; !indexed {
+				return fmt.Errorf("page %v tagged %q is missing from the index", page, tag)
+			}
+		}
+		tagged += len(tags)
+	}
+	indexed := 0
+	for tag, pages := range lru.tags {
+		if len(pages) == 0 {
+			return fmt.Errorf("tag %q indexes no page", tag)
+		}
+		indexed += len(pages)
+	}
+	if tagged != indexed {
+		return fmt.Errorf("%d tags on pages, %d in the index", tagged, indexed)
+	}
+	return nil
+}
+
+// BackwardKDistances returns now - HIST(p,K) for every buffer resident
+// page, taken under a single lock so the snapshot is consistent. Pages
+// whose history does not yet hold K references have an infinite
+// Backward K-distance and are left out of the snapshot.
+func (lru *LRU_K[T]) BackwardKDistances(now int64) map[T]int64 {
+	lru.lock()
+	defer lru.unlock()
+
+	distances := make(map[T]int64, len(lru.Buffer))
+	for page := range lru.Buffer {
+		if !lru.HIST.exists(page) {
+			continue
+		}
+		kth_reference := lru.HIST.get(page, lru.kthIndex(page))
+		if kth_reference == 0 {
+			continue
+		}
+		distances[page] = now - kth_reference
+	}
+	return distances
+}
+
+// KDistance returns HIST(p,K) for key, the time of its K-th most recent
+// reference, from which its Backward K-distance at t is t - HIST(p,K),
+// and whether key has a history, resident or not. It is 0 while fewer
+// than K references are known, the distance being infinite. Unlike the
+// internal accessors it never panics, so it is safe to call for any key,
+// e.g. to inspect how the policy sees a page while debugging.
+func (lru *LRU_K[T]) KDistance(key T) (int64, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if !lru.HIST.exists(key) {
+		return 0, false
+	}
+	return lru.HIST.get(key, lru.kthIndex(key)), true
+}
+
+// GhostKeys returns the pages whose history is still retained although
+// they are no longer buffer resident. These are the pages LRU-K will
+// recognize as popular if they are referenced again within the Retained
+// Information Period.
+func (lru *LRU_K[T]) GhostKeys() []T {
+	lru.lock()
+	defer lru.unlock()
+
+	ghosts := make([]T, 0)
+	for page := range lru.HIST.hist {
+		if _, present := lru.Buffer[page]; !present {
+			ghosts = append(ghosts, page)
+		}
+	}
+	return ghosts
+}
+
+// Get returns the data of a resident page and records the read as a
+// reference to it, the same way Set does: LAST is updated and, outside
+// the CRP, HIST is shifted, so a page that is only ever read still
+// builds up a history. Use GetOpt to read without recording an access.
+// A marker stored with SetMiss is reported as a miss and dropped once
+// it has expired, see Lookup.
 func (lru *LRU_K[T]) Get(key T) ([]byte, bool) {
-	lru.Mu.Lock()
-	defer lru.Mu.Unlock()
+	lru.lock()
+	defer lru.unlock()
+	if lru.EnableTiming {
+		defer lru.latency.record(time.Now())
+	}
+
+	return lru.get(key, time.Now().Unix(), true)
+}
+
+// GetOpt is Get with a choice of recording the read. With record set it
+// is Get, with record unset it is a pure peek that leaves HIST and LAST
+// alone, so such reads never change which page is evicted. A miss
+// records nothing either way since there is no data to admit.
+func (lru *LRU_K[T]) GetOpt(key T, record bool) ([]byte, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.get(key, time.Now().Unix(), record)
+}
+
+// GetAt is GetOpt recording the read as a reference at time t instead
+// of the current time, for callers that run the cache on a logical
+// clock such as a commit timestamp or an LSN. t takes part in the CRP
+// and history computations exactly as the wall clock would, so it has
+// to be on the same clock as the t given to SetAt. t has to be greater
+// than 0, a HIST slot of 0 stands for a reference that never happened,
+// and GetAt panics otherwise, see TryGetAt.
+func (lru *LRU_K[T]) GetAt(key T, t int64) ([]byte, bool) {
+	if t <= 0 {
+		panic("t has to be greater than 0")
+	}
+
+	lru.lock()
+	defer lru.unlock()
 
+	return lru.get(key, t, true)
+}
+
+// get looks key up, counting a hit or a miss, and records a hit as a
+// reference at time t if record is set. It must be called with Mu held.
+func (lru *LRU_K[T]) get(key T, t int64, record bool) ([]byte, bool) {
 	data, present := lru.Buffer[key]
-	return data, present
+	if expires, negative := lru.absent[key]; !present || negative {
+		if negative && !time.Now().Before(expires) {
+			lru.displace(key)
+		}
+		lru.misses++
+		return nil, false
+	}
+
+	lru.hits++
+	if record {
+		lru.reference(key, t)
+	}
+	return data, true
 }
 
-func (lru *LRU_K[T]) Cleanup(key T) {
-	lru.Mu.Lock()
-	defer lru.Mu.Unlock()
+// RetainedUntil returns the time after which the history of key becomes
+// eligible for purge under the Retained Information Period, that is
+// HIST(p,K) + RIP, see beyondRIP. It reports false if the key has no
+// history.
+func (lru *LRU_K[T]) RetainedUntil(key T) (int64, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if !lru.HIST.exists(key) {
+		return 0, false
+	}
+	return lru.retainedUntil(key), true
+}
+
+// retainedUntil is RetainedUntil with Mu held. It saturates at
+// math.MaxInt64, which a RIP of 0 also gives.
+func (lru *LRU_K[T]) retainedUntil(page T) int64 {
+	if lru.RIP <= 0 {
+		return math.MaxInt64
+	}
+	kth_reference := lru.retainedReference(page)
+	if kth_reference > math.MaxInt64-lru.RIP {
+		return math.MaxInt64
+	}
+	return kth_reference + lru.RIP
+}
+
+// retainedReference is the HIST(p,K) the Retained Information Period
+// runs from. A history that does not hold K references yet runs from its
+// oldest one.
+func (lru *LRU_K[T]) retainedReference(page T) int64 {
+	for i := lru.kthIndex(page); i > 0; i-- {
+		if reference := lru.HIST.get(page, i); reference != 0 {
+			return reference
+		}
+	}
+	return lru.HIST.get(page, 0)
+}
+
+// beyondRIP reports whether the retained information criterion no longer
+// justifies keeping the history of page at t, that is t - HIST(p,K) >
+// RIP. The demon process purges such pages, resident or ghost, and
+// ThrashRate does not count them as re-admitted. It must be called with
+// Mu held.
+func (lru *LRU_K[T]) beyondRIP(page T, t int64) bool {
+	return t > lru.retainedUntil(page)
+}
+
+// HistoryLen returns the number of pages with a history, resident pages
+// and ghosts together.
+func (lru *LRU_K[T]) HistoryLen() int {
+	lru.lock()
+	defer lru.unlock()
+
+	return len(lru.HIST.hist)
+}
+
+// PurgeHistoryBefore forgets the history of every ghost page last
+// referenced before t and returns how many it purged, for an operator
+// reclaiming memory at once instead of waiting for the demon process.
+// A ghost's LAST is dropped when it is evicted, so its last reference is
+// the most recent one in HIST, or LAST where a ghost still has one.
+// Resident pages are never touched.
+func (lru *LRU_K[T]) PurgeHistoryBefore(t int64) int {
+	lru.lock()
+	defer lru.unlock()
+
+	purged := 0
+	for page, history := range lru.HIST.hist {
+		if _, resident := lru.Buffer[page]; resident {
+			continue
+		}
+		last, present := lru.LAST.last[page]
+		if !present {
+			last = history[0]
+		}
+		if last < t {
+			lru.HIST.delete(page)
+			lru.LAST.delete(page)
+			delete(lru.pageK, page)
+			purged++
+		}
+	}
+	return purged
+}
+
+// trimHistory forgets ghost histories until at most MaxHistoryEntries
+// are left, the ghosts with the oldest K-th reference first, together
+// with their LAST. Resident pages always keep their history, so the
+// bound can only be exceeded while every history belongs to a resident
+// page. The ghosts to forget are picked in a single pass.
+func (lru *LRU_K[T]) trimHistory() {
+	if lru.MaxHistoryEntries <= 0 || len(lru.HIST.hist) <= lru.MaxHistoryEntries {
+		return
+	}
+
+	type ghost struct {
+		page T
+		kth  int64
+	}
+	ghosts := make([]ghost, 0, max(len(lru.HIST.hist)-len(lru.Buffer), 0))
+	for page := range lru.HIST.hist {
+		if _, resident := lru.Buffer[page]; !resident {
+			ghosts = append(ghosts, ghost{page: page, kth: lru.kthReference(page)})
+		}
+	}
+	sort.Slice(ghosts, func(i, j int) bool { return ghosts[i].kth < ghosts[j].kth })
+
+	excess := min(len(lru.HIST.hist)-lru.MaxHistoryEntries, len(ghosts))
+	for _, g := range ghosts[:excess] {
+		lru.HIST.delete(g.page)
+		lru.LAST.delete(g.page)
+		delete(lru.pageK, g.page)
+	}
+}
+
+// ThrashRate is the share of admissions that brought back a page whose
+// history was still retained, i.e. a page that was evicted and then
+// referenced again before beyondRIP (any retained history counts when
+// RIP is not set). A high rate means the buffer is
+// too small for the working set.
+func (lru *LRU_K[T]) ThrashRate() float64 {
+	lru.lock()
+	defer lru.unlock()
+
+	if lru.admissions == 0 {
+		return 0
+	}
+	return float64(lru.readmissions) / float64(lru.admissions)
+}
+
+// Entries returns every resident page, the least recently referenced
+// first, so replaying them through Set keeps the pages' relative order
+// of last reference. Markers stored with SetMiss carry no data and are
+// left out.
+func (lru *LRU_K[T]) Entries() []cachego.Entry[T, []byte] {
+	lru.lock()
+	defer lru.unlock()
+
+	entries := make([]cachego.Entry[T, []byte], 0, len(lru.Buffer))
+	for page, data := range lru.Buffer {
+		if _, negative := lru.absent[page]; negative {
+			continue
+		}
+		entries = append(entries, cachego.Entry[T, []byte]{Key: page, Value: data})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return lru.LAST.get(entries[i].Key) < lru.LAST.get(entries[j].Key)
+	})
+	return entries
+}
+
+// String summarizes the cache and lists every resident page with its
+// Backward K-distance, e.g. "buffer=3/4, K=2, CRP=1, RIP=0 [c:inf a:4
+// b:2]". The distances are taken at the most recent reference in the
+// buffer, so they read the same on the wall clock and on a logical one.
+// Pages are listed in the order they would be evicted outside the CRP:
+// the largest distance first, pages without K references, printed as
+// inf, before any other.
+func (lru *LRU_K[T]) String() string {
+	lru.lock()
+	defer lru.unlock()
+
+	type distance struct {
+		key      string
+		distance int64
+		infinite bool
+	}
+
+	now := int64(math.MinInt64)
+	for page := range lru.Buffer {
+		now = max(now, lru.LAST.get(page))
+	}
+
+	distances := make([]distance, 0, len(lru.Buffer))
+	for page := range lru.Buffer {
+		d := distance{key: fmt.Sprint(page), infinite: true}
+		if lru.HIST.exists(page) {
+			if kth_reference := lru.HIST.get(page, lru.kthIndex(page)); kth_reference != 0 {
+				d.distance, d.infinite = now-kth_reference, false
+			}
+		}
+		distances = append(distances, d)
+	}
+	sort.Slice(distances, func(i, j int) bool {
+		a, b := distances[i], distances[j]
+		if a.infinite != b.infinite {
+			return a.infinite
+		}
+		if a.distance != b.distance {
+			return a.distance > b.distance
+		}
+		return a.key < b.key
+	})
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "buffer=%d/%d, K=%d, CRP=%d, RIP=%d [", len(lru.Buffer), lru.Capacity, lru.K, lru.CRP, lru.RIP)
+	for i, d := range distances {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		if d.infinite {
+			fmt.Fprintf(&b, "%s:inf", d.key)
+		} else {
+			fmt.Fprintf(&b, "%s:%d", d.key, d.distance)
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+func (lru *LRU_K[T]) Stats() cachego.Stats {
+	lru.lock()
+	defer lru.unlock()
+
+	return cachego.Stats{
+		Hits:      lru.hits,
+		Misses:    lru.misses,
+		Evictions: lru.evictions,
+		Len:       len(lru.Buffer),
+		Cap:       lru.Capacity,
+	}
+}
+
+// Clone returns an independent copy of the cache taken under a single
+// lock: the buffer, HIST, LAST, the tunables and the counters. The clone
+// shares no mutable state with the original, every data slice and
+// history is copied, so it can serve a consistent point in time view
+// while the original keeps changing, and either can be written without
+// affecting the other. The CanEvict, Admit and OnEvictDetailed hooks
+// are shared, so they have to be safe to call from both caches. The
+// clone of a cache made with NewLRUNoLock does not lock either.
+// Metadata is only copied by the Clone of a MetaLRU.
+func (lru *LRU_K[T]) Clone() *LRU_K[T] {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.clone()
+}
+
+// clone is Clone with Mu held.
+func (lru *LRU_K[T]) clone() *LRU_K[T] {
+
+	buffer := make(map[T][]byte, max(len(lru.Buffer), lru.Capacity))
+	for page, data := range lru.Buffer {
+		if data != nil {
+			data = append([]byte{}, data...)
+		}
+		buffer[page] = data
+	}
+	history := &History[T]{hist: make(map[T][]int64, len(lru.HIST.hist))}
+	for page, reference_times := range lru.HIST.hist {
+		history.hist[page] = append([]int64{}, reference_times...)
+	}
+	last := &Last[T]{last: make(map[T]int64, len(lru.LAST.last))}
+	for page, t := range lru.LAST.last {
+		last.last[page] = t
+	}
+
+	return &LRU_K[T]{
+		K:                  lru.K,
+		nolock:             lru.nolock,
+		HIST:               history,
+		LAST:               last,
+		CRP:                lru.CRP,
+		RIP:                lru.RIP,
+		Buffer:             buffer,
+		Capacity:           lru.Capacity,
+		CleanupInterval:    lru.CleanupInterval,
+		CleanupConcurrency: lru.CleanupConcurrency,
+		MinCleanupInterval: lru.MinCleanupInterval,
+		MaxCleanupInterval: lru.MaxCleanupInterval,
+		sleep:              lru.sleep,
+		now:                lru.now,
+		EvictionBatch:      lru.EvictionBatch,
+		victims:            append([]victimCandidate[T]{}, lru.victims...),
+		MaxHistoryEntries:  lru.MaxHistoryEntries,
+		pageK:              cloneMap(lru.pageK),
+		absent:             cloneMap(lru.absent),
+		tags:               cloneTags(lru.tags),
+		keyTags:            cloneMap(lru.keyTags),
+		CanEvict:           lru.CanEvict,
+		Admit:              lru.Admit,
+		OnEvictDetailed:    lru.OnEvictDetailed,
+		EnableTiming:       lru.EnableTiming,
+		latency:            lru.latency,
+		hits:               lru.hits,
+		misses:             lru.misses,
+		evictions:          lru.evictions,
+		admissions:         lru.admissions,
+		readmissions:       lru.readmissions,
+	}
+}
+
+// cloneMap copies m, keeping a nil map nil.
+func cloneMap[T comparable, V any](m map[T]V) map[T]V {
+	if m == nil {
+		return nil
+	}
+	clone := make(map[T]V, len(m))
+	for key, value := range m {
+		clone[key] = value
+	}
+	return clone
+}
+
+// Cleanup purges key from the buffer together with its history. It
+// reports how many bytes of data the page held and whether the cache
+// knew the key at all, either as a resident page or as history only.
+func (lru *LRU_K[T]) Cleanup(key T) (freedBytes int, existed bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.purge(key)
+}
+
+// Delete removes key right away, the page together with its history,
+// e.g. when the data it caches changed. It reports whether the page was
+// resident; a ghost's history is purged but not reported, and neither is
+// a marker stored with SetMiss, which Get does not return either. Unlike
+// Evict it does not count as an eviction.
+func (lru *LRU_K[T]) Delete(key T) bool {
+	lru.lock()
+	defer lru.unlock()
+
+	_, resident := lru.Buffer[key]
+	_, negative := lru.absent[key]
+	lru.purge(key)
+	return resident && !negative
+}
+
+// Evict removes key from the buffer as if it had been chosen as a
+// victim and returns its data. Unlike Cleanup it keeps the history,
+// HIST and LAST alike, so the page becomes a ghost that is recognized
+// when it is referenced again within the Retained Information Period.
+// Its metadata goes with the data. It reports false if the page was not
+// resident; a marker stored with SetMiss is dropped but not reported.
+func (lru *LRU_K[T]) Evict(key T) ([]byte, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.evictPage(key)
+}
+
+// evictPage is Evict with Mu held.
+func (lru *LRU_K[T]) evictPage(key T) ([]byte, bool) {
+	data, resident := lru.Buffer[key]
+	if !resident {
+		return nil, false
+	}
+	_, negative := lru.absent[key]
+	if !negative {
+		lru.notifyEvict(key, data)
+	}
 
 	delete(lru.Buffer, key)
+	if lru.onRemove != nil {
+		lru.onRemove(key)
+	}
+	delete(lru.absent, key)
+	lru.untag(key)
+	if negative {
+		return nil, false
+	}
+	lru.evictions++
+	return data, true
+}
+
+// displace is evictPage for a page that makes room for another one or a
+// marker that expired: LAST goes too, only HIST is retained. A marker
+// stored with SetMiss is still neither reported to OnEvictDetailed nor
+// counted as an eviction.
+func (lru *LRU_K[T]) displace(key T) {
+	lru.evictPage(key)
+	lru.LAST.delete(key)
+}
+
+// notifyEvict calls OnEvictDetailed for a victim that is about to be
+// removed.
+func (lru *LRU_K[T]) notifyEvict(key T, data []byte) {
+	if lru.OnEvictDetailed == nil {
+		return
+	}
+	history := append([]int64(nil), lru.HIST.hist[key]...)
+	lru.OnEvictDetailed(key, data, history)
+}
+
+// purge is Cleanup with Mu held.
+func (lru *LRU_K[T]) purge(key T) (freedBytes int, existed bool) {
+	data, resident := lru.Buffer[key]
+	existed = resident || lru.HIST.exists(key)
+
+	delete(lru.Buffer, key)
+	if lru.onRemove != nil {
+		lru.onRemove(key)
+	}
+	delete(lru.absent, key)
+	lru.untag(key)
+	delete(lru.pageK, key)
 	lru.HIST.delete(key)
 	lru.LAST.delete(key)
+	return len(data), existed
+}
+
+// purgeCandidate is a page the demon process decided to purge, with the
+// time of its last reference, 0 for a ghost evicted without its LAST,
+// and whether it was resident when the decision was made.
+type purgeCandidate[T comparable] struct {
+	page     T
+	last     int64
+	resident bool
+}
+
+// purgeCandidates returns the pages the demon process would purge at t,
+// resident pages and ghosts alike.
+func (lru *LRU_K[T]) purgeCandidates(t int64) []purgeCandidate[T] {
+	lru.lock()
+	defer lru.unlock()
+
+	candidates := make([]purgeCandidate[T], 0)
+	for page := range lru.HIST.hist {
+		if lru.beyondRIP(page, t) {
+			_, resident := lru.Buffer[page]
+			candidates = append(candidates, purgeCandidate[T]{page: page, last: lru.LAST.last[page], resident: resident})
+		}
+	}
+	return candidates
+}
+
+// purgeCandidateNow purges a candidate at t unless it changed since it
+// was selected. The candidates are selected under one lock and purged
+// under another, so in between the page may have been removed, or
+// referenced or Set again, which must save it. Both are checked again
+// under the lock that purges it: the page has to still have its history,
+// be resident or a ghost as it was, unreferenced since and beyond the
+// RIP.
+func (lru *LRU_K[T]) purgeCandidateNow(c purgeCandidate[T], t int64) (freedBytes int, existed bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if _, resident := lru.Buffer[c.page]; resident != c.resident || !lru.HIST.exists(c.page) {
+		return 0, false
+	}
+	if lru.LAST.last[c.page] != c.last || !lru.beyondRIP(c.page, t) {
+		return 0, false
+	}
+	return lru.purge(c.page)
+}
+
+// CleanupPass runs a single sweep of the demon process synchronously and
+// reports how many pages it purged, ghosts included, and how many bytes
+// that freed.
+func (lru *LRU_K[T]) CleanupPass() (purged int, freedBytes int) {
+	t := lru.clock()
+	return lru.purgeAll(lru.purgeCandidates(t), t)
+}
+
+// clock is the time of a pass of the demon process.
+func (lru *LRU_K[T]) clock() int64 {
+	if lru.now != nil {
+		return lru.now()
+	}
+	return time.Now().Unix()
+}
+
+// purgeAll purges candidates at t with up to CleanupConcurrency workers.
+func (lru *LRU_K[T]) purgeAll(candidates []purgeCandidate[T], t int64) (purged int, freedBytes int) {
+	workers := min(lru.CleanupConcurrency, len(candidates))
+	if workers <= 1 || lru.unlocked() {
+		for _, candidate := range candidates {
+			freed, existed := lru.purgeCandidateNow(candidate, t)
+			if existed {
+				purged++
+				freedBytes += freed
+			}
+		}
+		return purged, freedBytes
+	}
+
+	pages := make(chan purgeCandidate[T])
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker_purged, worker_freed := 0, 0
+			for candidate := range pages {
+				freed, existed := lru.purgeCandidateNow(candidate, t)
+				if existed {
+					worker_purged++
+					worker_freed += freed
+				}
+			}
+
+			mu.Lock()
+			purged += worker_purged
+			freedBytes += worker_freed
+			mu.Unlock()
+		}()
+	}
+	for _, candidate := range candidates {
+		pages <- candidate
+	}
+	close(pages)
+	wg.Wait()
+
+	return purged, freedBytes
 }
 
 // These two data structures are maintained for all pages with a
@@ -216,90 +1267,294 @@ func (lru *LRU_K[T]) Cleanup(key T) {
 // Information Period. An asynchronous demon process should
 // purge history control blocks that are no longer justified under
 // the retained information criterion.
+//
+// StartCleanup runs the demon until the process exits, use
+// StartCleanupContext to be able to stop it.
 func (lru *LRU_K[T]) StartCleanup() {
+	lru.StartCleanupContext(context.Background())
+}
+
+// StartCleanupContext runs the demon, a CleanupPass every
+// CleanupInterval, or as adapted with MaxCleanupInterval, until ctx is
+// done. It returns once ctx is done, at the latest when the pass running
+// at that moment ends, so a server shutting down can cancel ctx and wait
+// for the goroutine running it to exit. It panics for a cache made with
+// NewLRUNoLock, which has to call CleanupPass itself.
+func (lru *LRU_K[T]) StartCleanupContext(ctx context.Context) {
+	if lru.CleanupInterval <= 0 {
+		panic("cleanup interval has to be greater than 0")
+	}
+	if lru.unlocked() {
+		panic("a cache made with NewLRUNoLock cannot run the demon on another goroutine")
+	}
+
 	cleanupInterval := lru.CleanupInterval
-	for {
-		time.Sleep(cleanupInterval)
+	var ticks <-chan time.Time
+	var ticker *time.Ticker
+	if lru.sleep == nil {
+		ticker = time.NewTicker(cleanupInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
 
-		for page := range lru.Buffer {
-			lru.Mu.Lock()
-			backward_K_Distance := lru.HIST.get(page, lru.K-1)
-			lru.Mu.Unlock()
-			if backward_K_Distance > lru.RIP {
-				go lru.Cleanup(page)
+	for {
+		if lru.sleep != nil {
+			lru.sleep(cleanupInterval)
+			if ctx.Err() != nil {
+				return
+			}
+		} else {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticks:
 			}
 		}
+
+		resident := lru.Size()
+		purged, _ := lru.CleanupPass()
+		next := lru.nextCleanupInterval(cleanupInterval, purged, resident)
+		if next != cleanupInterval && ticker != nil {
+			ticker.Reset(next)
+		}
+		cleanupInterval = next
 	}
 }
+
+// nextCleanupInterval returns how long the demon sleeps after a pass
+// that purged purged of resident pages, see MinCleanupInterval.
+func (lru *LRU_K[T]) nextCleanupInterval(interval time.Duration, purged, resident int) time.Duration {
+	if lru.MaxCleanupInterval <= 0 {
+		return lru.CleanupInterval
+	}
+
+	switch {
+	case purged == 0:
+		interval *= 2
+	case purged*4 >= resident:
+		interval /= 2
+	}
+	return min(max(interval, lru.MinCleanupInterval, time.Nanosecond), lru.MaxCleanupInterval)
+}
+
+// Set stores data under key and records a reference to it. A nil data
+// is a tombstone: Set(key, nil) removes the page together with its
+// history, as Cleanup does, and reports true. Store an empty non-nil
+// slice to keep a page that holds no data.
 func (lru *LRU_K[T]) Set(key T, data []byte) (success bool) {
-	lru.Mu.Lock()
-	defer lru.Mu.Unlock()
+	return lru.SetAt(key, data, time.Now().Unix())
+}
 
-	t := time.Now().Unix()
-	_, present := lru.Buffer[key]
-	if present {
-		time_of_last_reference := lru.LAST.get(key)
-
-		// The system should not drop a page immediately after
-		// its first reference, but should keep the page around for a
-		// short period until the likelihood of a dependent follow-up
-		// reference is minimal; then the page can be dropped.
-		// At the same time, interarrival time should be calculated based
-		// on non-correlated access pairs, where each successive access by
-		// the same process within a time-out period is assumed to be correlated
-		// the relationship is transitive. We refer to this approach, which associates
-		// correlated references, as the Time-Out Correlation method;
-		// and we refer to the time-out period as the Correlated Reference Period.
-		//
-		// If a reference to a page p is made several
-		// times during a Correlated Reference Period, we do not
-		//  want to penalize or credit the page for that.
-		if t-time_of_last_reference > lru.CRP {
-			correl_period_of_refd_page := lru.LAST.get(key) - lru.HIST.get(key, 0)
-
-			for i := 1; i < lru.K; i++ {
-				prev_reference_time := lru.HIST.get(key, i-1)
-				lru.HIST.set(key, i, prev_reference_time+correl_period_of_refd_page)
-			}
+// SetAt is Set referencing key at time t instead of the current time,
+// see GetAt, and panics as GetAt does for a t that is not greater than
+// 0. It reports false when Admit rejects the page or the buffer is full
+// and CanEvict vetoes every page.
+func (lru *LRU_K[T]) SetAt(key T, data []byte, t int64) (success bool) {
+	if t <= 0 {
+		panic("t has to be greater than 0")
+	}
 
-			lru.HIST.set(key, 0, t)
-			lru.LAST.set(key, t)
-		} else {
-			lru.LAST.set(key, t)
-		}
+	lru.lock()
+	defer lru.unlock()
+	if lru.EnableTiming {
+		defer lru.latency.record(time.Now())
+	}
 
-		lru.Buffer[key] = data
+	if data == nil {
+		lru.purge(key)
+		return true
+	}
+	_, admitted := lru.set(key, data, t)
+	return admitted
+}
+
+// SetWithK is Set for a page that keeps its own K references instead
+// of the global K, e.g. index pages that deserve a longer history. The
+// page keeps that K until its history is purged. A page the Set does
+// not store, because Admit rejects it or no page can be evicted, keeps
+// the K it had.
+func (lru *LRU_K[T]) SetWithK(key T, data []byte, k int) (success bool) {
+	if k <= 0 {
+		panic("k has to be greater than 0")
+	}
+
+	lru.lock()
+	defer lru.unlock()
+
+	if data == nil {
+		lru.purge(key)
+		return true
+	}
+	_, admitted := lru.setK(key, data, time.Now().Unix(), k)
+	return admitted
+}
+
+// applyK gives key its own K, resizing a history it already has, unless
+// k is 0.
+func (lru *LRU_K[T]) applyK(key T, k int) {
+	if k == 0 {
+		return
+	}
+	if lru.pageK == nil {
+		lru.pageK = make(map[T]int)
+	}
+	lru.pageK[key] = k
+	if lru.HIST.exists(key) && lru.HIST.length(key) != k {
+		lru.HIST.resize(key, k)
+	}
+}
+
+// ReplayAt references key at time t instead of the current time, keeping
+// the data of a resident page. It lets tests feed a reference string
+// with exact timestamps, such as the worked examples of the LRU-K paper.
+// A page that is not resident is stored with empty data, not with the
+// nil of a tombstone, so Lookup reports it as a Hit. Like GetAt it
+// panics for a t that is not greater than 0.
+func (lru *LRU_K[T]) ReplayAt(key T, t int64) {
+	if t <= 0 {
+		panic("t has to be greater than 0")
+	}
+
+	lru.lock()
+	defer lru.unlock()
+
+	data, present := lru.Buffer[key]
+	if !present {
+		data = []byte{}
+	}
+	expires, negative := lru.absent[key]
+	lru.set(key, data, t)
+	if negative {
+		lru.absent[key] = expires
+	}
+}
+
+// Reference records an access to a resident page without touching its
+// data, the way a buffer manager reports a page being pinned: LAST is
+// updated and, outside the CRP, HIST is shifted. It returns false, and
+// records nothing, if the page is not resident.
+func (lru *LRU_K[T]) Reference(key T) bool {
+	lru.lock()
+	defer lru.unlock()
+
+	if _, present := lru.Buffer[key]; !present {
+		return false
+	}
+	lru.reference(key, time.Now().Unix())
+	return true
+}
+
+// SetClassified is Set that also reports how the reference was
+// classified: correlated when the page was referenced again within the
+// CRP, so its history was left alone, and uncorrelated when the history
+// was shifted or the page was not buffer resident. Over a workload the
+// share of correlated references shows whether CRP is set too high or
+// too low. A nil data removes the page as Set does and is not a
+// correlated reference.
+func (lru *LRU_K[T]) SetClassified(key T, data []byte) (correlated bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if data == nil {
+		lru.purge(key)
+		return false
+	}
+	correlated, _ = lru.set(key, data, time.Now().Unix())
+	return correlated
+}
+
+// reference records a reference at time t to key, which has to be
+// resident, and reports whether it was correlated with the previous
+// one. It must be called with Mu held.
+func (lru *LRU_K[T]) reference(key T, t int64) (correlated bool) {
+	time_of_last_reference := lru.LAST.get(key)
+
+	// The system should not drop a page immediately after
+	// its first reference, but should keep the page around for a
+	// short period until the likelihood of a dependent follow-up
+	// reference is minimal; then the page can be dropped.
+	// At the same time, interarrival time should be calculated based
+	// on non-correlated access pairs, where each successive access by
+	// the same process within a time-out period is assumed to be correlated
+	// the relationship is transitive. We refer to this approach, which associates
+	// correlated references, as the Time-Out Correlation method;
+	// and we refer to the time-out period as the Correlated Reference Period.
+	//
+	// If a reference to a page p is made several
+	// times during a Correlated Reference Period, we do not
+	//  want to penalize or credit the page for that.
+	if !lru.withinCRP(t, time_of_last_reference) && lru.HIST.length(key) == 1 {
+		// With K=1 there is no older history to shift, so the
+		// correlation period is never needed.
+		lru.HIST.set(key, 0, t)
+		lru.LAST.set(key, t)
+	} else if !lru.withinCRP(t, time_of_last_reference) {
+		correl_period_of_refd_page := lru.LAST.get(key) - lru.HIST.get(key, 0)
+
+		lru.shiftHistory(key, t, correl_period_of_refd_page)
+		lru.LAST.set(key, t)
 	} else {
-		if len(lru.Buffer) < lru.Capacity {
-			lru.Buffer[key] = data
+		lru.LAST.set(key, t)
+		correlated = true
+	}
+	return correlated
+}
 
-			lru.LAST.set(key, t)
-			lru.HIST.init(key, lru.K)
-			lru.HIST.set(key, 0, t)
+// set records a reference to key at time t and stores data. It reports
+// false, changing nothing, when Admit rejects a new page or the buffer
+// is full and CanEvict vetoes every page. It must be called with Mu
+// held.
+func (lru *LRU_K[T]) set(key T, data []byte, t int64) (correlated bool, admitted bool) {
+	return lru.setK(key, data, t, 0)
+}
 
-		} else if len(lru.Buffer) >= lru.Capacity {
-			victim := lru.FindVictim(t)
-			log.Println("find victim has reuturned this", victim)
-			delete(lru.Buffer, victim)
-			lru.LAST.delete(victim)
-
-			log.Println("victim evicted")
-
-			lru.Buffer[key] = data
-			if !lru.HIST.exists(key) {
-				lru.HIST.init(key, lru.K)
-			} else {
-				for i := 1; i < lru.K; i++ {
-					prev_reference_time := lru.HIST.get(key, i-1)
-					lru.HIST.set(key, i, prev_reference_time)
-				}
+// setK is set giving key its own K, see SetWithK, once the page is
+// known to be stored; 0 leaves the K of the page as it is.
+func (lru *LRU_K[T]) setK(key T, data []byte, t int64, k int) (correlated bool, admitted bool) {
+	_, present := lru.Buffer[key]
+	if present {
+		lru.applyK(key, k)
+		delete(lru.absent, key)
+		correlated = lru.reference(key, t)
+		lru.Buffer[key] = data
+	} else {
+		if lru.Admit != nil && !lru.Admit(key, data) {
+			return false, false
+		}
+
+		var victim T
+		if len(lru.Buffer) >= lru.Capacity {
+			var found bool
+			if victim, found = lru.nextVictim(t); !found {
+				return false, false
 			}
+		}
+
+		lru.applyK(key, k)
+		delete(lru.absent, key)
+		lru.admissions++
+		if lru.HIST.exists(key) && !lru.beyondRIP(key, t) {
+			lru.readmissions++
+		}
+
+		if len(lru.Buffer) >= lru.Capacity {
+			lru.displace(victim)
+		}
 
+		// History retained for a page that was evicted earlier is reused
+		// whether or not an eviction was needed to make room for it, the
+		// retained information period would be pointless otherwise.
+		lru.Buffer[key] = data
+		if !lru.HIST.exists(key) {
+			lru.HIST.init(key, lru.kFor(key))
 			lru.HIST.set(key, 0, t)
-			lru.LAST.set(key, t)
+		} else {
+			lru.shiftHistory(key, t, 0)
 		}
 
-	}
-	return true
+		lru.LAST.set(key, t)
 
+		lru.trimHistory()
+	}
+	return correlated, true
 }
@@ -2,10 +2,16 @@ package lrukgo
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"math"
+	"reflect"
+	"runtime"
 	"sync"
 	"testing"
 	"time"
+
+	"cache_go/cachetest"
 )
 
 // --- Helper Functions ---
@@ -188,12 +194,38 @@ func TestNewLRU(t *testing.T) {
 	if lru.HIST == nil {
 		t.Error("NewLRU did not initialize HIST")
 	}
-	
+
 	if lru.CleanupInterval != 2*time.Minute {
 		t.Errorf("Expected CleanupInterval to be 2 minutes, got %v", lru.CleanupInterval)
 	}
 }
 
+// TestLRUK_CRPZero tests that with a CRP of 0 two references within the
+// same second are independent, both shifting the history
+func TestLRUK_CRPZero(t *testing.T) {
+	lru := NewLRU[string](2, 2, 0)
+	lru.SetAt("a", []byte("data-a"), 100)
+	lru.GetAt("a", 100)
+	if lru.HIST.get("a", 0) != 100 || lru.HIST.get("a", 1) != 100 {
+		t.Errorf("Expected HIST [100 100], got [%d %d]", lru.HIST.get("a", 0), lru.HIST.get("a", 1))
+	}
+
+	// a's K-th reference is known, b's is not, so b is the victim even
+	// though it was referenced in the same second as c arrives.
+	lru.SetAt("b", []byte("data-b"), 100)
+	lru.SetAt("c", []byte("data-c"), 100)
+	if _, present := lru.Buffer["b"]; present {
+		t.Error("Expected b to be evicted by backward K-distance alone")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a negative CRP to panic")
+		}
+	}()
+	NewLRU[string](2, 2, -1)
+}
+
 func TestLRUK_Get_Empty(t *testing.T) {
 	lru := NewLRU[string](2, 10, 60)
 	_, present := lru.Get("nonExistentKey")
@@ -299,7 +331,7 @@ func TestLRUK_Set_UpdateExisting_OutsideCRP(t *testing.T) {
 	lru.Mu.Unlock()
 
 	// Pause to ensure we are outside CRP
-	time.Sleep(2*time.Second) // Wait longer than CRP
+	time.Sleep(2 * time.Second) // Wait longer than CRP
 
 	// Update Set (outside CRP)
 	currentTime := time.Now().Unix() // Capture approx current time for HIST[0] check
@@ -513,6 +545,27 @@ func TestLRUK_Set_Eviction_NewKey_HistExists(t *testing.T) {
 	lru.Mu.Unlock()
 }
 
+// TestLRUK_Set_FreeSpace_HistExists tests that a page readmitted into
+// free space reuses the history retained since its eviction
+func TestLRUK_Set_FreeSpace_HistExists(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	lru.SetAt("a", []byte("data-a"), 100)
+	lru.SetAt("b", []byte("data-b"), 200) // evicts a, its history is retained
+	if _, present := lru.Buffer["a"]; present || !lru.HIST.exists("a") {
+		t.Fatal("Expected a to be evicted with its history retained")
+	}
+
+	lru.Cleanup("b") // frees the only page without touching a's history
+	lru.SetAt("a", []byte("data-a"), 300)
+
+	if lru.HIST.get("a", 0) != 300 || lru.HIST.get("a", 1) != 100 {
+		t.Errorf("Expected HIST [300 100], got [%d %d]", lru.HIST.get("a", 0), lru.HIST.get("a", 1))
+	}
+	if stats := lru.Stats(); stats.Evictions != 1 {
+		t.Errorf("Expected no eviction for the readmission, got %d", stats.Evictions)
+	}
+}
+
 func TestLRUK_Cleanup_Method(t *testing.T) {
 	lru := NewLRU[string](2, 10, 60)
 	lru.Buffer = make(map[string][]byte) // Initialize
@@ -555,41 +608,39 @@ func TestLRUK_StartCleanup_Logic_TriggersCleanup(t *testing.T) {
 	rip := int64(100) // Retained Information Period
 	lru := NewLRU[string](k, 10, 60)
 	lru.RIP = rip
+	now := int64(1000)
 
 	keyToCleanup := "keyClean"
 	keyToKeep := "keyKeep"
 
-	// Setup keyToCleanup: K-th history is older than RIP
+	// Setup keyToCleanup: K-th reference is older than RIP
 	lru.Buffer[keyToCleanup] = []byte("clean_data")
 	lru.HIST.init(keyToCleanup, k)
-	lru.HIST.set(keyToCleanup, k-1, rip-50) // K-th distance is rip-50 (which is < RIP, means should be kept based on rule)
-	// Wait, the rule is `backward_K_Distance > lru.RIP`
-	// So backward_K_Distance should be > rip
-	lru.HIST.set(keyToCleanup, k-1, rip+50) // K-th distance > RIP
-	lru.LAST.set(keyToCleanup, time.Now().Unix())
+	lru.HIST.set(keyToCleanup, k-1, now-rip-50) // now - HIST(p,K) > RIP
+	lru.LAST.set(keyToCleanup, now)
 
-	// Setup keyToKeep: K-th history is not older than RIP
+	// Setup keyToKeep: K-th reference is not older than RIP
 	lru.Buffer[keyToKeep] = []byte("keep_data")
 	lru.HIST.init(keyToKeep, k)
-	lru.HIST.set(keyToKeep, k-1, rip-10) // K-th distance < RIP
-	lru.LAST.set(keyToKeep, time.Now().Unix())
+	lru.HIST.set(keyToKeep, k-1, now-rip+10) // now - HIST(p,K) < RIP
+	lru.LAST.set(keyToKeep, now)
 
 	// Simulate one pass of the StartCleanup loop's logic
 	// We collect keys that would be cleaned up to avoid issues with concurrent map modification if testing the actual loop
 
 	// Check keyToCleanup
 	lru.Mu.Lock()
-	bkdClean := lru.HIST.get(keyToCleanup, k-1)
+	clean := lru.beyondRIP(keyToCleanup, now)
 	lru.Mu.Unlock()
-	if bkdClean > lru.RIP {
+	if clean {
 		lru.Cleanup(keyToCleanup) // Manually call cleanup as the go routine would
 	}
 
 	// Check keyToKeep
 	lru.Mu.Lock()
-	bkdKeep := lru.HIST.get(keyToKeep, k-1)
+	keep := !lru.beyondRIP(keyToKeep, now)
 	lru.Mu.Unlock()
-	if bkdKeep > lru.RIP {
+	if !keep {
 		lru.Cleanup(keyToKeep)
 	}
 
@@ -671,6 +722,67 @@ func TestLRUK_FindVictim_AllWithinCRP(t *testing.T) {
 	lru.HIST.init(key2, k)
 	lru.HIST.set(key2, k-1, currentTime-100)
 
+	// No page is eligible, the least recently used one is forced out
+	if victim := lru.FindVictim(currentTime); victim != key1 {
+		t.Errorf("Expected the least recently used page %s as fallback victim, got '%s'", key1, victim)
+	}
+
+	lru.set("key3", []byte("data3"), currentTime)
+	lru.set("key4", []byte("data4"), currentTime)
+	if len(lru.Buffer) > cap {
+		t.Errorf("Expected the buffer to stay within capacity %d, got %d", cap, len(lru.Buffer))
+	}
+	if _, present := lru.Buffer[key1]; present {
+		t.Errorf("Expected %s to be evicted first", key1)
+	}
+	if _, present := lru.Buffer["key4"]; !present {
+		t.Error("Expected the newest page to be resident")
+	}
+}
+
+// TestLRUK_FindVictim_AllWithinCRPOldestKth tests that when every page is
+// within the CRP the page with the oldest K-th reference is evicted, not
+// the least recently used one, and the buffer stays at capacity
+func TestLRUK_FindVictim_AllWithinCRPOldestKth(t *testing.T) {
+	k := 2
+	cap := 3
+	crp := int64(600)
+	lru := NewLRU[string](k, cap, crp)
+
+	currentTime := time.Now().Unix()
+	pages := []struct {
+		key  string
+		last int64
+		kth  int64
+	}{
+		{"key1", currentTime - 30, currentTime - 1000},
+		{"key2", currentTime - 20, currentTime - 3000}, // oldest K-th reference
+		{"key3", currentTime - 10, currentTime - 2000},
+	}
+	for _, page := range pages {
+		lru.Buffer[page.key] = []byte(page.key)
+		lru.LAST.set(page.key, page.last) // Within CRP
+		lru.HIST.init(page.key, k)
+		lru.HIST.set(page.key, 0, page.last)
+		lru.HIST.set(page.key, k-1, page.kth)
+	}
+
+	if victim := lru.FindVictim(currentTime); victim != "key2" {
+		t.Errorf("Expected key2, the page with the oldest K-th reference, got '%s'", victim)
+	}
+
+	if !lru.SetAt("key4", []byte("data4"), currentTime) {
+		t.Fatal("Expected the Set to succeed")
+	}
+	if lru.Size() != cap {
+		t.Errorf("Expected the buffer to stay at capacity %d, got %d", cap, lru.Size())
+	}
+	if _, present := lru.Buffer["key2"]; present {
+		t.Error("Expected key2 to be evicted")
+	}
+	if _, present := lru.Buffer["key4"]; !present {
+		t.Error("Expected key4 to be resident")
+	}
 }
 
 func TestLRUK_Set_KEqualsOne(t *testing.T) {
@@ -770,7 +882,7 @@ func TestConcurrentAccess(t *testing.T) {
 			defer wg.Done()
 			for j := 0; j < opsPerGoroutine; j++ {
 				key := fmt.Sprintf("key-%d-%d", id, j%3) // Using modulo to create key collisions
-				
+
 				// Mix of operations: set and get
 				if j%2 == 0 {
 					success := lru.Set(key, testData)
@@ -787,9 +899,9 @@ func TestConcurrentAccess(t *testing.T) {
 	}
 
 	wg.Wait()
-	
+
 	// Check that the cache size is correct
-	if lru.Size()> lru.Capacity {
+	if lru.Size() > lru.Capacity {
 		t.Errorf("Cache exceeded capacity: %d items in a cache with capacity %d", lru.Size(), lru.Capacity)
 	}
 }
@@ -798,10 +910,10 @@ func TestConcurrentAccess(t *testing.T) {
 func TestConcurrentSetWithEviction(t *testing.T) {
 	// Create a cache with small size to force evictions
 	lru := NewLRU[string](2, 2, 5) // K=2, Capacity=2, CRP=5
-	
+
 	var wg sync.WaitGroup
 	numGoroutines := 4
-	
+
 	// Each goroutine will add unique keys
 	for i := 0; i < numGoroutines; i++ {
 		wg.Add(1)
@@ -812,15 +924,15 @@ func TestConcurrentSetWithEviction(t *testing.T) {
 				key := fmt.Sprintf("g%d-key%d", id, j)
 				data := []byte(fmt.Sprintf("data for %s", key))
 				lru.Set(key, data)
-				
+
 				// Small sleep to allow other goroutines to interleave
 				time.Sleep(1 * time.Millisecond)
 			}
 		}(i)
 	}
-	
+
 	wg.Wait()
-	
+
 	// Verify cache size is within limits
 	if lru.Size() > lru.Capacity {
 		t.Errorf("Cache size exceeds capacity after concurrent operations")
@@ -831,15 +943,15 @@ func TestConcurrentSetWithEviction(t *testing.T) {
 func TestConcurrentReadWrite(t *testing.T) {
 	// Create a moderately sized cache
 	lru := NewLRU[int](2, 5, 10) // K=2, Capacity=5, CRP=10
-	
+
 	// Prepare initial data
 	for i := 0; i < 3; i++ {
 		lru.Set(i, []byte(fmt.Sprintf("initial data %d", i)))
 	}
-	
+
 	var wg sync.WaitGroup
 	done := make(chan struct{})
-	
+
 	// Start reader goroutines that continuously read
 	for i := 0; i < 3; i++ {
 		wg.Add(1)
@@ -857,7 +969,7 @@ func TestConcurrentReadWrite(t *testing.T) {
 			}
 		}()
 	}
-	
+
 	// Start writer goroutines that continuously write
 	for i := 0; i < 2; i++ {
 		wg.Add(1)
@@ -877,12 +989,12 @@ func TestConcurrentReadWrite(t *testing.T) {
 			}
 		}(i)
 	}
-	
+
 	// Let the test run for a short duration
 	time.Sleep(100 * time.Millisecond)
 	close(done)
 	wg.Wait()
-	
+
 	// Verify cache is in a consistent state
 	if len(lru.Buffer) > lru.Capacity {
 		t.Errorf("Cache size exceeded capacity during concurrent read/write operations")
@@ -892,13 +1004,13 @@ func TestConcurrentReadWrite(t *testing.T) {
 // TestCleanupConcurrency tests the cleanup routine running concurrently with cache operations
 func TestCleanupConcurrency(t *testing.T) {
 	// Create a cache with a short cleanup interval for testing
-	lru := NewLRU[string](2, 5, 10) // K=2, Capacity=5, CRP=10
+	lru := NewLRU[string](2, 5, 10)             // K=2, Capacity=5, CRP=10
 	lru.CleanupInterval = 20 * time.Millisecond // Short interval for testing
-	lru.RIP = 5 // Short Retained Information Period for testing
-	
+	lru.RIP = 5                                 // Short Retained Information Period for testing
+
 	// Start the cleanup goroutine
 	go lru.StartCleanup()
-	
+
 	// Perform operations while cleanup is running
 	var wg sync.WaitGroup
 	for i := 0; i < 3; i++ {
@@ -908,15 +1020,15 @@ func TestCleanupConcurrency(t *testing.T) {
 			for j := 0; j < 50; j++ {
 				key := fmt.Sprintf("key-%d-%d", id, j%5)
 				data := []byte(fmt.Sprintf("data for %s", key))
-				
+
 				// Set the data
 				lru.Set(key, data)
-				
+
 				// Sometimes get the data
 				if j%3 == 0 {
 					lru.Get(key)
 				}
-				
+
 				// Sleep to allow cleanup to run
 				if j%10 == 0 {
 					time.Sleep(25 * time.Millisecond)
@@ -924,12 +1036,1411 @@ func TestCleanupConcurrency(t *testing.T) {
 			}
 		}(i)
 	}
-	
+
 	wg.Wait()
-	
+
 	// Final verification
-	if len(lru.Buffer) > lru.Capacity {
+	if lru.Size() > lru.Capacity {
 		t.Errorf("Cache exceeded capacity during cleanup test")
 	}
 }
 
+// TestLRUK_BackwardKDistances tests the Backward K-distance snapshot
+func TestLRUK_BackwardKDistances(t *testing.T) {
+	k := 2
+	lru := NewLRU[string](k, 10, 60)
+
+	lru.Buffer["full"] = []byte("full")
+	lru.HIST.init("full", k)
+	lru.HIST.set("full", 0, 90)
+	lru.HIST.set("full", k-1, 40)
+	lru.LAST.set("full", 90)
+
+	// Only one reference known, so its Backward K-distance is infinite
+	lru.Buffer["partial"] = []byte("partial")
+	lru.HIST.init("partial", k)
+	lru.HIST.set("partial", 0, 95)
+	lru.LAST.set("partial", 95)
+
+	// History retained for a page that is no longer buffer resident
+	lru.HIST.init("ghost", k)
+	lru.HIST.set("ghost", 0, 80)
+	lru.HIST.set("ghost", k-1, 70)
+
+	distances := lru.BackwardKDistances(100)
+	if len(distances) != 1 {
+		t.Fatalf("Expected 1 distance, got %d: %v", len(distances), distances)
+	}
+	if distances["full"] != 60 {
+		t.Errorf("Expected Backward K-distance 60 for 'full', got %d", distances["full"])
+	}
+	if _, present := distances["partial"]; present {
+		t.Error("Expected 'partial' to be skipped as its history is incomplete")
+	}
+	if _, present := distances["ghost"]; present {
+		t.Error("Expected 'ghost' to be skipped as it is not buffer resident")
+	}
+}
+
+// TestLRUK_KDistance tests that KDistance reports HIST(p,K) of resident
+// pages and ghosts and does not panic for an unknown key
+func TestLRUK_KDistance(t *testing.T) {
+	lru := NewLRU[string](2, 10, 0)
+	lru.SetAt("full", []byte("full"), 40)
+	lru.SetAt("full", []byte("full"), 90)
+	lru.SetAt("partial", []byte("partial"), 95)
+	lru.SetAt("ghost", []byte("ghost"), 70)
+	lru.SetAt("ghost", []byte("ghost"), 80)
+	lru.Evict("ghost")
+
+	for _, tc := range []struct {
+		key    string
+		want   int64
+		wantOk bool
+	}{
+		{"full", 40, true},
+		{"partial", 0, true}, // Only one reference known
+		{"ghost", 70, true},
+		{"missing", 0, false},
+	} {
+		if got, ok := lru.KDistance(tc.key); got != tc.want || ok != tc.wantOk {
+			t.Errorf("KDistance(%q): expected (%d, %v), got (%d, %v)", tc.key, tc.want, tc.wantOk, got, ok)
+		}
+	}
+}
+
+// benchmarkSetOutsideCRP re-references one resident key, ageing its LAST
+// before every Set so each reference lands outside the CRP
+func benchmarkSetOutsideCRP(b *testing.B, k int) {
+	lru := NewLRU[string](k, 10, 1)
+	data := []byte("data")
+	lru.Set("key", data)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.LAST.set("key", 0)
+		lru.Set("key", data)
+	}
+}
+
+func BenchmarkLRUK_Set_K1(b *testing.B) {
+	benchmarkSetOutsideCRP(b, 1)
+}
+
+func BenchmarkLRUK_Set_K2(b *testing.B) {
+	benchmarkSetOutsideCRP(b, 2)
+}
+
+// TestLRUK_Stats tests the hit, miss and eviction counters
+func TestLRUK_Stats(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+
+	lru.Set("key1", []byte("data1"))
+	lru.Get("key1")
+	lru.Get("missing")
+
+	lru.Set("key2", []byte("data2")) // evicts key1
+	lru.Get("key1")
+
+	stats := lru.Stats()
+	if stats.Hits != 1 || stats.Misses != 2 || stats.Evictions != 1 {
+		t.Errorf("Expected 1 hit, 2 misses and 1 eviction, got %+v", stats)
+	}
+	if stats.Len != 1 || stats.Cap != 1 {
+		t.Errorf("Expected Len 1 and Cap 1, got %+v", stats)
+	}
+}
+
+// TestLRUK_Set_PartialHistory tests that unknown history slots are not turned
+// into made up timestamps when the history is shifted
+func TestLRUK_Set_PartialHistory(t *testing.T) {
+	k := 3
+	lru := NewLRU[string](k, 10, 1)
+
+	now := time.Now().Unix()
+	key := "key"
+	lru.Buffer[key] = []byte("data")
+	lru.HIST.init(key, k)
+	lru.HIST.set(key, 0, now-100) // only one reference known
+	lru.LAST.set(key, now-90)     // correlated references kept LAST moving
+
+	lru.Set(key, []byte("data"))
+
+	lru.Mu.Lock()
+	defer lru.Mu.Unlock()
+
+	hist0, hist1, hist2 := lru.HIST.get(key, 0), lru.HIST.get(key, 1), lru.HIST.get(key, 2)
+	if hist0 < now || hist0 > now+2 {
+		t.Errorf("Expected HIST[0] to be around %d, got %d", now, hist0)
+	}
+	// The old HIST[0] advanced by the correlation period (LAST - HIST[0] = 10)
+	if hist1 != now-90 {
+		t.Errorf("Expected HIST[1] to be %d, got %d", now-90, hist1)
+	}
+	if hist2 != 0 {
+		t.Errorf("Expected HIST[2] to stay unknown (0), got %d", hist2)
+	}
+}
+
+// TestLRUK_Set_HistoryClamped tests that a corrupt history can not produce a
+// reference newer than the one after it
+func TestLRUK_Set_HistoryClamped(t *testing.T) {
+	k := 2
+	lru := NewLRU[string](k, 10, 1)
+
+	now := time.Now().Unix()
+	key := "key"
+	lru.Buffer[key] = []byte("data")
+	lru.HIST.init(key, k)
+	lru.HIST.set(key, 0, math.MaxInt64-5)
+	lru.HIST.set(key, 1, now-50)
+
+	// A correlation period this large overflows when added to HIST[0]
+	lru.Mu.Lock()
+	lru.shiftHistory(key, now, math.MaxInt64)
+	hist0, hist1 := lru.HIST.get(key, 0), lru.HIST.get(key, 1)
+	lru.Mu.Unlock()
+
+	if hist0 != now {
+		t.Errorf("Expected HIST[0] to be %d, got %d", now, hist0)
+	}
+	if hist1 > hist0 {
+		t.Errorf("Expected HIST[1] (%d) to be clamped to HIST[0] (%d)", hist1, hist0)
+	}
+}
+
+// TestLRUK_FindVictim_UnknownKthReference tests that a page with fewer than K
+// known references is preferred as the victim
+func TestLRUK_FindVictim_UnknownKthReference(t *testing.T) {
+	k := 2
+	lru := NewLRU[string](k, 2, 5)
+
+	lru.Buffer["complete"] = []byte("complete")
+	lru.HIST.init("complete", k)
+	lru.HIST.set("complete", 0, 20)
+	lru.HIST.set("complete", 1, 1)
+	lru.LAST.set("complete", 20)
+
+	lru.Buffer["partial"] = []byte("partial")
+	lru.HIST.init("partial", k)
+	lru.HIST.set("partial", 0, 30)
+	lru.LAST.set("partial", 30)
+
+	if victim := lru.FindVictim(100); victim != "partial" {
+		t.Errorf("Expected 'partial' to be the victim, got '%s'", victim)
+	}
+}
+
+// TestLRUK_GhostKeys tests that evicted pages with retained history are reported
+func TestLRUK_GhostKeys(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+
+	if ghosts := lru.GhostKeys(); len(ghosts) != 0 {
+		t.Fatalf("Expected no ghosts on an empty cache, got %v", ghosts)
+	}
+
+	lru.Set("key1", []byte("data1"))
+	lru.Set("key2", []byte("data2")) // evicts key1 but keeps its history
+
+	ghosts := lru.GhostKeys()
+	if len(ghosts) != 1 || ghosts[0] != "key1" {
+		t.Errorf("Expected ghosts [key1], got %v", ghosts)
+	}
+
+	lru.Cleanup("key1")
+	if ghosts := lru.GhostKeys(); len(ghosts) != 0 {
+		t.Errorf("Expected no ghosts after Cleanup, got %v", ghosts)
+	}
+}
+
+// TestLRUK_FindVictims tests that a batch scan returns victims in eviction order
+func TestLRUK_FindVictims(t *testing.T) {
+	k := 2
+	lru := NewLRU[string](k, 10, 5)
+
+	pages := []struct {
+		key  string
+		last int64
+		kth  int64
+	}{
+		{"old", 10, 5},     // outside CRP, oldest K-th reference
+		{"middle", 20, 15}, // outside CRP
+		{"recent", 98, 1},  // inside CRP, only evicted after the others
+		{"newest", 30, 25}, // outside CRP
+	}
+	for _, p := range pages {
+		lru.Buffer[p.key] = []byte(p.key)
+		lru.HIST.init(p.key, k)
+		lru.HIST.set(p.key, 0, p.last)
+		lru.HIST.set(p.key, k-1, p.kth)
+		lru.LAST.set(p.key, p.last)
+	}
+
+	victims := lru.findVictims(100, 3)
+	expected := []string{"old", "middle", "newest"}
+	if len(victims) != len(expected) {
+		t.Fatalf("Expected %d victims, got %d", len(expected), len(victims))
+	}
+	for i, key := range expected {
+		if victims[i].page != key {
+			t.Errorf("Expected victim %d to be %s, got %s", i, key, victims[i].page)
+		}
+	}
+
+	if all := lru.findVictims(100, 10); len(all) != 4 || all[3].page != "recent" {
+		t.Errorf("Expected the page inside the CRP to be the last victim, got %v", all)
+	}
+}
+
+// TestLRUK_EvictionBatch tests that batched eviction respects capacity and
+// skips victims referenced after they were selected
+func TestLRUK_EvictionBatch(t *testing.T) {
+	k := 1
+	lru := NewLRUWithBatch[string](k, 4, 1, 2)
+
+	now := time.Now().Unix()
+	for i, key := range []string{"a", "b", "c", "d"} {
+		lru.Buffer[key] = []byte(key)
+		lru.HIST.init(key, k)
+		lru.HIST.set(key, 0, now-100+int64(i))
+		lru.LAST.set(key, now-100+int64(i))
+	}
+
+	lru.Set("e", []byte("e")) // scans once, evicts a and keeps b for later
+	if _, present := lru.Get("a"); present {
+		t.Error("Expected a to be evicted first")
+	}
+	if len(lru.victims) != 1 || lru.victims[0].page != "b" {
+		t.Fatalf("Expected b to be held as the next victim, got %v", lru.victims)
+	}
+
+	lru.Set("b", []byte("b2")) // b is referenced again, its selection is stale
+	lru.Set("f", []byte("f"))
+	if _, present := lru.Get("b"); !present {
+		t.Error("Expected b to survive as it was referenced after being selected")
+	}
+	if _, present := lru.Get("c"); present {
+		t.Error("Expected c to be evicted instead of the re-referenced b")
+	}
+	if lru.Size() != lru.Capacity {
+		t.Errorf("Expected buffer size %d, got %d", lru.Capacity, lru.Size())
+	}
+}
+
+// TestLRUK_WouldEvict tests that WouldEvict names the page the next insert
+// evicts without changing anything
+func TestLRUK_WouldEvict(t *testing.T) {
+	now := time.Now().Unix()
+	for _, batch := range []int{1, 2} {
+		lru := NewLRUWithBatch[string](1, 3, 0, batch)
+		lru.SetAt("a", []byte("a"), now-30)
+		lru.SetAt("b", []byte("b"), now-20)
+		if _, ok := lru.WouldEvict(); ok {
+			t.Errorf("batch %d: Expected no victim while the buffer has room", batch)
+		}
+
+		lru.SetAt("c", []byte("c"), now-10)
+		victim, ok := lru.WouldEvict()
+		if !ok || victim != "a" {
+			t.Errorf("batch %d: Expected a to be the next victim, got %q, %v", batch, victim, ok)
+		}
+		if lru.LAST.get("a") != now-30 || lru.Size() != 3 || lru.Stats().Evictions != 0 {
+			t.Errorf("batch %d: Expected WouldEvict to change nothing", batch)
+		}
+
+		lru.Set("d", []byte("d"))
+		if _, present := lru.Buffer[victim]; present {
+			t.Errorf("batch %d: Expected the insert to evict %s", batch, victim)
+		}
+
+		// With batching b was selected by the last scan and comes next.
+		if victim, _ := lru.WouldEvict(); victim != "b" {
+			t.Errorf("batch %d: Expected b to be the next victim, got %q", batch, victim)
+		}
+		lru.CanEvict = func(key string) bool { return false }
+		if _, ok := lru.WouldEvict(); ok {
+			t.Errorf("batch %d: Expected no victim when CanEvict vetoes every page", batch)
+		}
+	}
+}
+
+// TestLRUK_SizeConcurrent tests that Size and Len can be read while other
+// goroutines write, run with -race
+func TestLRUK_SizeConcurrent(t *testing.T) {
+	lru := NewLRU[int](2, 8, 0)
+	if lru.Size() != 0 || lru.Len() != 0 {
+		t.Fatalf("Expected an empty cache to report 0, got %d and %d", lru.Size(), lru.Len())
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				lru.SetAt(g*1000+i, []byte{}, int64(i+1))
+				if size := lru.Len(); size > lru.Capacity {
+					t.Errorf("Size %d over capacity %d", size, lru.Capacity)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	if lru.Size() != lru.Capacity {
+		t.Errorf("Expected a full cache, got %d", lru.Size())
+	}
+}
+
+// TestLRUK_Delete tests that Delete purges the page and its history and
+// reports only resident pages
+func TestLRUK_Delete(t *testing.T) {
+	lru := NewLRU[string](2, 2, 0)
+	lru.SetAt("a", []byte("data-a"), 100)
+	lru.SetAt("ghost", []byte("data"), 110)
+	lru.Evict("ghost")
+
+	if !lru.Delete("a") {
+		t.Error("Expected Delete of a resident page to report true")
+	}
+	if _, present := lru.Buffer["a"]; present || lru.HIST.exists("a") {
+		t.Error("Expected Delete to purge the page and its history")
+	}
+	if _, present := lru.LAST.last["a"]; present {
+		t.Error("Expected Delete to purge LAST")
+	}
+
+	if lru.Delete("ghost") {
+		t.Error("Expected Delete of a ghost to report false")
+	}
+	if lru.HIST.exists("ghost") {
+		t.Error("Expected Delete to purge the history of a ghost")
+	}
+	if lru.Delete("missing") || lru.Delete("a") {
+		t.Error("Expected Delete of a missing key to report false")
+	}
+	if stats := lru.Stats(); stats.Evictions != 1 || stats.Len != 0 {
+		t.Errorf("Expected only the explicit Evict counted, got %+v", stats)
+	}
+}
+
+// TestLRUK_EvictKeepsHistory tests that Evict leaves a ghost behind while
+// Cleanup purges the history too
+func TestLRUK_EvictKeepsHistory(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+	lru.SetAt("a", []byte("data-a"), 100)
+	lru.SetAt("b", []byte("data-b"), 100)
+
+	data, ok := lru.Evict("a")
+	if !ok || string(data) != "data-a" {
+		t.Fatalf("Expected (data-a, true), got (%s, %v)", data, ok)
+	}
+	if _, present := lru.Buffer["a"]; present {
+		t.Error("Expected a to leave the buffer")
+	}
+	if !lru.HIST.exists("a") || lru.LAST.get("a") != 100 {
+		t.Error("Expected Evict to keep the history of a")
+	}
+	if _, ok := lru.Evict("a"); ok {
+		t.Error("Expected Evict of a ghost to report false")
+	}
+
+	// Referenced again, a picks its history back up.
+	lru.SetAt("a", []byte("data-a"), 200)
+	if lru.HIST.get("a", 1) != 100 {
+		t.Errorf("Expected HIST(a,2) 100, got %d", lru.HIST.get("a", 1))
+	}
+
+	lru.Cleanup("b")
+	if lru.HIST.exists("b") {
+		t.Error("Expected Cleanup to purge the history of b")
+	}
+}
+
+// TestLRUK_OnEvictDetailed tests that victims of Set and Evict are reported
+// with their history before they are removed
+func TestLRUK_OnEvictDetailed(t *testing.T) {
+	lru := NewLRU[string](2, 2, 0)
+	var evicted []string
+	lru.OnEvictDetailed = func(key string, data []byte, history []int64) {
+		if _, resident := lru.Buffer[key]; !resident {
+			t.Errorf("Expected %s to still be resident when reported", key)
+		}
+		evicted = append(evicted, fmt.Sprintf("%s=%s%v", key, data, history))
+		history[0] = -1 // a copy, HIST is unaffected
+	}
+
+	lru.SetAt("a", []byte("data-a"), 100)
+	lru.SetAt("a", []byte("data-a"), 150)
+	lru.SetAt("b", []byte("data-b"), 200)
+	lru.SetAt("c", []byte("data-c"), 300) // b has no second reference and goes
+	lru.Evict("a")
+	lru.Evict("a")
+
+	want := []string{"b=data-b[200 0]", "a=data-a[150 100]"}
+	if !reflect.DeepEqual(evicted, want) {
+		t.Errorf("Expected %v, got %v", want, evicted)
+	}
+	if lru.HIST.get("a", 0) != 150 {
+		t.Error("Expected the history handed to OnEvictDetailed to be a copy")
+	}
+}
+
+// TestLRUK_PurgeHistoryBefore tests that only ghosts last referenced
+// before the cutoff lose their history
+func TestLRUK_PurgeHistoryBefore(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	lru.SetAt("old", []byte("data"), 100)
+	lru.SetAt("recent", []byte("data"), 200)   // evicts old
+	lru.SetAt("resident", []byte("data"), 300) // evicts recent
+
+	if purged := lru.PurgeHistoryBefore(200); purged != 1 {
+		t.Errorf("Expected 1 history purged, got %d", purged)
+	}
+	if lru.HIST.exists("old") || !lru.HIST.exists("recent") {
+		t.Error("Expected only the history of old to be purged")
+	}
+
+	// A cutoff past every reference still leaves resident pages alone.
+	if purged := lru.PurgeHistoryBefore(1000); purged != 1 {
+		t.Errorf("Expected 1 history purged, got %d", purged)
+	}
+	if !lru.HIST.exists("resident") || lru.HistoryLen() != 1 {
+		t.Error("Expected only the resident page to keep its history")
+	}
+}
+
+// TestLRUK_SetNil tests that Set(key, nil) removes the page and its history
+func TestLRUK_SetNil(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+	lru.Set("a", []byte("data-a"))
+	lru.Set("empty", []byte{})
+
+	if !lru.Set("a", nil) {
+		t.Error("Expected Set(key, nil) to report success")
+	}
+	if _, ok := lru.Get("a"); ok {
+		t.Error("Expected a to be gone after Set(key, nil)")
+	}
+	if lru.HIST.exists("a") {
+		t.Error("Expected the history of a to be purged")
+	}
+
+	// An empty slice is a page like any other.
+	if data, ok := lru.Get("empty"); !ok || data == nil || len(data) != 0 {
+		t.Errorf("Expected an empty page, got (%v, %v)", data, ok)
+	}
+
+	// Deleting a missing key is harmless.
+	if !lru.Set("missing", nil) || lru.Size() != 1 {
+		t.Error("Expected Set(missing, nil) to leave the cache as it was")
+	}
+}
+
+func benchmarkChurn(b *testing.B, batch int) {
+	capacity := 5000
+	lru := NewLRUWithBatch[int](2, capacity, 1, batch)
+	for i := 0; i < capacity; i++ {
+		lru.Set(i, []byte{})
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lru.Set(capacity+i, []byte{})
+	}
+}
+
+func BenchmarkLRUK_Churn_Batch1(b *testing.B) {
+	benchmarkChurn(b, 1)
+}
+
+func BenchmarkLRUK_Churn_Batch64(b *testing.B) {
+	benchmarkChurn(b, 64)
+}
+
+// TestLRUK_SetClassified tests the correlated/uncorrelated classification
+func TestLRUK_SetClassified(t *testing.T) {
+	lru := NewLRU[string](2, 10, 60)
+
+	if lru.SetClassified("key", []byte("data")) {
+		t.Error("A first reference can not be correlated")
+	}
+	if !lru.SetClassified("key", []byte("data")) {
+		t.Error("A second reference within the CRP should be correlated")
+	}
+
+	// Move the last reference back past the CRP
+	lru.Mu.Lock()
+	lru.LAST.set("key", time.Now().Unix()-120)
+	lru.Mu.Unlock()
+
+	if lru.SetClassified("key", []byte("data")) {
+		t.Error("A reference outside the CRP should not be correlated")
+	}
+}
+
+// TestLRUK_Cleanup_Reports tests the freed bytes and existed results of Cleanup
+func TestLRUK_Cleanup_Reports(t *testing.T) {
+	lru := NewLRU[string](2, 10, 60)
+	lru.Set("key", []byte("12345"))
+
+	freed, existed := lru.Cleanup("key")
+	if !existed || freed != 5 {
+		t.Errorf("Expected (5, true), got (%d, %v)", freed, existed)
+	}
+
+	freed, existed = lru.Cleanup("key")
+	if existed || freed != 0 {
+		t.Errorf("Expected (0, false) for a purged key, got (%d, %v)", freed, existed)
+	}
+
+	// A ghost has history but no data
+	lru.HIST.init("ghost", 2)
+	freed, existed = lru.Cleanup("ghost")
+	if !existed || freed != 0 {
+		t.Errorf("Expected (0, true) for a ghost, got (%d, %v)", freed, existed)
+	}
+}
+
+// TestLRUK_CleanupPass tests that a pass sums the purged pages and bytes
+func TestLRUK_CleanupPass(t *testing.T) {
+	k := 2
+	lru := NewLRU[string](k, 10, 60)
+	lru.RIP = 100
+	lru.now = func() int64 { return 300 }
+
+	for key, kth := range map[string]int64{"purge1": 150, "purge2": 100, "keep": 250} {
+		lru.Buffer[key] = []byte(key)
+		lru.HIST.init(key, k)
+		lru.HIST.set(key, k-1, kth)
+		lru.LAST.set(key, kth)
+	}
+
+	purged, freed := lru.CleanupPass()
+	if purged != 2 || freed != len("purge1")+len("purge2") {
+		t.Errorf("Expected 2 pages and %d bytes purged, got %d pages and %d bytes", len("purge1")+len("purge2"), purged, freed)
+	}
+	if _, present := lru.Get("keep"); !present {
+		t.Error("Expected 'keep' to survive the pass")
+	}
+}
+
+// TestLRUK_CleanupRechecksUnderLock tests that a page Set again between
+// the cleanup decision and the purge survives, for either worker path
+func TestLRUK_CleanupRechecksUnderLock(t *testing.T) {
+	for _, workers := range []int{1, 2} {
+		k := 2
+		lru := NewLRU[string](k, 10, 0)
+		lru.RIP = 100
+		lru.CleanupConcurrency = workers
+		for _, key := range []string{"stale", "reset", "gone"} {
+			lru.Buffer[key] = []byte(key)
+			lru.HIST.init(key, k)
+			lru.HIST.set(key, k-1, 150)
+			lru.LAST.set(key, 150)
+		}
+
+		candidates := lru.purgeCandidates(300)
+		if len(candidates) != 3 {
+			t.Fatalf("Expected 3 candidates, got %d", len(candidates))
+		}
+		lru.SetAt("reset", []byte("fresh"), 160)
+		lru.Delete("gone")
+
+		purged, _ := lru.purgeAll(candidates, 300)
+		if purged != 1 {
+			t.Errorf("workers %d: Expected only stale purged, got %d pages", workers, purged)
+		}
+		if data, present := lru.Buffer["reset"]; !present || string(data) != "fresh" {
+			t.Errorf("workers %d: Expected the page Set again to survive the stale cleanup", workers)
+		}
+		if _, present := lru.Buffer["stale"]; present {
+			t.Errorf("workers %d: Expected stale to be purged", workers)
+		}
+	}
+}
+
+// TestLRUK_ThrashRate tests that re-admitting evicted pages raises the thrash rate
+func TestLRUK_ThrashRate(t *testing.T) {
+	lru := NewLRU[string](1, 1, 1)
+	lru.RIP = 3600
+
+	if rate := lru.ThrashRate(); rate != 0 {
+		t.Errorf("Expected 0 thrash rate before any admission, got %f", rate)
+	}
+
+	lru.Set("a", []byte("a")) // admission
+	lru.Set("b", []byte("b")) // admission, a is evicted
+	lru.Set("a", []byte("a")) // re-admission within RIP, b is evicted
+	lru.Set("b", []byte("b")) // re-admission within RIP
+
+	if rate := lru.ThrashRate(); rate != 0.5 {
+		t.Errorf("Expected thrash rate 0.5, got %f", rate)
+	}
+
+	// History older than the RIP does not count as thrashing
+	lru.Mu.Lock()
+	lru.HIST.set("a", 0, time.Now().Unix()-7200)
+	lru.Mu.Unlock()
+	lru.Set("a", []byte("a"))
+
+	if rate := lru.ThrashRate(); rate != 0.4 {
+		t.Errorf("Expected thrash rate 0.4, got %f", rate)
+	}
+}
+
+// TestLRUK_SetWithK tests that pages stored with their own K keep that
+// many references and that FindVictim uses each page's own HIST(p,K)
+func TestLRUK_SetWithK(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.SetWithK("index", []byte("i"), 3)
+	lru.SetWithK("leaf", []byte("l"), 1)
+	lru.Set("data", []byte("d"))
+
+	for key, want := range map[string]int{"index": 3, "leaf": 1, "data": 2} {
+		if got := lru.HIST.length(key); got != want {
+			t.Errorf("Expected %s to keep %d references, got %d", key, want, got)
+		}
+	}
+
+	now := int64(1000)
+	for _, key := range []string{"index", "leaf", "data"} {
+		lru.LAST.set(key, 100)
+	}
+	lru.HIST.hist["index"] = []int64{900, 850, 500}
+	lru.HIST.hist["leaf"] = []int64{600}
+	lru.HIST.hist["data"] = []int64{950, 0}
+
+	if victim := lru.FindVictim(now); victim != "data" {
+		t.Errorf("Expected the page without K references to go first, got %s", victim)
+	}
+	delete(lru.Buffer, "data")
+
+	// With the global K=2 index would be ranked by 850 and lose to leaf.
+	if victim := lru.FindVictim(now); victim != "index" {
+		t.Errorf("Expected index to be ranked by its 3rd reference, got %s", victim)
+	}
+
+	lru.SetWithK("leaf", []byte("l"), 2)
+	if got := lru.HIST.length("leaf"); got != 2 || lru.HIST.get("leaf", 1) != 600 {
+		t.Errorf("Expected leaf to grow to K=2 keeping its reference, got %v", lru.HIST.hist["leaf"])
+	}
+
+	lru.Cleanup("index")
+	lru.Set("index", []byte("i"))
+	if got := lru.HIST.length("index"); got != 2 {
+		t.Errorf("Expected index to fall back to the global K after cleanup, got %d", got)
+	}
+
+	expectPanic(t, func() { lru.SetWithK("bad", nil, 0) }, "k has to be greater than 0")
+}
+
+// TestLRUK_SetWithKRejected tests that a SetWithK that stores nothing
+// leaves the K of the page and its ghost history as they were
+func TestLRUK_SetWithKRejected(t *testing.T) {
+	lru := NewLRU[string](2, 1, 0)
+	lru.SetAt("ghost", []byte("g"), 10)
+	lru.SetAt("ghost", []byte("g"), 20)
+	lru.Evict("ghost")
+
+	lru.Admit = func(key string, data []byte) bool { return false }
+	if lru.SetWithK("ghost", []byte("g"), 3) {
+		t.Fatal("Expected Admit to reject the page")
+	}
+	if _, present := lru.pageK["ghost"]; present {
+		t.Error("Expected a rejected SetWithK to leave no K behind")
+	}
+	if got := lru.HIST.hist["ghost"]; !reflect.DeepEqual(got, []int64{20, 10}) {
+		t.Errorf("Expected the ghost history to stay [20 10], got %v", got)
+	}
+
+	lru.Admit = nil
+	lru.SetAt("resident", []byte("r"), 30)
+	lru.CanEvict = func(key string) bool { return false }
+	if lru.SetWithK("ghost", []byte("g"), 3) {
+		t.Fatal("Expected a full buffer with every page vetoed to reject the page")
+	}
+	if _, present := lru.pageK["ghost"]; present || lru.kthIndex("ghost") != 1 {
+		t.Error("Expected a rejected SetWithK to keep the global K for the ghost")
+	}
+}
+
+// TestLRUK_AdaptiveCleanupInterval tests that the demon backs off across
+// empty passes and speeds up again after a productive one, using a fake
+// sleep that records every interval
+func TestLRUK_AdaptiveCleanupInterval(t *testing.T) {
+	lru := NewLRU[string](2, 10, 60)
+	lru.RIP = 100
+	lru.CleanupInterval = time.Second
+	lru.MinCleanupInterval = 250 * time.Millisecond
+	lru.MaxCleanupInterval = 4 * time.Second
+
+	var slept []time.Duration
+	lru.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		switch len(slept) {
+		case 4:
+			// Give the fourth pass something to purge.
+			lru.Mu.Lock()
+			for _, key := range []string{"a", "b"} {
+				lru.Buffer[key] = []byte(key)
+				lru.HIST.init(key, 2)
+				lru.HIST.set(key, 1, lru.RIP+50)
+				lru.LAST.set(key, 0)
+			}
+			lru.Mu.Unlock()
+		case 5:
+			runtime.Goexit()
+		}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lru.StartCleanup()
+	}()
+	<-done
+
+	want := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 4 * time.Second, 2 * time.Second}
+	if fmt.Sprint(slept) != fmt.Sprint(want) {
+		t.Errorf("Expected intervals %v, got %v", want, slept)
+	}
+	if lru.Size() != 0 {
+		t.Errorf("Expected the fourth pass to purge every page, %d left", lru.Size())
+	}
+
+	fixed := NewLRU[string](2, 10, 60)
+	if got := fixed.nextCleanupInterval(time.Minute, 0, 10); got != fixed.CleanupInterval {
+		t.Errorf("Expected a fixed interval without MaxCleanupInterval, got %v", got)
+	}
+}
+
+// TestLRUK_StartCleanupContext tests that the demon keeps purging on its
+// ticker and that its goroutine exits once the context is cancelled
+func TestLRUK_StartCleanupContext(t *testing.T) {
+	lru := NewLRU[string](2, 10, 60)
+	lru.RIP = 100
+	lru.CleanupInterval = time.Millisecond
+	lru.Buffer["stale"] = []byte("stale")
+	lru.HIST.init("stale", 2)
+	lru.HIST.set("stale", 1, lru.RIP+50)
+	lru.LAST.set("stale", 0)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lru.StartCleanupContext(ctx)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for lru.Size() != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Expected the demon to purge the stale page")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the demon to return once its context was cancelled")
+	}
+
+	expectPanic(t, func() {
+		lru.CleanupInterval = 0
+		lru.StartCleanupContext(context.Background())
+	}, "cleanup interval has to be greater than 0")
+}
+
+// benchmarkWarmup fills a 100k page cache, with presized false the maps
+// are swapped for unsized ones to show what the size hint saves.
+func benchmarkWarmup(b *testing.B, presized bool) {
+	const capacity = 100_000
+	data := []byte("data")
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		lru := NewLRU[int](2, capacity, 1)
+		if !presized {
+			lru.Buffer = make(map[int][]byte)
+			lru.HIST = NewHistory[int](2)
+			lru.LAST = NewLast[int]()
+		}
+		for key := 0; key < capacity; key++ {
+			lru.set(key, data, int64(key+1))
+		}
+	}
+}
+
+func BenchmarkLRUK_Warmup_Presized(b *testing.B) {
+	benchmarkWarmup(b, true)
+}
+
+func BenchmarkLRUK_Warmup_Unsized(b *testing.B) {
+	benchmarkWarmup(b, false)
+}
+
+// TestLRUK_ReplayAt tests an LRU-2 reference string with explicit
+// timestamps against the histories and victims worked out by hand
+func TestLRUK_ReplayAt(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+
+	steps := []struct {
+		key     string
+		t       int64
+		evicted string
+		hist    []int64
+	}{
+		{"a", 1, "", []int64{1, 0}},
+		{"b", 3, "", []int64{3, 0}},
+		{"a", 5, "", []int64{5, 1}},
+		{"c", 7, "b", []int64{7, 0}},   // b has no 2nd reference yet
+		{"b", 9, "c", []int64{9, 3}},   // b's history was retained
+		{"d", 11, "a", []int64{11, 0}}, // HIST(a,2)=1 is older than HIST(b,2)=3
+	}
+
+	for _, step := range steps {
+		lru.ReplayAt(step.key, step.t)
+
+		if got := lru.HIST.hist[step.key]; fmt.Sprint(got) != fmt.Sprint(step.hist) {
+			t.Errorf("After %s at %d expected HIST %v, got %v", step.key, step.t, step.hist, got)
+		}
+		if step.evicted != "" {
+			if _, present := lru.Buffer[step.evicted]; present {
+				t.Errorf("After %s at %d expected %s to be evicted", step.key, step.t, step.evicted)
+			}
+		}
+	}
+
+	distances := lru.BackwardKDistances(13)
+	if len(distances) != 1 || distances["b"] != 10 {
+		t.Errorf("Expected only b with a Backward 2-distance of 10, got %v", distances)
+	}
+}
+
+// TestLRUK_GetRecordsReference tests that a read counts as a reference
+// for eviction, shifting HIST outside the CRP and only bumping LAST within
+func TestLRUK_GetRecordsReference(t *testing.T) {
+	now := time.Now().Unix()
+	lru := NewLRU[string](1, 2, 0)
+	lru.SetAt("read", []byte("data"), now-100)
+	lru.SetAt("written", []byte("data"), now-90)
+
+	if data, present := lru.Get("read"); !present || string(data) != "data" {
+		t.Fatalf("Expected (data, true), got (%s, %v)", data, present)
+	}
+	lru.Set("new", []byte("data"))
+	if _, present := lru.Buffer["read"]; !present {
+		t.Error("Expected the page that was read to outlive the one only written before it")
+	}
+	if _, present := lru.Buffer["written"]; present {
+		t.Error("Expected the page that was not read to be evicted")
+	}
+
+	correlated := NewLRU[string](2, 2, 1000)
+	correlated.SetAt("key", []byte("data"), now-10)
+	correlated.Get("key")
+	if correlated.HIST.get("key", 0) != now-10 || correlated.LAST.get("key") < now {
+		t.Errorf("Expected a read within the CRP to only bump LAST, got HIST %v", correlated.HIST.hist["key"])
+	}
+}
+
+// TestLRUK_GetOpt tests that GetOpt records a reference only when asked to
+func TestLRUK_GetOpt(t *testing.T) {
+	lru := NewLRU[string](2, 10, 1)
+	lru.Set("key", []byte("data"))
+
+	lru.Mu.Lock()
+	lru.LAST.set("key", 100)
+	lru.HIST.hist["key"] = []int64{100, 0}
+	lru.Mu.Unlock()
+
+	data, present := lru.GetOpt("key", false)
+	if !present || string(data) != "data" {
+		t.Fatalf("Expected (data, true), got (%s, %v)", data, present)
+	}
+	if lru.LAST.get("key") != 100 || lru.HIST.get("key", 0) != 100 {
+		t.Error("Expected GetOpt without record to leave LAST and HIST alone")
+	}
+
+	data, present = lru.GetOpt("key", true)
+	if !present || string(data) != "data" {
+		t.Fatalf("Expected (data, true), got (%s, %v)", data, present)
+	}
+	if lru.LAST.get("key") == 100 {
+		t.Error("Expected GetOpt with record to update LAST")
+	}
+	if lru.HIST.get("key", 1) != 100 {
+		t.Errorf("Expected the old reference to shift to HIST(p,2), got %v", lru.HIST.hist["key"])
+	}
+
+	if _, present := lru.GetOpt("missing", true); present {
+		t.Error("Expected a miss for a missing key")
+	}
+	if _, present := lru.Buffer["missing"]; present || lru.HIST.exists("missing") {
+		t.Error("Expected a recorded miss not to admit the key")
+	}
+
+	stats := lru.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Expected 2 hits and 1 miss, got %+v", stats)
+	}
+}
+
+// TestLRUK_MaxHistoryEntries tests that ghost histories are forgotten
+// oldest K-th reference first once the bound is reached
+func TestLRUK_MaxHistoryEntries(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+	lru.MaxHistoryEntries = 3
+
+	lru.ReplayAt("a", 1)
+	lru.ReplayAt("a", 3)
+	lru.ReplayAt("b", 5)
+	lru.ReplayAt("b", 7)
+	lru.ReplayAt("c", 9)  // evicts a (HIST(a,2)=1), 3 histories
+	lru.ReplayAt("d", 11) // evicts c, whose distance is infinite
+
+	if got := lru.HistoryLen(); got != 3 {
+		t.Errorf("Expected 3 histories, got %d", got)
+	}
+	if lru.HIST.exists("c") {
+		t.Error("Expected the ghost with a single reference to be forgotten first")
+	}
+	if !lru.HIST.exists("a") {
+		t.Error("Expected ghost a with two references to be kept")
+	}
+
+	lru.ReplayAt("d", 13)
+	lru.ReplayAt("e", 15) // evicts b (HIST(b,2)=5), a has the oldest K-th reference
+	if lru.HIST.exists("a") || !lru.HIST.exists("b") {
+		t.Errorf("Expected a to be forgotten before b, got %v", lru.HIST.hist)
+	}
+
+	for _, key := range []string{"e", "f", "g"} {
+		lru.ReplayAt(key, 20)
+	}
+	if got := lru.HistoryLen(); got != 3 {
+		t.Errorf("Expected the bound to hold, got %d histories", got)
+	}
+	for key := range lru.Buffer {
+		if !lru.HIST.exists(key) {
+			t.Errorf("Expected resident page %s to keep its history", key)
+		}
+	}
+}
+
+// TestLRUK_MaxHistoryEntriesBoundsLAST tests that forgetting a ghost
+// history also forgets its LAST, which Evict keeps for the ghost
+func TestLRUK_MaxHistoryEntriesBoundsLAST(t *testing.T) {
+	lru := NewLRU[int](2, 2, 1)
+	lru.MaxHistoryEntries = 3
+
+	for i := 0; i < 50; i++ {
+		lru.SetAt(i, []byte("data"), int64(10*i+1))
+		lru.SetAt(i, []byte("data"), int64(10*i+5))
+		lru.Evict(i)
+		if len(lru.HIST.hist) > lru.MaxHistoryEntries || len(lru.LAST.last) > lru.MaxHistoryEntries {
+			t.Fatalf("step %d: expected at most %d histories and LAST entries, got %d and %d",
+				i, lru.MaxHistoryEntries, len(lru.HIST.hist), len(lru.LAST.last))
+		}
+	}
+	for page := range lru.LAST.last {
+		if !lru.HIST.exists(page) {
+			t.Errorf("Expected LAST of %d to be forgotten with its history", page)
+		}
+	}
+	if !lru.HIST.exists(49) || lru.HIST.exists(0) {
+		t.Errorf("Expected the most recent ghosts to be kept, got %v", lru.HIST.hist)
+	}
+}
+
+// TestLRUK_RetainedUntil tests that RetainedUntil is HIST(p,K) + RIP for resident pages and ghosts
+func TestLRUK_RetainedUntil(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	lru.RIP = 100
+
+	lru.ReplayAt("a", 10)
+	lru.ReplayAt("a", 20)
+	if until, ok := lru.RetainedUntil("a"); !ok || until != 110 {
+		t.Errorf("Expected (110, true), got (%d, %v)", until, ok)
+	}
+
+	lru.ReplayAt("b", 30) // a becomes a ghost and keeps its history
+	if until, ok := lru.RetainedUntil("a"); !ok || until != 110 {
+		t.Errorf("Expected the ghost to keep (110, true), got (%d, %v)", until, ok)
+	}
+	if until, ok := lru.RetainedUntil("b"); !ok || until != 130 {
+		t.Errorf("Expected a single reference to give (130, true), got (%d, %v)", until, ok)
+	}
+
+	if _, ok := lru.RetainedUntil("missing"); ok {
+		t.Error("Expected false for a key without history")
+	}
+
+	lru.RIP = math.MaxInt64
+	if until, _ := lru.RetainedUntil("a"); until != math.MaxInt64 {
+		t.Errorf("Expected an overflowing sum to saturate, got %d", until)
+	}
+
+	lru.RIP = 0
+	if until, _ := lru.RetainedUntil("a"); until != math.MaxInt64 {
+		t.Errorf("Expected a RIP of 0 to retain the history forever, got %d", until)
+	}
+}
+
+// TestLRUK_DemonPurgesAtRetainedUntil tests that the demon keeps a
+// resident page and a ghost up to the time RetainedUntil reports and
+// purges both right after it
+func TestLRUK_DemonPurgesAtRetainedUntil(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	lru.RIP = 100
+	lru.CleanupInterval = time.Second
+
+	lru.ReplayAt("ghost", 10)
+	lru.ReplayAt("ghost", 20)
+	lru.ReplayAt("page", 30) // ghost is evicted and keeps its history
+	lru.ReplayAt("page", 40)
+
+	ghostUntil, _ := lru.RetainedUntil("ghost")
+	pageUntil, _ := lru.RetainedUntil("page")
+	if ghostUntil != 110 || pageUntil != 130 {
+		t.Fatalf("Expected ghost and page retained until 110 and 130, got %d and %d", ghostUntil, pageUntil)
+	}
+
+	passes := []int64{ghostUntil, ghostUntil + 1, pageUntil, pageUntil + 1}
+	var histories []int
+	pass := 0
+	lru.now = func() int64 { return passes[pass-1] }
+	lru.sleep = func(time.Duration) {
+		// Record what the previous pass left.
+		if pass > 0 {
+			histories = append(histories, lru.HistoryLen())
+		}
+		if pass == len(passes) {
+			runtime.Goexit()
+		}
+		pass++
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		lru.StartCleanup()
+	}()
+	<-done
+
+	if want := []int{2, 1, 1, 0}; !reflect.DeepEqual(histories, want) {
+		t.Errorf("Expected histories %v after the passes at %v, got %v", want, passes, histories)
+	}
+}
+
+// TestLRUK_Reference tests that Reference records an access without changing data
+func TestLRUK_Reference(t *testing.T) {
+	lru := NewLRU[string](2, 10, 1)
+	lru.Set("page", []byte("data"))
+
+	lru.Mu.Lock()
+	lru.LAST.set("page", 100)
+	lru.HIST.hist["page"] = []int64{100, 0}
+	lru.Mu.Unlock()
+
+	if !lru.Reference("page") {
+		t.Fatal("Expected Reference to report a resident page")
+	}
+	if lru.LAST.get("page") == 100 || lru.HIST.get("page", 1) != 100 {
+		t.Errorf("Expected the reference to be recorded, got LAST %d and HIST %v", lru.LAST.get("page"), lru.HIST.hist["page"])
+	}
+	if string(lru.Buffer["page"]) != "data" {
+		t.Errorf("Expected the data to be kept, got %s", lru.Buffer["page"])
+	}
+
+	if lru.Reference("missing") {
+		t.Error("Expected Reference to report false for a page that is not resident")
+	}
+	if lru.HIST.exists("missing") || lru.Size() != 1 {
+		t.Error("Expected Reference not to admit a page")
+	}
+	if stats := lru.Stats(); stats.Hits != 0 || stats.Misses != 0 {
+		t.Errorf("Expected Reference not to count as a Get, got %+v", stats)
+	}
+}
+
+// TestLRUK_Entries tests that Entries lists resident pages by last reference
+func TestLRUK_Entries(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.ReplayAt("a", 1)
+	lru.ReplayAt("b", 3)
+	lru.ReplayAt("c", 5)
+	lru.ReplayAt("a", 7)
+
+	var keys []string
+	for _, entry := range lru.Entries() {
+		keys = append(keys, entry.Key)
+		if string(entry.Value) != string(lru.Buffer[entry.Key]) {
+			t.Errorf("Expected the data of %s, got %s", entry.Key, entry.Value)
+		}
+	}
+	if fmt.Sprint(keys) != "[b c a]" {
+		t.Errorf("Expected [b c a], got %v", keys)
+	}
+}
+
+// TestLRUK_Clone tests that a clone holds the same state and shares none of it
+func TestLRUK_Clone(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+	lru.RIP = 100
+	lru.CleanupConcurrency = 4
+	var evicted []string
+	lru.CanEvict = func(key string) bool { return key != "latched" }
+	lru.Admit = func(key string, data []byte) bool { return key != "rejected" }
+	lru.OnEvictDetailed = func(key string, data []byte, history []int64) { evicted = append(evicted, key) }
+	lru.ReplayAt("a", 1)
+	lru.ReplayAt("b", 3)
+	lru.ReplayAt("a", 5)
+	lru.Buffer["a"] = []byte("data-a")
+	lru.GetOpt("a", false) // a hit, without a wall clock reference
+
+	clone := lru.Clone()
+	if fmt.Sprint(clone.Entries()) != fmt.Sprint(lru.Entries()) {
+		t.Errorf("Expected the clone to hold %v, got %v", lru.Entries(), clone.Entries())
+	}
+	if fmt.Sprint(clone.HIST.hist) != fmt.Sprint(lru.HIST.hist) || fmt.Sprint(clone.LAST.last) != fmt.Sprint(lru.LAST.last) {
+		t.Error("Expected the clone to hold the same HIST and LAST")
+	}
+	if clone.Stats() != lru.Stats() || clone.RIP != lru.RIP || clone.CRP != lru.CRP || clone.K != lru.K {
+		t.Error("Expected the clone to keep the tunables and counters")
+	}
+	if clone.CleanupConcurrency != lru.CleanupConcurrency {
+		t.Errorf("Expected the clone to keep CleanupConcurrency %d, got %d", lru.CleanupConcurrency, clone.CleanupConcurrency)
+	}
+	hooks := lru.Clone()
+	if hooks.CanEvict == nil || hooks.CanEvict("latched") || !hooks.CanEvict("a") {
+		t.Error("Expected the clone to keep CanEvict")
+	}
+	if hooks.Admit == nil || hooks.SetAt("rejected", []byte("data"), 6) {
+		t.Error("Expected the clone to keep Admit")
+	}
+	if hooks.OnEvictDetailed == nil {
+		t.Fatal("Expected the clone to keep OnEvictDetailed")
+	}
+	hooks.Evict("b")
+	if fmt.Sprint(evicted) != "[b]" {
+		t.Errorf("Expected the clone's eviction of b to be reported, got %v", evicted)
+	}
+
+	lru.Buffer["a"][0] = 'X'
+	lru.ReplayAt("c", 10) // evicts b from the original only
+	if string(clone.Buffer["a"]) != "data-a" {
+		t.Errorf("Expected the clone's data not to alias the original, got %s", clone.Buffer["a"])
+	}
+	if _, present := clone.Buffer["b"]; !present || clone.HIST.exists("c") {
+		t.Error("Expected the clone not to see later changes to the original")
+	}
+
+	clone.ReplayAt("a", 20)
+	if lru.LAST.get("a") != 5 || lru.HIST.get("a", 0) != 5 {
+		t.Error("Expected changes to the clone not to reach the original")
+	}
+}
+
+// TestLRUK_CanEvict tests that a vetoed page is passed over as a victim
+func TestLRUK_CanEvict(t *testing.T) {
+	for _, batch := range []int{1, 2} {
+		lru := NewLRUWithBatch[string](1, 2, 1, batch)
+		lru.ReplayAt("a", 1)
+		lru.ReplayAt("b", 3)
+		if victim := lru.FindVictim(10); victim != "a" {
+			t.Fatalf("Expected a to be the victim without a veto, got %s", victim)
+		}
+
+		latched := map[string]bool{"a": true}
+		lru.CanEvict = func(key string) bool { return !latched[key] }
+		lru.ReplayAt("c", 10)
+		if _, present := lru.Buffer["a"]; !present {
+			t.Errorf("batch %d: Expected the latched page to stay resident", batch)
+		}
+		if _, present := lru.Buffer["b"]; present {
+			t.Errorf("batch %d: Expected b to be evicted instead", batch)
+		}
+
+		latched["c"] = true
+		if lru.Set("d", []byte("data")) {
+			t.Errorf("batch %d: Expected Set to fail when every page is vetoed", batch)
+		}
+		if _, present := lru.Buffer["d"]; present || lru.HIST.exists("d") || lru.Size() != 2 {
+			t.Errorf("batch %d: Expected a failed Set to change nothing", batch)
+		}
+
+		delete(latched, "a")
+		if !lru.Set("d", []byte("data")) {
+			t.Errorf("batch %d: Expected Set to succeed once a is released", batch)
+		}
+		if _, present := lru.Buffer["a"]; present {
+			t.Errorf("batch %d: Expected a to be evicted once released", batch)
+		}
+	}
+}
+
+// TestLRUK_SetAtGetAt tests that a logical clock drives the history and the CRP
+func TestLRUK_SetAtGetAt(t *testing.T) {
+	lru := NewLRU[string](2, 2, 5)
+	if !lru.SetAt("a", []byte("data-a"), 100) {
+		t.Fatal("Expected SetAt to succeed")
+	}
+	lru.SetAt("b", []byte("data-b"), 101)
+
+	// Within the CRP the read is correlated, only LAST moves.
+	if data, ok := lru.GetAt("a", 103); !ok || string(data) != "data-a" {
+		t.Errorf("Expected (data-a, true), got (%s, %v)", data, ok)
+	}
+	if lru.LAST.get("a") != 103 || lru.HIST.get("a", 0) != 100 {
+		t.Errorf("Expected LAST 103 and HIST 100, got %d and %d", lru.LAST.get("a"), lru.HIST.get("a", 0))
+	}
+
+	// Outside the CRP the history is shifted.
+	lru.GetAt("a", 120)
+	if lru.HIST.get("a", 0) != 120 || lru.HIST.get("a", 1) != 103 {
+		t.Errorf("Expected HIST [120 103], got [%d %d]", lru.HIST.get("a", 0), lru.HIST.get("a", 1))
+	}
+
+	// b has a single reference and is the victim on the logical clock.
+	lru.SetAt("c", []byte("data-c"), 130)
+	if _, present := lru.Buffer["b"]; present {
+		t.Error("Expected b to be evicted")
+	}
+
+	if _, ok := lru.GetAt("missing", 140); ok {
+		t.Error("Expected a miss for an unknown key")
+	}
+	if stats := lru.Stats(); stats.Hits != 2 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+}
+
+// TestLRUK_CleanupConcurrency tests that a large pass runs a bounded number of goroutines
+func TestLRUK_CleanupConcurrency(t *testing.T) {
+	k := 2
+	pages := 5000
+	lru := NewLRU[int](k, pages, 60)
+	lru.RIP = 100
+	lru.CleanupConcurrency = 4
+
+	for key := 0; key < pages; key++ {
+		lru.Buffer[key] = []byte("data")
+		lru.HIST.init(key, k)
+		lru.HIST.set(key, k-1, 150)
+		lru.LAST.set(key, 150)
+	}
+
+	base := runtime.NumGoroutine()
+	peak := 0
+	done := make(chan struct{})
+	var purged, freed int
+	go func() {
+		purged, freed = lru.CleanupPass()
+		close(done)
+	}()
+	for sampling := true; sampling; {
+		select {
+		case <-done:
+			sampling = false
+		default:
+			peak = max(peak, runtime.NumGoroutine())
+			runtime.Gosched()
+		}
+	}
+
+	if limit := base + 1 + lru.CleanupConcurrency; peak > limit {
+		t.Errorf("Expected at most %d goroutines during the pass, saw %d", limit, peak)
+	}
+	if purged != pages || freed != pages*len("data") {
+		t.Errorf("Expected %d pages and %d bytes purged, got %d and %d", pages, pages*len("data"), purged, freed)
+	}
+	if lru.Size() != 0 {
+		t.Errorf("Expected every page to be purged, %d left", lru.Size())
+	}
+}
+
+// TestLRUK_String tests the summary and the Backward K-distances in eviction order
+func TestLRUK_String(t *testing.T) {
+	lru := NewLRU[string](2, 4, 1)
+	lru.ReplayAt("a", 1)
+	lru.ReplayAt("b", 3)
+	lru.ReplayAt("a", 5)
+	lru.ReplayAt("b", 6)
+	lru.ReplayAt("c", 7)
+
+	var _ fmt.Stringer = lru
+	want := "buffer=3/4, K=2, CRP=1, RIP=0 [c:inf a:6 b:4]"
+	if got := fmt.Sprint(lru); got != want {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+	if got := NewLRU[int](1, 2, 1).String(); got != "buffer=0/2, K=1, CRP=1, RIP=0 []" {
+		t.Errorf("Unexpected empty dump %q", got)
+	}
+}
+
+// TestLRUK_Admit tests that a rejected page is neither stored nor evicts anything
+func TestLRUK_Admit(t *testing.T) {
+	lru := NewLRU[string](2, 2, 1)
+	lru.Admit = func(key string, data []byte) bool { return len(data) <= 4 }
+
+	if !lru.Set("a", []byte("aaaa")) || !lru.Set("b", []byte("bb")) {
+		t.Fatal("Expected small pages to be admitted")
+	}
+	if lru.Set("big", []byte("too large")) {
+		t.Error("Expected an oversized page to be rejected")
+	}
+	if _, present := lru.Buffer["big"]; present || lru.HIST.exists("big") {
+		t.Error("Expected the rejected page to leave no trace")
+	}
+	if lru.Size() != 2 || lru.Stats().Evictions != 0 {
+		t.Error("Expected nothing to be evicted for a rejected page")
+	}
+
+	// Admit only applies to new pages, a resident one can still grow.
+	if !lru.Set("a", []byte("grown past the limit")) {
+		t.Error("Expected an update of a resident page to bypass Admit")
+	}
+}
+
+// FuzzLRUK tests that no stream of operations breaks the invariants of
+// the buffer and the histories, with some pages given their own K, tags
+// or a SetMiss marker
+func FuzzLRUK(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		lru := NewLRUWithBatch[int](2, 4, 1, 2)
+		lru.MaxHistoryEntries = 6
+		clock := time.Now().Unix()
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get: func(key int) {
+				clock++
+				lru.GetAt(key, clock)
+			},
+			Set: func(key, value int) {
+				clock++
+				switch value % 4 {
+				case 0:
+					lru.SetWithK(key, []byte{byte(value)}, 3)
+				case 1:
+					lru.SetWithTags(key, []byte{byte(value)}, []string{fmt.Sprint(key % 3)})
+				case 2:
+					lru.SetMiss(key, time.Hour)
+				default:
+					lru.SetAt(key, []byte{byte(value)}, clock)
+				}
+			},
+			Delete: func(key int) { lru.Delete(key) },
+			Evict: func() {
+				if victim, ok := lru.WouldEvict(); ok {
+					lru.Evict(victim)
+				}
+			},
+			CheckInvariants: lru.CheckInvariants,
+		})
+	})
+}
@@ -0,0 +1,90 @@
+package lrukgo
+
+import (
+	"fmt"
+	"time"
+)
+
+// MetaLRU is an LRU-K cache that keeps a caller owned metadata value of
+// type M next to every page, the way a buffer pool keeps a frame
+// descriptor with the page LSN, dirty flag or latch count. The metadata
+// lives exactly as long as the page is resident: eviction and Cleanup
+// drop it with the data.
+type MetaLRU[T comparable, M any] struct {
+	*LRU_K[T]
+
+	// meta holds the metadata of the resident pages stored with
+	// SetWithMeta. It is guarded by Mu and emptied by the onRemove hook
+	// of the cache.
+	meta map[T]M
+}
+
+// NewLRUWithMeta creates a MetaLRU, the parameters are the ones of
+// NewLRU.
+func NewLRUWithMeta[T comparable, M any](k int, cap int, crp int64) *MetaLRU[T, M] {
+	return withMeta[T, M](NewLRU[T](k, cap, crp), make(map[T]M))
+}
+
+// withMeta wraps lru in a MetaLRU holding meta, hooking the removal of
+// pages so their metadata goes with them.
+func withMeta[T comparable, M any](lru *LRU_K[T], meta map[T]M) *MetaLRU[T, M] {
+	m := &MetaLRU[T, M]{LRU_K: lru, meta: meta}
+	lru.onRemove = func(key T) { delete(m.meta, key) }
+	return m
+}
+
+// SetWithMeta is Set that also stores meta for key, replacing any
+// metadata the page had. A plain Set keeps the existing metadata. A nil
+// data removes the page and its metadata as Set does, meta is dropped.
+func (lru *MetaLRU[T, M]) SetWithMeta(key T, data []byte, meta M) (success bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if data == nil {
+		lru.purge(key)
+		return true
+	}
+	if _, admitted := lru.set(key, data, time.Now().Unix()); !admitted {
+		return false
+	}
+	lru.meta[key] = meta
+	return true
+}
+
+// GetMeta returns the metadata of a resident page without recording a
+// reference. It reports false when the page is not resident or was
+// stored without metadata.
+func (lru *MetaLRU[T, M]) GetMeta(key T) (M, bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	meta, present := lru.meta[key]
+	return meta, present
+}
+
+// Clone is LRU_K.Clone that also copies the metadata, the values as
+// they are, into a MetaLRU of its own.
+func (lru *MetaLRU[T, M]) Clone() *MetaLRU[T, M] {
+	lru.lock()
+	defer lru.unlock()
+
+	return withMeta(lru.clone(), cloneMap(lru.meta))
+}
+
+// CheckInvariants is LRU_K.CheckInvariants that also verifies that only
+// resident pages have metadata.
+func (lru *MetaLRU[T, M]) CheckInvariants() error {
+	if err := lru.LRU_K.CheckInvariants(); err != nil {
+		return err
+	}
+
+	lru.lock()
+	defer lru.unlock()
+
+	for page := range lru.meta {
+		if _, resident := lru.Buffer[page]; !resident {
+			return fmt.Errorf("metadata of %v that is not resident", page)
+		}
+	}
+	return nil
+}
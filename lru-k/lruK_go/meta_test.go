@@ -0,0 +1,86 @@
+package lrukgo
+
+import "testing"
+
+type frame struct {
+	lsn   int64
+	dirty bool
+}
+
+// TestMetaLRU_SetGetMeta tests storing, replacing and keeping metadata
+func TestMetaLRU_SetGetMeta(t *testing.T) {
+	lru := NewLRUWithMeta[string, frame](2, 10, 1)
+	lru.SetWithMeta("page", []byte("data"), frame{lsn: 7, dirty: true})
+
+	meta, ok := lru.GetMeta("page")
+	if !ok || meta.lsn != 7 || !meta.dirty {
+		t.Errorf("Expected ({7 true}, true), got (%+v, %v)", meta, ok)
+	}
+
+	lru.Set("page", []byte("data2"))
+	if meta, ok := lru.GetMeta("page"); !ok || meta.lsn != 7 {
+		t.Errorf("Expected a plain Set to keep the metadata, got (%+v, %v)", meta, ok)
+	}
+
+	lru.SetWithMeta("page", []byte("data3"), frame{lsn: 8})
+	if meta, _ := lru.GetMeta("page"); meta.lsn != 8 || meta.dirty {
+		t.Errorf("Expected the metadata to be replaced, got %+v", meta)
+	}
+
+	lru.Set("plain", []byte("data"))
+	if _, ok := lru.GetMeta("plain"); ok {
+		t.Error("Expected a page stored without metadata to report none")
+	}
+	if _, ok := lru.GetMeta("missing"); ok {
+		t.Error("Expected a missing page to report no metadata")
+	}
+}
+
+// TestMetaLRU_DropsMetaWithPage tests that eviction and Cleanup drop the metadata
+func TestMetaLRU_DropsMetaWithPage(t *testing.T) {
+	lru := NewLRUWithMeta[string, frame](2, 1, 1)
+	lru.SetWithMeta("a", []byte("a"), frame{lsn: 1})
+	lru.SetWithMeta("b", []byte("b"), frame{lsn: 2}) // evicts a
+
+	if _, ok := lru.GetMeta("a"); ok {
+		t.Error("Expected the metadata of the evicted page to be dropped")
+	}
+	if _, ok := lru.meta["a"]; ok {
+		t.Error("Expected no metadata left for a")
+	}
+
+	lru.Cleanup("b")
+	if _, ok := lru.GetMeta("b"); ok {
+		t.Error("Expected Cleanup to drop the metadata")
+	}
+}
+
+// TestMetaLRU_Clone tests that a clone keeps the metadata and that
+// evicting from either cache leaves the metadata of the other alone
+func TestMetaLRU_Clone(t *testing.T) {
+	lru := NewLRUWithMeta[string, frame](2, 2, 1)
+	lru.SetWithMeta("a", []byte("a"), frame{lsn: 1})
+	lru.SetWithMeta("b", []byte("b"), frame{lsn: 2})
+
+	clone := lru.Clone()
+	if meta, ok := clone.GetMeta("a"); !ok || meta.lsn != 1 {
+		t.Errorf("Expected the clone to keep the metadata of a, got (%+v, %v)", meta, ok)
+	}
+
+	clone.Evict("a")
+	lru.Evict("b")
+	if _, ok := clone.GetMeta("a"); ok {
+		t.Error("Expected Evict to drop the metadata of a from the clone")
+	}
+	if meta, ok := lru.GetMeta("a"); !ok || meta.lsn != 1 {
+		t.Errorf("Expected the original to keep the metadata of a, got (%+v, %v)", meta, ok)
+	}
+	if meta, ok := clone.GetMeta("b"); !ok || meta.lsn != 2 {
+		t.Errorf("Expected the clone to keep the metadata of b, got (%+v, %v)", meta, ok)
+	}
+	for _, c := range []*MetaLRU[string, frame]{lru, clone} {
+		if err := c.CheckInvariants(); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package lrukgo
+
+import "time"
+
+// LookupState is what the cache knows about a key, see Lookup.
+type LookupState int
+
+const (
+	// Unknown means the cache knows nothing about the key and the
+	// backing store has to be asked.
+	Unknown LookupState = iota
+	// Hit means the key is resident and its data was returned.
+	Hit
+	// Miss means the key is known to be absent from the backing store,
+	// it was recorded with SetMiss and the marker has not expired.
+	Miss
+)
+
+// SetMiss records that key is absent from the backing store for the
+// next ttl, so a read-through cache does not keep asking the store for
+// a key that does not exist. The marker is a page like any other: it
+// takes a slot in the buffer, builds up a history and is evicted under
+// the LRU-K policy, it just carries no data. A later Set replaces it.
+func (lru *LRU_K[T]) SetMiss(key T, ttl time.Duration) {
+	if ttl <= 0 {
+		panic("ttl has to be greater than 0")
+	}
+
+	lru.lock()
+	defer lru.unlock()
+
+	now := time.Now()
+	if _, admitted := lru.set(key, nil, now.Unix()); !admitted {
+		return
+	}
+	if lru.absent == nil {
+		lru.absent = make(map[T]time.Time)
+	}
+	lru.absent[key] = now.Add(ttl)
+}
+
+// Lookup is Get that tells a known absent key apart from an unknown
+// one. It returns the data and Hit for a resident page, Miss for a key
+// recorded with SetMiss whose marker is still valid and Unknown
+// otherwise. An expired marker is dropped from the buffer, its history
+// is kept like the one of an evicted page. Like Get a Hit records the
+// read as a reference to the page; a Miss or Unknown records nothing.
+func (lru *LRU_K[T]) Lookup(key T) (data []byte, state LookupState) {
+	lru.lock()
+	defer lru.unlock()
+
+	data, present := lru.Buffer[key]
+	if !present {
+		lru.misses++
+		return nil, Unknown
+	}
+
+	expires, negative := lru.absent[key]
+	if !negative {
+		lru.hits++
+		lru.reference(key, time.Now().Unix())
+		return data, Hit
+	}
+
+	lru.misses++
+	if time.Now().Before(expires) {
+		return nil, Miss
+	}
+
+	lru.displace(key)
+	return nil, Unknown
+}
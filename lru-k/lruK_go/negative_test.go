@@ -0,0 +1,155 @@
+package lrukgo
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// TestLRUK_Lookup tests the three states Lookup tells apart
+func TestLRUK_Lookup(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.Set("present", []byte("data"))
+	lru.SetMiss("absent", time.Hour)
+
+	if data, state := lru.Lookup("present"); state != Hit || string(data) != "data" {
+		t.Errorf("Expected (data, Hit), got (%s, %v)", data, state)
+	}
+	if data, state := lru.Lookup("absent"); state != Miss || data != nil {
+		t.Errorf("Expected (nil, Miss), got (%s, %v)", data, state)
+	}
+	if _, state := lru.Lookup("other"); state != Unknown {
+		t.Errorf("Expected Unknown, got %v", state)
+	}
+
+	if _, present := lru.Get("absent"); present {
+		t.Error("Expected Get to report a negative entry as a miss")
+	}
+	if len(lru.Entries()) != 1 {
+		t.Errorf("Expected the negative entry to be left out of Entries, got %v", lru.Entries())
+	}
+	if lru.Size() != 2 {
+		t.Errorf("Expected the negative entry to take a slot, got size %d", lru.Size())
+	}
+
+	lru.Set("absent", []byte("found"))
+	if data, state := lru.Lookup("absent"); state != Hit || string(data) != "found" {
+		t.Errorf("Expected Set to replace the negative entry, got (%s, %v)", data, state)
+	}
+}
+
+// TestLRUK_SetMissExpires tests that an expired marker turns back into Unknown
+func TestLRUK_SetMissExpires(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.SetMiss("absent", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, state := lru.Lookup("absent"); state != Unknown {
+		t.Errorf("Expected Unknown after the marker expired, got %v", state)
+	}
+	if lru.Size() != 0 {
+		t.Errorf("Expected the expired marker to leave the buffer, got size %d", lru.Size())
+	}
+	if lru.HistoryLen() != 1 {
+		t.Errorf("Expected the history of the marker to be retained, got %d", lru.HistoryLen())
+	}
+}
+
+// TestLRUK_SetMissEvicted tests that negative entries are evicted like pages
+func TestLRUK_SetMissEvicted(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	lru.SetMiss("absent", time.Hour)
+	lru.Set("a", []byte("data"))
+
+	if _, state := lru.Lookup("absent"); state != Unknown {
+		t.Errorf("Expected the negative entry to be evicted, got %v", state)
+	}
+	if len(lru.absent) != 0 {
+		t.Errorf("Expected the marker to be dropped on eviction, got %v", lru.absent)
+	}
+}
+
+// TestLRUK_ReplayAtLookup tests that a replayed page is a Hit for Lookup
+// and that replaying a marker keeps it a Miss
+func TestLRUK_ReplayAtLookup(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.ReplayAt("a", 10)
+	lru.SetMiss("absent", time.Hour)
+	lru.ReplayAt("absent", 20)
+
+	if data, state := lru.Lookup("a"); state != Hit || data == nil || len(data) != 0 {
+		t.Errorf("Expected a replayed page to be a Hit with empty data, got (%v, %v)", data, state)
+	}
+	if _, state := lru.Lookup("absent"); state != Miss {
+		t.Errorf("Expected a replayed marker to stay a Miss, got %v", state)
+	}
+}
+
+// TestLRUK_LookupRecordsReference tests that a Lookup hit shifts HIST
+// like Get and that a Miss records nothing
+func TestLRUK_LookupRecordsReference(t *testing.T) {
+	now := time.Now().Unix()
+	lru := NewLRU[string](2, 3, 0)
+	lru.SetAt("present", []byte("data"), now-100)
+	lru.SetMiss("absent", time.Hour)
+	absentHist := append([]int64{}, lru.HIST.hist["absent"]...)
+
+	if _, state := lru.Lookup("present"); state != Hit {
+		t.Fatalf("Expected a Hit, got %v", state)
+	}
+	if hist := lru.HIST.hist["present"]; hist[0] < now || hist[1] != now-100 {
+		t.Errorf("Expected the Lookup to be the most recent reference, got HIST %v", hist)
+	}
+	if lru.LAST.get("present") < now {
+		t.Errorf("Expected the Lookup to update LAST, got %d", lru.LAST.get("present"))
+	}
+
+	if _, state := lru.Lookup("absent"); state != Miss {
+		t.Fatalf("Expected a Miss, got %v", state)
+	}
+	if hist := lru.HIST.hist["absent"]; !reflect.DeepEqual(hist, absentHist) {
+		t.Errorf("Expected a Miss to leave HIST at %v, got %v", absentHist, hist)
+	}
+}
+
+// TestLRUK_SetMissNotReported tests that a marker evicted to make room
+// never reaches OnEvictDetailed nor counts as an eviction
+func TestLRUK_SetMissNotReported(t *testing.T) {
+	lru := NewLRU[string](2, 1, 1)
+	var reported []string
+	lru.OnEvictDetailed = func(key string, data []byte, history []int64) {
+		reported = append(reported, key)
+	}
+
+	lru.SetMiss("absent", time.Hour)
+	lru.Set("a", []byte("data")) // evicts the marker
+	if len(reported) != 0 || lru.Stats().Evictions != 0 {
+		t.Errorf("Expected the marker to go unreported, got %v and %d evictions", reported, lru.Stats().Evictions)
+	}
+	if _, present := lru.Buffer["absent"]; present {
+		t.Error("Expected the marker to make room for a")
+	}
+
+	lru.Set("b", []byte("data")) // evicts a
+	if !reflect.DeepEqual(reported, []string{"a"}) || lru.Stats().Evictions != 1 {
+		t.Errorf("Expected only a reported, got %v and %d evictions", reported, lru.Stats().Evictions)
+	}
+}
+
+// TestLRUK_GetDropsExpiredMarker tests that Get drops an expired marker
+// the way Lookup does
+func TestLRUK_GetDropsExpiredMarker(t *testing.T) {
+	lru := NewLRU[string](2, 3, 1)
+	lru.SetMiss("absent", time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, present := lru.Get("absent"); present {
+		t.Error("Expected an expired marker to be a miss")
+	}
+	if lru.Size() != 0 || len(lru.absent) != 0 {
+		t.Errorf("Expected the expired marker to leave the buffer, got size %d", lru.Size())
+	}
+	if lru.HistoryLen() != 1 {
+		t.Errorf("Expected the history of the marker to be retained, got %d", lru.HistoryLen())
+	}
+}
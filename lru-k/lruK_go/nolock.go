@@ -0,0 +1,36 @@
+package lrukgo
+
+// NewLRUNoLock creates an LRU-K cache that does not lock: its methods
+// leave Mu alone, so a single goroutine owning the cache, e.g. one cache
+// per worker, does not pay for the mutex on every Get and Set.
+//
+// THE CACHE IS NOT SAFE FOR CONCURRENT USE. Every method, Size and
+// Stats included, must be called from one goroutine at a time, or under
+// a lock of the caller's own. StartCleanup and StartCleanupContext run
+// the demon on another goroutine and panic, call CleanupPass from the
+// owning goroutine instead; it purges from that goroutine whatever
+// CleanupConcurrency is.
+func NewLRUNoLock[T comparable](k int, cap int, crp int64) *LRU_K[T] {
+	lru_k := NewLRU[T](k, cap, crp)
+	lru_k.nolock = true
+	return lru_k
+}
+
+// lock takes Mu, unless the cache was made with NewLRUNoLock.
+func (lru *LRU_K[T]) lock() {
+	if !lru.nolock {
+		lru.Mu.Lock()
+	}
+}
+
+// unlock releases Mu, unless the cache was made with NewLRUNoLock.
+func (lru *LRU_K[T]) unlock() {
+	if !lru.nolock {
+		lru.Mu.Unlock()
+	}
+}
+
+// unlocked reports whether the cache was made with NewLRUNoLock.
+func (lru *LRU_K[T]) unlocked() bool {
+	return lru.nolock
+}
@@ -0,0 +1,67 @@
+package lrukgo
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// TestLRUK_NoLock tests that a cache made with NewLRUNoLock behaves like a
+// locked one and that its clone does not lock either
+func TestLRUK_NoLock(t *testing.T) {
+	lru := NewLRUNoLock[string](2, 2, 0)
+	if !lru.unlocked() {
+		t.Fatal("Expected the cache not to lock")
+	}
+
+	lru.SetAt("key1", []byte("data1"), 10)
+	lru.SetAt("key2", []byte("data2"), 20)
+	lru.GetAt("key2", 30)
+	lru.SetAt("key3", []byte("data3"), 40) // evicts key1
+	if _, present := lru.GetAt("key1", 50); present {
+		t.Error("Expected key1 to be evicted")
+	}
+	if data, present := lru.GetAt("key3", 60); !present || string(data) != "data3" {
+		t.Errorf("Expected (data3, true), got (%s, %v)", data, present)
+	}
+
+	lru.CleanupConcurrency = 4
+	lru.RIP = 1
+	lru.CleanupPass()
+
+	clone := lru.Clone()
+	if !clone.unlocked() {
+		t.Error("Expected the clone not to lock")
+	}
+	if NewLRU[string](2, 2, 0).Clone().unlocked() {
+		t.Error("Expected the clone of a locked cache to lock")
+	}
+
+	lru.CleanupInterval = time.Millisecond
+	expectPanic(t, func() { lru.StartCleanup() }, "StartCleanup without a lock")
+	expectPanic(t, func() { lru.StartCleanupContext(context.Background()) }, "StartCleanupContext without a lock")
+}
+
+// benchmarkGetSet reads and rewrites resident keys from a single
+// goroutine, so no eviction scan hides the cost of the lock
+func benchmarkGetSet(b *testing.B, lru *LRU_K[int]) {
+	data := []byte("data")
+	for key := 0; key < lru.Capacity; key++ {
+		lru.Set(key, data)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		key := i % lru.Capacity
+		lru.Get(key)
+		lru.Set(key, data)
+	}
+}
+
+func BenchmarkLRUK_GetSet_Locked(b *testing.B) {
+	benchmarkGetSet(b, NewLRU[int](2, 128, 0))
+}
+
+func BenchmarkLRUK_GetSet_NoLock(b *testing.B) {
+	benchmarkGetSet(b, NewLRUNoLock[int](2, 128, 0))
+}
@@ -0,0 +1,92 @@
+package lrukgo
+
+import "time"
+
+// SetWithTags is Set that also tags the page, replacing any tags it had,
+// so that every page sharing a tag can be evicted at once with
+// EvictByTag, e.g. the cached results of queries over a table when the
+// table changes. A plain Set keeps the existing tags. The tags last as
+// long as the page is resident. A nil data removes the page as Set does.
+func (lru *LRU_K[T]) SetWithTags(key T, data []byte, tags []string) (success bool) {
+	lru.lock()
+	defer lru.unlock()
+
+	if data == nil {
+		lru.purge(key)
+		return true
+	}
+	if _, admitted := lru.set(key, data, time.Now().Unix()); !admitted {
+		return false
+	}
+
+	lru.untag(key)
+	if len(tags) == 0 {
+		return true
+	}
+	if lru.tags == nil {
+		lru.tags = make(map[string]map[T]struct{})
+		lru.keyTags = make(map[T][]string)
+	}
+	keyTags := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		keys := lru.tags[tag]
+		if keys == nil {
+			keys = make(map[T]struct{})
+			lru.tags[tag] = keys
+		}
+		if _, tagged := keys[key]; tagged {
+			continue
+		}
+		keys[key] = struct{}{}
+		keyTags = append(keyTags, tag)
+	}
+	lru.keyTags[key] = keyTags
+	return true
+}
+
+// EvictByTag evicts every resident page tagged with tag the way Evict
+// does, keeping their history, calling OnEvictDetailed for each and
+// returning how many were evicted.
+func (lru *LRU_K[T]) EvictByTag(tag string) int {
+	lru.lock()
+	defer lru.unlock()
+
+	evicted := 0
+	for key := range lru.tags[tag] {
+		if _, ok := lru.evictPage(key); ok {
+			evicted++
+		}
+	}
+	return evicted
+}
+
+// Tags returns the tags of a resident page, nil if it has none.
+func (lru *LRU_K[T]) Tags(key T) []string {
+	lru.lock()
+	defer lru.unlock()
+
+	return append([]string(nil), lru.keyTags[key]...)
+}
+
+// untag removes key from the tag index, dropping the tags no page
+// carries any more. It must be called with Mu held.
+func (lru *LRU_K[T]) untag(key T) {
+	for _, tag := range lru.keyTags[key] {
+		delete(lru.tags[tag], key)
+		if len(lru.tags[tag]) == 0 {
+			delete(lru.tags, tag)
+		}
+	}
+	delete(lru.keyTags, key)
+}
+
+func cloneTags[T comparable](tags map[string]map[T]struct{}) map[string]map[T]struct{} {
+	if tags == nil {
+		return nil
+	}
+	clone := make(map[string]map[T]struct{}, len(tags))
+	for tag, keys := range tags {
+		clone[tag] = cloneMap(keys)
+	}
+	return clone
+}
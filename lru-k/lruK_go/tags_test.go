@@ -0,0 +1,84 @@
+package lrukgo
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// TestLRUK_EvictByTag tests that every page carrying a tag is evicted at
+// once and keeps its history
+func TestLRUK_EvictByTag(t *testing.T) {
+	lru := NewLRU[string](2, 10, 0)
+	var evicted []string
+	lru.OnEvictDetailed = func(key string, data []byte, history []int64) {
+		evicted = append(evicted, key)
+	}
+
+	lru.SetWithTags("q1", []byte("r1"), []string{"users"})
+	lru.SetWithTags("q2", []byte("r2"), []string{"users", "orders", "users"})
+	lru.SetWithTags("q3", []byte("r3"), []string{"orders"})
+	lru.Set("q4", []byte("r4"))
+
+	if tags := lru.Tags("q2"); !reflect.DeepEqual(tags, []string{"users", "orders"}) {
+		t.Errorf("Expected q2 tagged users and orders once each, got %v", tags)
+	}
+
+	if n := lru.EvictByTag("users"); n != 2 {
+		t.Errorf("Expected 2 pages evicted, got %d", n)
+	}
+	sort.Strings(evicted)
+	if !reflect.DeepEqual(evicted, []string{"q1", "q2"}) {
+		t.Errorf("Expected q1 and q2 reported evicted, got %v", evicted)
+	}
+	if lru.Size() != 2 || !lru.HIST.exists("q1") {
+		t.Errorf("Expected q3 and q4 to stay and q1 to keep its history, size %d", lru.Size())
+	}
+	if n := lru.EvictByTag("users"); n != 0 {
+		t.Errorf("Expected nothing left to evict, got %d", n)
+	}
+	if _, ok := lru.tags["users"]; ok {
+		t.Error("Expected the emptied tag to be dropped from the index")
+	}
+	if keys := lru.tags["orders"]; len(keys) != 1 {
+		t.Errorf("Expected only q3 left under orders, got %v", keys)
+	}
+	if stats := lru.Stats(); stats.Evictions != 2 {
+		t.Errorf("Expected 2 evictions, got %+v", stats)
+	}
+}
+
+// TestLRUK_TagsFollowThePage tests that a plain Set keeps the tags and
+// that Cleanup and capacity evictions drop them
+func TestLRUK_TagsFollowThePage(t *testing.T) {
+	lru := NewLRU[string](1, 2, 0)
+	lru.SetWithTags("a", []byte("a"), []string{"t"})
+	lru.Set("a", []byte("a2"))
+	if tags := lru.Tags("a"); !reflect.DeepEqual(tags, []string{"t"}) {
+		t.Errorf("Expected a plain Set to keep the tags, got %v", tags)
+	}
+	lru.SetWithTags("a", []byte("a3"), nil)
+	if tags := lru.Tags("a"); tags != nil {
+		t.Errorf("Expected SetWithTags to replace the tags, got %v", tags)
+	}
+
+	lru.SetWithTags("b", []byte("b"), []string{"t"})
+	lru.Cleanup("b")
+	if _, ok := lru.tags["t"]; ok {
+		t.Errorf("Expected Cleanup to drop the tags, got %v", lru.tags)
+	}
+
+	lru.SetWithTags("c", []byte("c"), []string{"t"})
+	single := NewLRU[string](1, 1, 0)
+	single.SetWithTags("x", []byte("x"), []string{"t"})
+	single.SetWithTags("y", []byte("y"), []string{"u"}) // evicts x
+	if _, ok := single.tags["t"]; ok || len(single.keyTags) != 1 {
+		t.Errorf("Expected the evicted page to leave the index, got %v", single.tags)
+	}
+
+	clone := lru.Clone()
+	clone.EvictByTag("t")
+	if len(lru.tags["t"]) != 1 {
+		t.Error("Expected the clone to have a tag index of its own")
+	}
+}
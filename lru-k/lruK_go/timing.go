@@ -0,0 +1,62 @@
+package lrukgo
+
+import (
+	"math"
+	"math/bits"
+	"time"
+)
+
+// latencyHistogram counts durations in buckets of powers of two
+// nanoseconds, bucket i holding those below 2^i ns, so recording never
+// allocates and the whole int64 range fits in 64 buckets.
+type latencyHistogram struct {
+	buckets [64]uint64
+	count   uint64
+	max     time.Duration
+}
+
+// record adds the time elapsed since start. It is meant to be deferred
+// right after Mu is taken, so it runs before Mu is released.
+func (h *latencyHistogram) record(start time.Time) {
+	d := time.Since(start)
+	if d < 0 {
+		d = 0
+	}
+	h.buckets[bits.Len64(uint64(d))]++
+	h.count++
+	h.max = max(h.max, d)
+}
+
+// quantile returns the upper bound of the bucket holding the q-th
+// quantile, never more than the largest duration seen.
+func (h *latencyHistogram) quantile(q float64) time.Duration {
+	if h.count == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(h.count)))
+	seen := uint64(0)
+	for i, n := range h.buckets {
+		seen += n
+		if seen >= rank {
+			upper := time.Duration(math.MaxInt64)
+			if i < 63 {
+				upper = time.Duration(1)<<i - 1
+			}
+			return min(upper, h.max)
+		}
+	}
+	return h.max
+}
+
+// LatencyStats returns the median, 99th percentile and largest time
+// spent in Get and Set under the lock while EnableTiming was set. The
+// percentiles are read off power of two buckets, so they are upper
+// bounds at most twice the real value. All are zero when nothing was
+// timed.
+func (lru *LRU_K[T]) LatencyStats() (p50, p99, max time.Duration) {
+	lru.lock()
+	defer lru.unlock()
+
+	return lru.latency.quantile(0.50), lru.latency.quantile(0.99), lru.latency.max
+}
@@ -0,0 +1,68 @@
+package lrukgo
+
+import (
+	"testing"
+	"time"
+)
+
+// TestLatencyHistogram tests the quantiles read off the buckets
+func TestLatencyHistogram(t *testing.T) {
+	var h latencyHistogram
+	if h.quantile(0.5) != 0 {
+		t.Error("Expected an empty histogram to report 0")
+	}
+
+	h.buckets[4] = 98 // 8ns to 15ns
+	h.buckets[10] = 1 // 512ns to 1023ns
+	h.buckets[20] = 1 // around a millisecond
+	h.count = 100
+	h.max = 600 * time.Microsecond
+
+	if p50 := h.quantile(0.50); p50 != 15 {
+		t.Errorf("Expected p50 15ns, got %v", p50)
+	}
+	if p99 := h.quantile(0.99); p99 != 1023 {
+		t.Errorf("Expected p99 1023ns, got %v", p99)
+	}
+	if top := h.quantile(1); top != h.max {
+		t.Errorf("Expected the top bucket to be capped at the max, got %v", top)
+	}
+}
+
+// TestLRUK_LatencyStats tests that Get and Set are timed only when enabled
+func TestLRUK_LatencyStats(t *testing.T) {
+	lru := NewLRU[int](2, 8, 1)
+	lru.Set(1, []byte("data"))
+	lru.Get(1)
+	if p50, p99, max := lru.LatencyStats(); p50 != 0 || p99 != 0 || max != 0 {
+		t.Errorf("Expected nothing timed while disabled, got %v %v %v", p50, p99, max)
+	}
+
+	lru.EnableTiming = true
+	for i := 0; i < 100; i++ {
+		lru.Set(i, []byte("data"))
+		lru.Get(i)
+	}
+	if lru.latency.count != 200 {
+		t.Errorf("Expected 200 timed operations, got %d", lru.latency.count)
+	}
+	p50, p99, max := lru.LatencyStats()
+	if max <= 0 || p50 > p99 || p99 > max {
+		t.Errorf("Expected 0 < p50 <= p99 <= max, got %v %v %v", p50, p99, max)
+	}
+}
+
+// TestLRUK_TimingDisabledDoesNotAllocate tests that disabled timing adds no allocation
+func TestLRUK_TimingDisabledDoesNotAllocate(t *testing.T) {
+	lru := NewLRU[int](2, 8, 1)
+	lru.Set(1, []byte("data"))
+	data := []byte("data")
+
+	allocs := testing.AllocsPerRun(100, func() {
+		lru.Get(1)
+		lru.Set(1, data)
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations, got %v", allocs)
+	}
+}
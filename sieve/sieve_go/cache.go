@@ -0,0 +1,24 @@
+package sievego
+
+// Cache adapts a Sieve to cachego.Cache, so tooling written against
+// that interface works with it: Get returns the value as well as its
+// presence and Set is Insert. Every other method is the one of Sieve.
+type Cache[T comparable] struct {
+	*Sieve[T]
+}
+
+// AsCache returns sieve as a cachego.Cache.
+func (sieve *Sieve[T]) AsCache() Cache[T] {
+	return Cache[T]{sieve}
+}
+
+// Get is Sieve.Get returning the value of a hit.
+func (c Cache[T]) Get(key T) (any, bool) {
+	value, found, _ := c.lookup(key)
+	return value, found
+}
+
+// Set is Insert.
+func (c Cache[T]) Set(key T, value any) {
+	c.Insert(key, value)
+}
@@ -0,0 +1,38 @@
+package sievego
+
+import (
+	"testing"
+
+	cachego "cache_go"
+)
+
+var _ cachego.Cache[string, any] = Cache[string]{}
+
+// TestAsCache tests the adapter and that Delete moves the hand off the deleted node
+func TestAsCache(t *testing.T) {
+	sieve := NewSieve[string](2)
+	var c cachego.Cache[string, any] = sieve.AsCache()
+
+	c.Set("a", 1)
+	c.Set("b", 2)
+	if value, ok := c.Get("b"); !ok || value != 2 {
+		t.Errorf("Expected (2, true), got (%v, %v)", value, ok)
+	}
+	c.Set("c", 3) // a is evicted and the hand stops on b
+	if hand := sieve.getHand(); hand == nil || hand.key != "b" {
+		t.Fatal("Expected the hand on b after the eviction of a")
+	}
+
+	if !c.Delete("b") || c.Delete("b") {
+		t.Error("Expected Delete to report the key only while it is resident")
+	}
+	if hand := sieve.getHand(); hand == nil || hand.key != "c" {
+		t.Error("Expected the hand to move off the deleted node to c")
+	}
+	if c.Len() != 1 || c.Stats().Evictions != 1 {
+		t.Errorf("Expected one object left and one eviction, got %+v", c.Stats())
+	}
+	if err := sieve.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
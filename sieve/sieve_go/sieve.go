@@ -1,28 +1,84 @@
 package sievego
 
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	cachego "cache_go"
+)
+
 type Node[T comparable] struct {
 	key            T
 	end_identifier int
 	next           *Node[T]
 	prev           *Node[T]
 	value          any
-	visited        bool
+	visited        atomic.Bool
+	size           int
+	weight         int
+	tags           []string
 }
 
 func NewNode[T comparable](value any) *Node[T] {
 
 	return &Node[T]{
-		value:   value,
-		visited: false,
+		value: value,
 	}
 
 }
 
 type Sieve[T comparable] struct {
+	// Mu guards the queue, the hand and Nodes for every exported method.
+	// Get and GetTraced only read the map and mark a node visited, so
+	// they take it for reading and share it with each other. The visited
+	// bit and the counters they touch are updated atomically for that.
+	Mu sync.RWMutex
+
 	hand      *Node[T]
 	Capacity  int
 	Nodes     map[T]*Node[T]
 	FifoQueue *FIFOQueue[T]
+
+	// MaxBytes is an optional budget on the summed size of all values
+	// inserted with InsertWithSize, 0 disables it.
+	MaxBytes  int
+	bytesUsed int
+
+	// Weight gives the cost of a value and MaxWeight bounds the summed
+	// weight of all resident values, 0 disables the bound. Without a
+	// Weight every value weighs 1, so CurrentWeight is the number of
+	// resident objects.
+	Weight     func(value any) int
+	MaxWeight  int
+	weightUsed int
+
+	insertAt InsertPosition
+
+	// tags indexes the nodes inserted with InsertWithTags by tag, see
+	// EvictByTag. Each node also holds its own tags so that removing it
+	// can take it out of the index.
+	tags map[string]map[T]struct{}
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+	scan      ScanStats
+}
+
+// ScanStats describes the work the hand did across all evictions.
+type ScanStats struct {
+	// Cleared is the number of visited bits the hand cleared.
+	Cleared uint64
+	// FullSweeps counts evictions that had to clear the visited bit of
+	// every resident node before finding a victim.
+	FullSweeps uint64
+	// SecondChances counts hits that set the visited bit of an unvisited
+	// node, see GetTraced.
+	SecondChances uint64
 }
 
 func NewSieve[T comparable](cap int) *Sieve[T] {
@@ -38,6 +94,52 @@ func NewSieve[T comparable](cap int) *Sieve[T] {
 	}
 }
 
+// NewSieveWithBytes creates a sieve bounded both by the number of
+// objects and by the total size of their values.
+func NewSieveWithBytes[T comparable](cap int, maxBytes int) *Sieve[T] {
+	if maxBytes <= 0 {
+		panic("byte capacity has to be greater than 0")
+	}
+	sieve := NewSieve[T](cap)
+	sieve.MaxBytes = maxBytes
+	return sieve
+}
+
+// NewSieveWithWeight creates a sieve whose values together weigh at
+// most maxWeight, as measured by weight. Every value is expected to
+// weigh at least 1, so the sieve never holds more than maxWeight
+// objects.
+func NewSieveWithWeight[T comparable](maxWeight int, weight func(value any) int) *Sieve[T] {
+	if weight == nil {
+		panic("weight function is required")
+	}
+	sieve := NewSieve[T](maxWeight)
+	sieve.Weight = weight
+	sieve.MaxWeight = maxWeight
+	return sieve
+}
+
+// InsertPosition is the end of the queue new objects are inserted at.
+type InsertPosition int
+
+const (
+	// InsertAtHead inserts new objects at the head, as in the SIEVE
+	// paper, so they are the last ones the hand reaches.
+	InsertAtHead InsertPosition = iota
+	// InsertAtTail inserts new objects at the tail, where a hand that
+	// wrapped around examines them first, so objects that are not
+	// reused soon after insertion are evicted sooner.
+	InsertAtTail
+)
+
+// NewSieveInsertAt creates a sieve that inserts new objects at the
+// given end of the queue.
+func NewSieveInsertAt[T comparable](cap int, at InsertPosition) *Sieve[T] {
+	sieve := NewSieve[T](cap)
+	sieve.insertAt = at
+	return sieve
+}
+
 type FIFOQueue[T comparable] struct {
 	head *Node[T]
 	tail *Node[T]
@@ -46,12 +148,10 @@ type FIFOQueue[T comparable] struct {
 func NewFifoQueue[T comparable]() *FIFOQueue[T] {
 
 	head := &Node[T]{
-		visited:        false,
 		end_identifier: 1,
 	}
 
 	tail := &Node[T]{
-		visited:        false,
 		end_identifier: -1,
 	}
 	head.next = tail
@@ -65,6 +165,9 @@ func NewFifoQueue[T comparable]() *FIFOQueue[T] {
 }
 
 func (sieve *Sieve[T]) IsEmpty() bool {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
 	return len(sieve.Nodes) == 0
 }
 
@@ -72,15 +175,39 @@ func (sieve *Sieve[T]) getHand() *Node[T] {
 	return sieve.hand
 }
 func (sieve *Sieve[T]) Get(key T) bool {
+	found, _ := sieve.GetTraced(key)
+	return found
+}
+
+// GetTraced is Get that also reports whether this access granted the
+// node a second chance, that is the node was unvisited and would have
+// been evicted when the hand reached it, and is now spared. A node that
+// was already visited reports false.
+func (sieve *Sieve[T]) GetTraced(key T) (found, secondChance bool) {
+	_, found, secondChance = sieve.lookup(key)
+	return found, secondChance
+}
+
+// lookup is GetTraced that also returns the value of the node.
+func (sieve *Sieve[T]) lookup(key T) (value any, found, secondChance bool) {
+	sieve.Mu.RLock()
+	defer sieve.Mu.RUnlock()
 
 	node, present := sieve.Nodes[key]
 	if !present {
-		return false
+		atomic.AddUint64(&sieve.misses, 1)
+		return nil, false, false
 	}
 
-	node.visited = true
-	return true
-
+	atomic.AddUint64(&sieve.hits, 1)
+	// Most hits are on nodes that are visited already, checking first
+	// keeps them from writing to the node at all. Of racing hits on an
+	// unvisited node only the one that flips the bit grants the chance.
+	secondChance = !node.visited.Load() && node.visited.CompareAndSwap(false, true)
+	if secondChance {
+		atomic.AddUint64(&sieve.scan.SecondChances, 1)
+	}
+	return node.value, true, secondChance
 }
 
 func (fifoQueue *FIFOQueue[T]) getHead() *Node[T] {
@@ -127,39 +254,518 @@ func (fifoQueue *FIFOQueue[T]) insertNode(value any, prev, next *Node[T]) *Node[
 
 	return curr
 }
-func (sieve *Sieve[T]) Insert(key T, data any) {
-	if len(sieve.Nodes) == sieve.Capacity {
-		hand := sieve.getHand()
-		if hand == nil || hand.end_identifier == 1 {
-			hand = sieve.FifoQueue.getTail()
-		}
 
-		hand = hand.prev
+// Entries returns every object from the tail of the queue to the head,
+// oldest first, so replaying them through Insert rebuilds the same queue.
+func (sieve *Sieve[T]) Entries() []cachego.Entry[T, any] {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
 
-		for hand.visited  {
-			hand.visited = false
-			hand = hand.prev
+	entries := make([]cachego.Entry[T, any], 0, len(sieve.Nodes))
+	head := sieve.FifoQueue.getHead()
+	for node := sieve.FifoQueue.getTail().prev; node != head; node = node.prev {
+		entries = append(entries, cachego.Entry[T, any]{Key: node.key, Value: node.value})
+	}
+	return entries
+}
 
-			if hand.end_identifier == 1 {
-				hand = sieve.FifoQueue.getTail()
-				hand=hand.prev
-			}
+func (sieve *Sieve[T]) Stats() cachego.Stats {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      sieve.hits,
+		Misses:    sieve.misses,
+		Evictions: sieve.evictions,
+		Len:       len(sieve.Nodes),
+		Cap:       sieve.Capacity,
+	}
+}
+
+// String lists the queue from head to tail, marking visited objects
+// with * and the object the hand examines next with <H>, e.g.
+// "[k3 k2* <H>k1]". When the hand is not set the next scan starts at the
+// tail, so the oldest object is marked.
+func (sieve *Sieve[T]) String() string {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	next := sieve.hand
+	if next == nil {
+		next = sieve.FifoQueue.getTail().prev
+	}
+
+	var b strings.Builder
+	b.WriteByte('[')
+	head, tail := sieve.FifoQueue.getHead(), sieve.FifoQueue.getTail()
+	for node := head.next; node != tail; node = node.next {
+		if node != head.next {
+			b.WriteByte(' ')
+		}
+		if node == next {
+			b.WriteString("<H>")
 		}
+		fmt.Fprint(&b, node.key)
+		if node.visited.Load() {
+			b.WriteByte('*')
+		}
+	}
+	b.WriteByte(']')
+	return b.String()
+}
 
+// ScanStats returns the scan counters accumulated by the hand.
+func (sieve *Sieve[T]) ScanStats() ScanStats {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	return sieve.scan
+}
+
+// Recommendation suggests how many slots to add to the sieve. A full
+// sweep means every resident object was used again since the hand last
+// passed it, so the working set does not fit; the suggestion is the
+// capacity scaled by the share of evictions that were full sweeps,
+// rounded up. It is advisory only and never changes the capacity.
+func (sieve *Sieve[T]) Recommendation() (growBy int) {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	if sieve.evictions == 0 || sieve.scan.FullSweeps == 0 {
+		return 0
+	}
+	scaled := uint64(sieve.Capacity) * sieve.scan.FullSweeps
+	return int((scaled + sieve.evictions - 1) / sieve.evictions)
+}
+
+// BytesUsed returns the summed size of all resident values.
+func (sieve *Sieve[T]) BytesUsed() int {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	return sieve.bytesUsed
+}
+
+// CurrentWeight returns the summed weight of all resident values.
+func (sieve *Sieve[T]) CurrentWeight() int {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	return sieve.weightUsed
+}
+
+// weightOf returns the weight of value, 1 without a Weight function.
+func (sieve *Sieve[T]) weightOf(value any) int {
+	if sieve.Weight == nil {
+		return 1
+	}
+	weight := sieve.Weight(value)
+	if weight < 0 {
+		panic("weight cannot be negative")
+	}
+	return weight
+}
+
+// evict runs the hand from its current position towards the head,
+// clearing visited bits, and removes the first unvisited node. The hand
+// is left on the node before the evicted one, which is the next one to
+// be examined, or nil when that is the head so the next scan wraps to
+// the tail.
+func (sieve *Sieve[T]) evict() {
+	hand := sieve.getHand()
+	if hand == nil || hand.end_identifier == 1 {
+		hand = sieve.FifoQueue.getTail().prev
+	}
+
+	cleared := 0
+	for hand.visited.Load() {
+		hand.visited.Store(false)
+		cleared++
 		hand = hand.prev
 
-		sieve.hand = hand
+		if hand.end_identifier == 1 {
+			hand = sieve.FifoQueue.getTail().prev
+		}
+	}
 
-		nodeToBeDeleted := hand.next
-		sieve.FifoQueue.deleteNode(nodeToBeDeleted)
-		delete(sieve.Nodes, nodeToBeDeleted.key)
+	sieve.hand = hand.prev
+	if sieve.hand.end_identifier == 1 {
+		sieve.hand = nil
 	}
 
-	head := sieve.FifoQueue.getHead()
+	sieve.scan.Cleared += uint64(cleared)
+	if cleared >= len(sieve.Nodes) {
+		sieve.scan.FullSweeps++
+	}
 
-	currNode := sieve.FifoQueue.insertNode(data, head, head.next)
+	sieve.FifoQueue.deleteNode(hand)
+	sieve.untag(hand)
+	delete(sieve.Nodes, hand.key)
+	sieve.bytesUsed -= hand.size
+	sieve.weightUsed -= hand.weight
+	sieve.evictions++
+}
+
+// Insert adds key at the head of the queue, or the tail, see
+// NewSieveInsertAt. The hand evicts until there is room for the object
+// and its weight. A value heavier than MaxWeight can never fit and is
+// dropped, leaving the sieve unchanged.
+func (sieve *Sieve[T]) Insert(key T, data any) {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	sieve.insert(key, data, 0)
+}
+
+// InsertWithSize inserts data accounting size bytes against MaxBytes.
+// The hand keeps evicting until both the object count and the byte
+// budget have room for the new value. A value larger than the whole
+// budget is rejected and false is returned.
+func (sieve *Sieve[T]) InsertWithSize(key T, data any, size int) bool {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	return sieve.insert(key, data, size)
+}
+
+// insert adds key at the end of the queue chosen by insertAt. A key that is already
+// resident is replaced, its old node is removed first so Nodes and the
+// queue never disagree.
+func (sieve *Sieve[T]) insert(key T, data any, size int) bool {
+	if sieve.MaxBytes > 0 && size > sieve.MaxBytes {
+		return false
+	}
+	weight := sieve.weightOf(data)
+	if sieve.MaxWeight > 0 && weight > sieve.MaxWeight {
+		return false
+	}
+
+	if node, present := sieve.Nodes[key]; present {
+		sieve.removeNode(node)
+	}
+
+	for len(sieve.Nodes) > 0 && (len(sieve.Nodes) >= sieve.Capacity ||
+		(sieve.MaxBytes > 0 && sieve.bytesUsed+size > sieve.MaxBytes) ||
+		(sieve.MaxWeight > 0 && sieve.weightUsed+weight > sieve.MaxWeight)) {
+		sieve.evict()
+	}
+
+	prev, next := sieve.FifoQueue.getHead(), sieve.FifoQueue.getHead().next
+	if sieve.insertAt == InsertAtTail {
+		prev, next = sieve.FifoQueue.getTail().prev, sieve.FifoQueue.getTail()
+	}
+
+	currNode := sieve.FifoQueue.insertNode(data, prev, next)
 	currNode.key = key
+	currNode.size = size
+	currNode.weight = weight
 	sieve.Nodes[key] = currNode
-	currNode.visited = false
+	sieve.bytesUsed += size
+	sieve.weightUsed += weight
+	currNode.visited.Store(false)
+
+	return true
+}
+
+// removeNode unlinks a node that is not being evicted by the hand,
+// moving the hand off it first so it never points at a dead node.
+func (sieve *Sieve[T]) removeNode(node *Node[T]) {
+	if sieve.hand == node {
+		sieve.hand = node.prev
+		if sieve.hand.end_identifier == 1 {
+			sieve.hand = nil
+		}
+	}
+	sieve.FifoQueue.deleteNode(node)
+	sieve.untag(node)
+	delete(sieve.Nodes, node.key)
+	sieve.bytesUsed -= node.size
+	sieve.weightUsed -= node.weight
+}
+
+// Delete removes key right away and reports whether it was resident.
+// The hand moves off its node like for a replaced key, and it is not
+// counted as an eviction.
+func (sieve *Sieve[T]) Delete(key T) bool {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	node, present := sieve.Nodes[key]
+	if !present {
+		return false
+	}
+	sieve.removeNode(node)
+	return true
+}
+
+// Len returns the number of resident objects.
+func (sieve *Sieve[T]) Len() int {
+	sieve.Mu.RLock()
+	defer sieve.Mu.RUnlock()
+
+	return len(sieve.Nodes)
+}
+
+// InsertWithTags is Insert that also tags the object, so that every
+// object sharing a tag can be evicted at once with EvictByTag, e.g. the
+// cached results of queries over a table when the table changes. The
+// tags belong to the node: a plain Insert of the key replaces the node
+// and drops them, and they are not written by MarshalJSON.
+func (sieve *Sieve[T]) InsertWithTags(key T, data any, tags []string) {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	if !sieve.insert(key, data, 0) || len(tags) == 0 {
+		return
+	}
+	if sieve.tags == nil {
+		sieve.tags = make(map[string]map[T]struct{})
+	}
+	node := sieve.Nodes[key]
+	for _, tag := range tags {
+		keys := sieve.tags[tag]
+		if keys == nil {
+			keys = make(map[T]struct{})
+			sieve.tags[tag] = keys
+		}
+		if _, tagged := keys[key]; tagged {
+			continue
+		}
+		keys[key] = struct{}{}
+		node.tags = append(node.tags, tag)
+	}
+}
+
+// EvictByTag removes every object tagged with tag and returns how many
+// there were. They count as evictions. The hand is moved off each node
+// before it goes, as it is for a replaced key, so wherever it stood it
+// ends on a node that is still in the queue.
+func (sieve *Sieve[T]) EvictByTag(tag string) int {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	evicted := 0
+	for key := range sieve.tags[tag] {
+		sieve.removeNode(sieve.Nodes[key])
+		sieve.evictions++
+		evicted++
+	}
+	return evicted
+}
+
+// untag removes node from the tag index, dropping the tags no node
+// carries any more.
+func (sieve *Sieve[T]) untag(node *Node[T]) {
+	for _, tag := range node.tags {
+		delete(sieve.tags[tag], node.key)
+		if len(sieve.tags[tag]) == 0 {
+			delete(sieve.tags, tag)
+		}
+	}
+	node.tags = nil
+}
+
+// Entry is a key/value pair used to bulk load a sieve.
+type Entry[T comparable] struct {
+	Key   T
+	Value any
+}
+
+// Load inserts entries in order under a single lock, so the last entry
+// ends up at the head of the queue as the most recently inserted one.
+// Every loaded entry starts unvisited, and if there are more entries
+// than room the oldest ones are evicted as they would be by Insert. A
+// key that is already resident is replaced and moved to its new place.
+func (sieve *Sieve[T]) Load(entries []Entry[T]) {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	for _, entry := range entries {
+		sieve.insert(entry.Key, entry.Value, 0)
+	}
+}
+
+// CheckInvariants walks the queue and reports the first inconsistency
+// between it and Nodes: the queue has to be an acyclic doubly linked
+// list between the sentinels holding exactly the nodes in Nodes, every
+// node has to be stored under its own key, the hand has to be nil or on
+// a node of the queue, and the tag index has to hold exactly the tags of
+// the nodes.
+func (sieve *Sieve[T]) CheckInvariants() error {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	head := sieve.FifoQueue.getHead()
+	tail := sieve.FifoQueue.getTail()
+
+	count := 0
+	weight := 0
+	tagged := 0
+	handLinked := sieve.hand == nil
+	prev := head
+	for node := head.next; node != tail; node = node.next {
+		if node == nil {
+			return errors.New("queue ends before the tail")
+		}
+		if node.prev != prev {
+			return fmt.Errorf("node %v has a broken prev link", node.key)
+		}
+		if node.end_identifier != 0 {
+			return fmt.Errorf("sentinel found inside the queue after %d nodes", count)
+		}
+
+		count++
+		if count > len(sieve.Nodes) {
+			return fmt.Errorf("queue holds more nodes than the %d in Nodes or has a cycle", len(sieve.Nodes))
+		}
+		if sieve.Nodes[node.key] != node {
+			return fmt.Errorf("node %v in the queue is not the one stored in Nodes", node.key)
+		}
+		if node == sieve.hand {
+			handLinked = true
+		}
+		weight += node.weight
+		for _, tag := range node.tags {
+			if _, indexed := sieve.tags[tag][node.key]; !indexed {
+				return fmt.Errorf("node %v is tagged %q but not indexed under it", node.key, tag)
+			}
+			tagged++
+		}
+		prev = node
+	}
+	if tail.prev != prev {
+		return errors.New("tail has a broken prev link")
+	}
+
+	if count != len(sieve.Nodes) {
+		return fmt.Errorf("queue holds %d nodes but Nodes holds %d", count, len(sieve.Nodes))
+	}
+	for key, node := range sieve.Nodes {
+		if node.key != key {
+			return fmt.Errorf("Nodes[%v] holds the node for %v", key, node.key)
+		}
+	}
+	if weight != sieve.weightUsed {
+		return fmt.Errorf("nodes weigh %d but the tracked weight is %d", weight, sieve.weightUsed)
+	}
+	if !handLinked {
+		return errors.New("hand points at a node that is not in the queue")
+	}
+	indexed := 0
+	for tag, keys := range sieve.tags {
+		if len(keys) == 0 {
+			return fmt.Errorf("tag %q is indexed without any node", tag)
+		}
+		indexed += len(keys)
+	}
+	if indexed != tagged {
+		return fmt.Errorf("nodes carry %d tags but the index holds %d", tagged, indexed)
+	}
+	return nil
+}
+
+type sieveJSON[T comparable] struct {
+	Capacity  int           `json:"capacity"`
+	MaxBytes  int           `json:"max_bytes,omitempty"`
+	MaxWeight int           `json:"max_weight,omitempty"`
+	Entries   []nodeJSON[T] `json:"entries"`
+}
+
+type nodeJSON[T comparable] struct {
+	Key     T    `json:"key"`
+	Value   any  `json:"value"`
+	Visited bool `json:"visited"`
+	Size    int  `json:"size,omitempty"`
+}
+
+// MarshalJSON encodes the sieve in queue order, from the most recently
+// inserted node to the oldest, keeping every node's visited bit so a
+// restored sieve evicts in the same order. Keys and values have to be
+// JSON encodable.
+func (sieve *Sieve[T]) MarshalJSON() ([]byte, error) {
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	encoded := sieveJSON[T]{
+		Capacity:  sieve.Capacity,
+		MaxBytes:  sieve.MaxBytes,
+		MaxWeight: sieve.MaxWeight,
+		Entries:   make([]nodeJSON[T], 0, len(sieve.Nodes)),
+	}
+
+	tail := sieve.FifoQueue.getTail()
+	for node := sieve.FifoQueue.getHead().next; node != tail; node = node.next {
+		encoded.Entries = append(encoded.Entries, nodeJSON[T]{
+			Key:     node.key,
+			Value:   node.value,
+			Visited: node.visited.Load(),
+			Size:    node.size,
+		})
+	}
+	return json.Marshal(encoded)
+}
+
+// UnmarshalJSON replaces the contents of the sieve with the queue written
+// by MarshalJSON. The hand is reset, so the next eviction starts from
+// the tail. Weight functions cannot be encoded, the weight of every
+// value is measured again with the Weight of the receiving sieve. A
+// capacity below 1, more entries than capacity and a key listed twice
+// are reported as cachego.ErrInvalidCapacity, ErrCacheFull and
+// ErrKeyExists, a single value over MaxBytes or MaxWeight as
+// ErrValueTooLarge and values adding up to more than either budget as
+// ErrCacheFull, leaving the sieve untouched.
+func (sieve *Sieve[T]) UnmarshalJSON(data []byte) error {
+	var decoded sieveJSON[T]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	if decoded.Capacity <= 0 {
+		return fmt.Errorf("%w: got %d", cachego.ErrInvalidCapacity, decoded.Capacity)
+	}
+	if len(decoded.Entries) > decoded.Capacity {
+		return fmt.Errorf("%w: %d entries for a capacity of %d", cachego.ErrCacheFull, len(decoded.Entries), decoded.Capacity)
+	}
+
+	fifoQueue := NewFifoQueue[T]()
+	nodes := make(map[T]*Node[T], len(decoded.Entries))
+	bytesUsed := 0
+	weightUsed := 0
+
+	sieve.Mu.Lock()
+	defer sieve.Mu.Unlock()
+
+	tail := fifoQueue.getTail()
+	for _, entry := range decoded.Entries {
+		if _, present := nodes[entry.Key]; present {
+			return fmt.Errorf("%w: %v appears twice in entries", cachego.ErrKeyExists, entry.Key)
+		}
+		node := fifoQueue.insertNode(entry.Value, tail.prev, tail)
+		node.key = entry.Key
+		node.visited.Store(entry.Visited)
+		node.size = entry.Size
+		node.weight = sieve.weightOf(entry.Value)
+		if (decoded.MaxBytes > 0 && entry.Size > decoded.MaxBytes) || (decoded.MaxWeight > 0 && node.weight > decoded.MaxWeight) {
+			return fmt.Errorf("%w: %v has %d bytes and a weight of %d", cachego.ErrValueTooLarge, entry.Key, entry.Size, node.weight)
+		}
+		nodes[entry.Key] = node
+		bytesUsed += entry.Size
+		weightUsed += node.weight
+	}
+	if decoded.MaxBytes > 0 && bytesUsed > decoded.MaxBytes {
+		return fmt.Errorf("%w: %d bytes for a budget of %d", cachego.ErrCacheFull, bytesUsed, decoded.MaxBytes)
+	}
+	if decoded.MaxWeight > 0 && weightUsed > decoded.MaxWeight {
+		return fmt.Errorf("%w: a weight of %d for a budget of %d", cachego.ErrCacheFull, weightUsed, decoded.MaxWeight)
+	}
 
+	sieve.Capacity = decoded.Capacity
+	sieve.MaxBytes = decoded.MaxBytes
+	sieve.MaxWeight = decoded.MaxWeight
+	sieve.FifoQueue = fifoQueue
+	sieve.Nodes = nodes
+	sieve.tags = nil
+	sieve.bytesUsed = bytesUsed
+	sieve.weightUsed = weightUsed
+	sieve.hand = nil
+	return nil
 }
@@ -1,7 +1,14 @@
 package sievego
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
 	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
 )
 
 // Helper function to check if two nodes are the same
@@ -37,8 +44,8 @@ func TestNewNode(t *testing.T) {
 	if node.next != nil || node.prev != nil {
 		t.Errorf("Expected new node next and prev to be nil, got %v and %v", node.next, node.prev)
 	}
-	if node.visited != false {
-		t.Errorf("Expected new node visited to be false, got %v", node.visited)
+	if node.visited.Load() != false {
+		t.Errorf("Expected new node visited to be false, got %v", node.visited.Load())
 	}
 	if node.end_identifier != 0 {
 		t.Errorf("Expected new node end_identifier to be 0, got %v", node.end_identifier)
@@ -223,6 +230,8 @@ func TestNewSieve(t *testing.T) {
 	if s.hand != nil {
 		t.Errorf("Expected new sieve hand to be nil, got %v", s.hand)
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_IsEmpty(t *testing.T) {
@@ -234,6 +243,8 @@ func TestSieve_IsEmpty(t *testing.T) {
 	if s.IsEmpty() {
 		t.Error("Expected sieve not to be empty after insert")
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_Get(t *testing.T) {
@@ -245,7 +256,7 @@ func TestSieve_Get(t *testing.T) {
 		t.Error("Expected Get to return true for existing key 'key1'")
 	}
 	node1, ok := s.Nodes["key1"]
-	if !ok || !node1.visited {
+	if !ok || !node1.visited.Load() {
 		t.Error("Expected node 'key1' to be marked as visited after Get")
 	}
 
@@ -253,6 +264,8 @@ func TestSieve_Get(t *testing.T) {
 	if s.Get("key2") {
 		t.Error("Expected Get to return false for non-existing key 'key2'")
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_Insert_Basic(t *testing.T) {
@@ -269,8 +282,8 @@ func TestSieve_Insert_Basic(t *testing.T) {
 	if node1.value != "data1" {
 		t.Errorf("Expected node 'key1' value 'data1', got %v", node1.value)
 	}
-	if node1.visited != false { // Inserted node should initially be not visited (as per current logic)
-		t.Errorf("Expected new node 'key1' visited to be false, got %v", node1.visited)
+	if node1.visited.Load() != false { // Inserted node should initially be not visited (as per current logic)
+		t.Errorf("Expected new node 'key1' visited to be false, got %v", node1.visited.Load())
 	}
 
 	// Check FIFO queue
@@ -301,6 +314,8 @@ func TestSieve_Insert_Basic(t *testing.T) {
 			t.Errorf("Expected FIFO value %v at index %d, got %v", expectedQVals[i], i, v)
 		}
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_Insert_Eviction(t *testing.T) {
@@ -396,6 +411,8 @@ func TestSieve_Insert_Eviction(t *testing.T) {
 	if !foundD4 || !foundD2 {
 		t.Errorf("Expected FIFO queue to contain 'data4' and 'data2', got %v", qVals)
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_Insert_Eviction_AllVisited(t *testing.T) {
@@ -443,6 +460,8 @@ func TestSieve_Insert_Eviction_AllVisited(t *testing.T) {
 	if !foundD3 || !foundD2 {
 		t.Errorf("Expected FIFO queue to contain 'data3' and 'data2', got %v", qVals)
 	}
+
+	checkInvariants(t, s)
 }
 
 func TestSieve_Insert_HandBecomesHeadThenTail(t *testing.T) {
@@ -477,12 +496,10 @@ func TestSieve_Insert_HandBecomesHeadThenTail(t *testing.T) {
 		t.Fatalf("Queue: Expected length %d, got %d. Values: %v", len(expectedQValsAfterK2), len(qVals), qVals)
 	}
 	if qVals[0] != "data2" {
-		t.Errorf("Queue: Expected front 'data2', then 'data1', got %v", qVals)
+		t.Errorf("Queue: Expected only 'data2', got %v", qVals)
 	}
 
-	// This test highlights fundamental issues in the eviction logic regarding map cleanup
-	// and potentially queue cleanup in edge cases.
-	// The tests will proceed assuming s.Nodes is NOT cleared.
+	checkInvariants(t, s)
 }
 
 func TestSieve_Insert_FullCapacity_ThenGet(t *testing.T) {
@@ -490,19 +507,656 @@ func TestSieve_Insert_FullCapacity_ThenGet(t *testing.T) {
 	s.Insert("key1", "data1") // Map: {k1:N1}, Q: [N1(d1,v=F)]
 
 	// At this point, len(s.Nodes) == s.Capacity.
-	// The map s.Nodes is not cleared on "eviction" by current code.
-	s.Insert("key2", "data2") // Map: {k1:N1, k2:N2}, Q: [N2(d2,v=F), N1(d1,v=F)] (N1 wasn't really evicted by flawed logic)
-	// s.hand would point to N1.prev (head sentinel).
+	s.Insert("key2", "data2") // Map: {k2:N2}, Q: [N2(d2,v=F)], N1 is evicted
+	// The hand would be on N1.prev, the head sentinel, so it is reset to nil.
 
-	if len(s.Nodes) != 1 { // Because map is not cleared
-		t.Errorf("Expected Nodes length to be 2 (due to no map eviction), got %d", len(s.Nodes))
+	if len(s.Nodes) != 1 {
+		t.Errorf("Expected Nodes length to be 1, got %d", len(s.Nodes))
 	}
 
 	if !s.Get("key2") {
 		t.Error("Expected Get key2 to return true")
 	}
 	node2, _ := s.Nodes["key2"]
-	if !node2.visited {
+	if !node2.visited.Load() {
 		t.Error("Expected key2 to be marked visited after Get")
 	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_InsertWithSize_ByteBudget(t *testing.T) {
+	s := NewSieveWithBytes[string](10, 100)
+
+	s.InsertWithSize("key1", "data1", 40) // Q: [k1], 40 bytes
+	s.InsertWithSize("key2", "data2", 40) // Q: [k2, k1], 80 bytes
+	if s.BytesUsed() != 80 {
+		t.Fatalf("Expected 80 bytes used, got %d", s.BytesUsed())
+	}
+
+	s.Get("key1") // key1 earns a second chance
+
+	// 80 + 50 > 100, so the hand has to evict; key1 is visited so key2 goes
+	if !s.InsertWithSize("key3", "data3", 50) {
+		t.Fatal("Expected key3 to be accepted")
+	}
+	if _, present := s.Nodes["key2"]; present {
+		t.Error("Expected 'key2' to be evicted to make room")
+	}
+	if _, present := s.Nodes["key1"]; !present {
+		t.Error("Expected visited 'key1' to survive")
+	}
+	if s.BytesUsed() != 90 {
+		t.Errorf("Expected 90 bytes used, got %d", s.BytesUsed())
+	}
+
+	// A value that needs several evictions before it fits
+	if !s.InsertWithSize("key4", "data4", 100) {
+		t.Fatal("Expected key4 to be accepted")
+	}
+	if len(s.Nodes) != 1 || s.BytesUsed() != 100 {
+		t.Errorf("Expected only key4 using 100 bytes, got %d nodes using %d bytes", len(s.Nodes), s.BytesUsed())
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_InsertWithSize_RejectsOversized(t *testing.T) {
+	s := NewSieveWithBytes[string](10, 100)
+	s.InsertWithSize("key1", "data1", 30)
+
+	if s.InsertWithSize("big", "bigdata", 101) {
+		t.Error("Expected a value larger than the byte budget to be rejected")
+	}
+	if _, present := s.Nodes["big"]; present {
+		t.Error("Rejected value should not be in the sieve")
+	}
+	if _, present := s.Nodes["key1"]; !present {
+		t.Error("Rejecting a value should not evict anything")
+	}
+	if s.BytesUsed() != 30 {
+		t.Errorf("Expected 30 bytes used, got %d", s.BytesUsed())
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_Stats(t *testing.T) {
+	s := NewSieve[string](2)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+
+	s.Get("key1")
+	s.Get("key1")
+	s.Get("missing")
+
+	s.Insert("key3", "data3") // evicts key2
+
+	stats := s.Stats()
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Evictions != 1 {
+		t.Errorf("Expected 2 hits, 1 miss and 1 eviction, got %+v", stats)
+	}
+	if stats.Len != 2 || stats.Cap != 2 {
+		t.Errorf("Expected Len 2 and Cap 2, got %+v", stats)
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_JSONRoundTrip(t *testing.T) {
+	s := NewSieve[string](3)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+	s.Insert("key3", "data3") // Q: [k3, k2, k1]
+	s.Get("key1")
+	s.Get("key3")
+
+	encoded, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	restored := NewSieve[string](1)
+	if err := json.Unmarshal(encoded, restored); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if restored.Capacity != 3 {
+		t.Errorf("Expected capacity 3, got %d", restored.Capacity)
+	}
+	if restored.hand != nil {
+		t.Error("Expected hand to be reset after Unmarshal")
+	}
+
+	expected := []struct {
+		key     string
+		visited bool
+	}{{"key3", true}, {"key2", false}, {"key1", true}}
+	node := restored.FifoQueue.head.next
+	for _, e := range expected {
+		if node == restored.FifoQueue.tail {
+			t.Fatalf("Restored queue is shorter than expected")
+		}
+		if node.key != e.key || node.visited.Load() != e.visited || node.value != "data"+e.key[3:] {
+			t.Errorf("Expected %s (visited=%v), got %s (visited=%v, value=%v)", e.key, e.visited, node.key, node.visited.Load(), node.value)
+		}
+		if restored.Nodes[node.key] != node {
+			t.Errorf("Nodes map does not point at the queue node for %s", node.key)
+		}
+		node = node.next
+	}
+	if node != restored.FifoQueue.tail || node.prev.next != node {
+		t.Error("Restored queue has extra nodes or broken links")
+	}
+
+	// Both sieves must make the same eviction decision
+	s.Insert("key4", "data4")
+	restored.Insert("key4", "data4")
+	for _, key := range []string{"key1", "key2", "key3"} {
+		_, inOriginal := s.Nodes[key]
+		_, inRestored := restored.Nodes[key]
+		if inOriginal != inRestored {
+			t.Errorf("Eviction diverged for %s: original=%v restored=%v", key, inOriginal, inRestored)
+		}
+	}
+	if _, present := restored.Nodes["key2"]; present {
+		t.Error("Expected unvisited key2 to be evicted from the restored sieve")
+	}
+
+	checkInvariants(t, s)
+	checkInvariants(t, restored)
+}
+
+func TestSieve_UnmarshalJSON_Invalid(t *testing.T) {
+	s := NewSieve[string](2)
+	s.Insert("key1", "data1")
+
+	inputs := []struct {
+		input string
+		want  error
+	}{
+		{`not json`, nil},
+		{`{"capacity":0,"entries":[]}`, cachego.ErrInvalidCapacity},
+		{`{"capacity":1,"entries":[{"key":"a"},{"key":"b"}]}`, cachego.ErrCacheFull},
+		{`{"capacity":2,"entries":[{"key":"a"},{"key":"a"}]}`, cachego.ErrKeyExists},
+		{`{"capacity":2,"max_bytes":4,"entries":[{"key":"a","size":5}]}`, cachego.ErrValueTooLarge},
+		{`{"capacity":2,"max_bytes":4,"entries":[{"key":"a","size":3},{"key":"b","size":3}]}`, cachego.ErrCacheFull},
+		{`{"capacity":2,"max_weight":1,"entries":[{"key":"a"},{"key":"b"}]}`, cachego.ErrCacheFull},
+	}
+	for _, tc := range inputs {
+		err := json.Unmarshal([]byte(tc.input), s)
+		if err == nil {
+			t.Errorf("Expected Unmarshal of %s to fail", tc.input)
+		} else if tc.want != nil && !errors.Is(err, tc.want) {
+			t.Errorf("Expected Unmarshal of %s to fail with %v, got %v", tc.input, tc.want, err)
+		}
+	}
+	if _, present := s.Nodes["key1"]; !present || len(s.Nodes) != 1 {
+		t.Error("A failed Unmarshal must leave the sieve untouched")
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_Load(t *testing.T) {
+	s := NewSieve[string](3)
+	s.Insert("key0", "data0")
+	s.Get("key0")
+
+	s.Load([]Entry[string]{
+		{Key: "key1", Value: "data1"},
+		{Key: "key2", Value: "data2"},
+		{Key: "key0", Value: "data0-new"},
+	})
+
+	qVals := getQueueValues(s.FifoQueue)
+	expectedQVals := []any{"data0-new", "data2", "data1"}
+	if len(qVals) != len(expectedQVals) {
+		t.Fatalf("Expected FIFO queue %v, got %v", expectedQVals, qVals)
+	}
+	for i, v := range qVals {
+		if v != expectedQVals[i] {
+			t.Errorf("Expected FIFO value %v at index %d, got %v", expectedQVals[i], i, v)
+		}
+	}
+	for key, node := range s.Nodes {
+		if node.visited.Load() {
+			t.Errorf("Expected loaded key %s to be unvisited", key)
+		}
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_Load_OverCapacity(t *testing.T) {
+	s := NewSieve[string](2)
+
+	s.Load([]Entry[string]{
+		{Key: "key1", Value: "data1"},
+		{Key: "key2", Value: "data2"},
+		{Key: "key3", Value: "data3"},
+		{Key: "key4", Value: "data4"},
+	})
+
+	if len(s.Nodes) != 2 {
+		t.Fatalf("Expected 2 nodes, got %d", len(s.Nodes))
+	}
+	for _, key := range []string{"key3", "key4"} {
+		if _, present := s.Nodes[key]; !present {
+			t.Errorf("Expected the newest entry %s to be kept", key)
+		}
+	}
+	if s.FifoQueue.head.next.key != "key4" {
+		t.Errorf("Expected key4 at the head, got %s", s.FifoQueue.head.next.key)
+	}
+
+	checkInvariants(t, s)
+}
+
+// checkInvariants fails the test if the sieve's queue and Nodes disagree
+func checkInvariants[T comparable](t *testing.T, s *Sieve[T]) {
+	t.Helper()
+	if err := s.CheckInvariants(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestSieve_Insert_ExistingKey(t *testing.T) {
+	s := NewSieveWithBytes[string](3, 100)
+	s.InsertWithSize("key1", "data1", 10)
+	s.InsertWithSize("key2", "data2", 10)
+	s.InsertWithSize("key1", "data1-new", 30) // Q: [k1, k2]
+
+	if len(s.Nodes) != 2 {
+		t.Errorf("Expected 2 nodes, got %d", len(s.Nodes))
+	}
+	qVals := getQueueValues(s.FifoQueue)
+	if len(qVals) != 2 || qVals[0] != "data1-new" || qVals[1] != "data2" {
+		t.Errorf("Expected FIFO queue [data1-new data2], got %v", qVals)
+	}
+	if s.BytesUsed() != 40 {
+		t.Errorf("Expected 40 bytes used, got %d", s.BytesUsed())
+	}
+
+	// Replacing the node the hand is on moves the hand off it
+	s.Insert("key3", "data3")
+	s.Insert("key4", "data4") // evicts key2, hand on key1
+	s.Insert("key1", "data1-newer")
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_CheckInvariants_DetectsDrift(t *testing.T) {
+	s := NewSieve[string](3)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+
+	s.Nodes["ghost"] = s.Nodes["key1"]
+	if s.CheckInvariants() == nil {
+		t.Error("Expected a key missing from the queue to be reported")
+	}
+	delete(s.Nodes, "ghost")
+
+	s.hand = NewNode[string]("detached")
+	if s.CheckInvariants() == nil {
+		t.Error("Expected a hand off the queue to be reported")
+	}
+	s.hand = nil
+
+	s.Nodes["key2"].next = s.Nodes["key2"]
+	if s.CheckInvariants() == nil {
+		t.Error("Expected a cycle to be reported")
+	}
+}
+
+func TestSieve_Recommendation(t *testing.T) {
+	s := NewSieve[int](4)
+	for key := 0; key < 4; key++ {
+		s.Insert(key, key)
+	}
+
+	// A scan of new keys never revisits anything, so no growth is suggested
+	for key := 100; key < 120; key++ {
+		s.Insert(key, key)
+	}
+	if growBy := s.Recommendation(); growBy != 0 {
+		t.Errorf("Expected no recommendation for a scan, got %d", growBy)
+	}
+
+	// Using every resident key before each insert leaves nothing unvisited
+	s = NewSieve[int](4)
+	for key := 0; key < 4; key++ {
+		s.Insert(key, key)
+	}
+	for key := 4; key < 8; key++ {
+		for resident := range s.Nodes {
+			s.Get(resident)
+		}
+		s.Insert(key, key)
+	}
+	stats := s.ScanStats()
+	if stats.FullSweeps != 4 || stats.Cleared != 16 {
+		t.Fatalf("Expected 4 full sweeps clearing 16 bits, got %+v", stats)
+	}
+	if growBy := s.Recommendation(); growBy != 4 {
+		t.Errorf("Expected to double the capacity, got %d", growBy)
+	}
+
+	// As many evictions again without reuse halve the suggestion
+	for key := 8; key < 12; key++ {
+		s.Insert(key, key)
+	}
+	if growBy := s.Recommendation(); growBy != 2 {
+		t.Errorf("Expected a recommendation of 2, got %d", growBy)
+	}
+	if s.Capacity != 4 {
+		t.Error("Recommendation must not change the capacity")
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_InsertAt(t *testing.T) {
+	head := NewSieve[string](3)
+	tail := NewSieveInsertAt[string](3, InsertAtTail)
+	for _, s := range []*Sieve[string]{head, tail} {
+		s.Insert("key1", "data1")
+		s.Insert("key2", "data2")
+		s.Insert("key3", "data3")
+	}
+
+	if qVals := getQueueValues(head.FifoQueue); fmt.Sprint(qVals) != "[data3 data2 data1]" {
+		t.Errorf("Expected head inserts to queue [data3 data2 data1], got %v", qVals)
+	}
+	if qVals := getQueueValues(tail.FifoQueue); fmt.Sprint(qVals) != "[data1 data2 data3]" {
+		t.Errorf("Expected tail inserts to queue [data1 data2 data3], got %v", qVals)
+	}
+
+	// The hand starts at the tail: the oldest object with head inserts,
+	// the newest one with tail inserts
+	head.Get("key2")
+	tail.Get("key2")
+	head.Insert("key4", "data4")
+	tail.Insert("key4", "data4")
+	if _, present := head.Nodes["key1"]; present {
+		t.Error("Expected head inserts to evict the oldest object key1")
+	}
+	if _, present := tail.Nodes["key3"]; present {
+		t.Error("Expected tail inserts to evict the newest unvisited object key3")
+	}
+
+	for i := 5; i < 20; i++ {
+		key := fmt.Sprintf("key%d", i)
+		head.Insert(key, key)
+		tail.Insert(key, key)
+		head.Get(fmt.Sprintf("key%d", i-1))
+		tail.Get(fmt.Sprintf("key%d", i-1))
+	}
+
+	checkInvariants(t, head)
+	checkInvariants(t, tail)
+}
+
+func TestSieve_Entries(t *testing.T) {
+	s := NewSieve[string](3)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+	s.Insert("key3", "data3")
+
+	restored := NewSieve[string](3)
+	for _, entry := range s.Entries() {
+		restored.Insert(entry.Key, entry.Value)
+	}
+	if got, want := fmt.Sprint(getQueueValues(restored.FifoQueue)), fmt.Sprint(getQueueValues(s.FifoQueue)); got != want {
+		t.Errorf("Expected replaying Entries to rebuild %s, got %s", want, got)
+	}
+
+	checkInvariants(t, s)
+	checkInvariants(t, restored)
+}
+
+func TestSieve_Weight(t *testing.T) {
+	s := NewSieveWithWeight[string](10, func(value any) int {
+		return len(value.(string))
+	})
+
+	s.Insert("a", "aaaa")
+	s.Insert("b", "bbb")
+	s.Insert("c", "cc")
+	if s.CurrentWeight() != 9 {
+		t.Errorf("Expected weight 9, got %d", s.CurrentWeight())
+	}
+
+	s.Get("a")
+	s.Insert("d", "dddd") // the hand skips the visited a, evicting b frees enough
+	if s.CurrentWeight() != 10 {
+		t.Errorf("Expected weight 10, got %d", s.CurrentWeight())
+	}
+	if _, present := s.Nodes["b"]; present {
+		t.Error("Expected b to be evicted")
+	}
+	if _, present := s.Nodes["a"]; !present {
+		t.Error("Expected the visited a to survive")
+	}
+
+	s.Insert("c", "ccccc") // c weighs 3 more, the hand moves on to d
+	if s.CurrentWeight() != 9 {
+		t.Errorf("Expected weight 9, got %d", s.CurrentWeight())
+	}
+	if _, present := s.Nodes["d"]; present {
+		t.Error("Expected d to be evicted")
+	}
+
+	s.Insert("huge", "hhhhhhhhhhh")
+	if _, present := s.Nodes["huge"]; present || s.CurrentWeight() != 9 {
+		t.Error("Expected a value heavier than MaxWeight to be dropped")
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_Weight_Default(t *testing.T) {
+	s := NewSieve[string](3)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+	s.Insert("key3", "data3")
+	s.Insert("key4", "data4")
+
+	if s.CurrentWeight() != len(s.Nodes) {
+		t.Errorf("Expected every value to weigh 1, got %d for %d nodes", s.CurrentWeight(), len(s.Nodes))
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_GetTraced(t *testing.T) {
+	s := NewSieve[string](2)
+	s.Insert("key1", "data1")
+	s.Insert("key2", "data2")
+
+	if found, secondChance := s.GetTraced("key1"); !found || !secondChance {
+		t.Errorf("Expected the first access to grant a second chance, got (%v, %v)", found, secondChance)
+	}
+	if found, secondChance := s.GetTraced("key1"); !found || secondChance {
+		t.Errorf("Expected a visited node not to be granted another, got (%v, %v)", found, secondChance)
+	}
+	if found, secondChance := s.GetTraced("missing"); found || secondChance {
+		t.Errorf("Expected a miss, got (%v, %v)", found, secondChance)
+	}
+
+	s.Insert("key3", "data3") // the hand clears key1 and evicts key2
+	if found, secondChance := s.GetTraced("key1"); !found || !secondChance {
+		t.Errorf("Expected a node the hand passed to earn a new second chance, got (%v, %v)", found, secondChance)
+	}
+
+	if stats := s.Stats(); stats.Hits != 3 || stats.Misses != 1 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	s.Get("key3")
+	if scan := s.ScanStats(); scan.SecondChances != 3 {
+		t.Errorf("Expected 3 second chances, got %d", scan.SecondChances)
+	}
+
+	checkInvariants(t, s)
+}
+
+func TestSieve_String(t *testing.T) {
+	s := NewSieve[string](3)
+	if s.String() != "[]" {
+		t.Errorf("Expected an empty queue, got %q", s.String())
+	}
+
+	s.Insert("k1", "data1")
+	s.Insert("k2", "data2")
+	s.Insert("k3", "data3")
+	s.Get("k2")
+
+	var _ fmt.Stringer = s
+	if got := fmt.Sprint(s); got != "[k3 k2* <H>k1]" {
+		t.Errorf("Unexpected dump %q", got)
+	}
+
+	s.Get("k3")
+	s.Insert("k4", "data4") // k1 is evicted, the hand moves on to k2
+	if got := s.String(); got != "[k4 k3* <H>k2*]" {
+		t.Errorf("Unexpected dump after an eviction %q", got)
+	}
+
+	checkInvariants(t, s)
+}
+
+func FuzzSieve(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		sieve := NewSieve[int](4)
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { sieve.Get(key) },
+			Set:             func(key, value int) { sieve.Insert(key, value) },
+			Delete:          func(key int) { sieve.Delete(key) },
+			CheckInvariants: sieve.CheckInvariants,
+		})
+	})
+}
+
+func TestSieve_ConcurrentGet(t *testing.T) {
+	const keys, readers = 100, 8
+	s := NewSieve[int](keys)
+	for i := 0; i < keys; i++ {
+		s.Insert(i, i)
+	}
+
+	var wg sync.WaitGroup
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				s.Get(i)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every node was granted exactly one second chance, however the
+	// readers interleaved.
+	if got := s.ScanStats().SecondChances; got != keys {
+		t.Errorf("Expected %d second chances, got %d", keys, got)
+	}
+	if stats := s.Stats(); stats.Hits != keys*readers {
+		t.Errorf("Expected %d hits, got %d", keys*readers, stats.Hits)
+	}
+	if err := s.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// BenchmarkSieve_ParallelGet measures hits from many goroutines at once,
+// with an occasional insert competing for the lock
+func BenchmarkSieve_ParallelGet(b *testing.B) {
+	const keys = 1024
+	s := NewSieve[int](keys)
+	for i := 0; i < keys; i++ {
+		s.Insert(i, i)
+	}
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if i%1000 == 999 {
+				s.Insert(i%keys, i)
+			} else {
+				s.Get(i % keys)
+			}
+			i++
+		}
+	})
+}
+
+// TestSieve_EvictByTag tests that tagged nodes leave the queue together
+// and that the hand ends on a node that is still linked
+func TestSieve_EvictByTag(t *testing.T) {
+	s := NewSieve[string](6)
+	s.Insert("a", "a")
+	for _, key := range []string{"b", "c", "d"} {
+		s.InsertWithTags(key, key, []string{"t", "t"})
+	}
+	s.InsertWithTags("e", "e", []string{"u"})
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		s.Get(key)
+	}
+	checkInvariants(t, s)
+
+	// Whatever order the tagged nodes go in, the hand steps over c and d
+	// towards the head and stops on e.
+	s.hand = s.Nodes["c"]
+	if n := s.EvictByTag("t"); n != 3 {
+		t.Errorf("Expected 3 nodes evicted, got %d", n)
+	}
+	if s.hand != s.Nodes["e"] {
+		t.Errorf("Expected the hand on e, got %v", s.hand)
+	}
+	if got := s.String(); got != "[<H>e* a*]" {
+		t.Errorf("Unexpected queue %q", got)
+	}
+	if len(s.Nodes) != 2 || s.Stats().Evictions != 3 {
+		t.Errorf("Expected a and e to stay after 3 evictions, got %+v", s.Stats())
+	}
+	checkInvariants(t, s)
+
+	// e is next to the head, the hand wraps to nil.
+	if n := s.EvictByTag("u"); n != 1 || s.hand != nil {
+		t.Errorf("Expected e evicted and the hand reset, got %d and %v", n, s.hand)
+	}
+	if n := s.EvictByTag("t"); n != 0 {
+		t.Errorf("Expected nothing left under t, got %d", n)
+	}
+	checkInvariants(t, s)
+}
+
+// TestSieve_TagsFollowTheNode tests that replacing or evicting a node drops its tags
+func TestSieve_TagsFollowTheNode(t *testing.T) {
+	s := NewSieve[string](2)
+	s.InsertWithTags("a", "a", []string{"t"})
+	s.Insert("a", "a2")
+	if _, ok := s.tags["t"]; ok {
+		t.Error("Expected a plain Insert to drop the tags of the node it replaces")
+	}
+
+	s.InsertWithTags("b", "b", []string{"t"})
+	s.InsertWithTags("c", "c", []string{"t"}) // evicts a
+	s.InsertWithTags("d", "d", []string{"t"}) // evicts b
+	if len(s.tags["t"]) != 2 {
+		t.Errorf("Expected only c and d indexed, got %v", s.tags)
+	}
+	checkInvariants(t, s)
+
+	encoded, _ := json.Marshal(s)
+	if err := json.Unmarshal(encoded, s); err != nil {
+		t.Fatal(err)
+	}
+	if s.EvictByTag("t") != 0 || len(s.Nodes) != 2 {
+		t.Error("Expected the tags not to survive a JSON round trip")
+	}
+	checkInvariants(t, s)
 }
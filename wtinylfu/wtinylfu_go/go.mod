@@ -0,0 +1,7 @@
+module wtinylfu_go
+
+go 1.22.2
+
+require cache_go v0.0.0
+
+replace cache_go => ../../cache/cache_go
@@ -0,0 +1,69 @@
+package wtinylfu
+
+// segment is the region of the cache a node currently lives in.
+type segment int
+
+const (
+	window segment = iota
+	probation
+	protected
+)
+
+type node[K comparable, V any] struct {
+	key     K
+	value   V
+	segment segment
+	prev    *node[K, V]
+	next    *node[K, V]
+}
+
+// list is a doubly linked list between a head and a tail sentinel, most
+// recently used at the head. Nodes move from one list to another as they
+// change segment, so a key keeps the node it was stored with.
+type list[K comparable, V any] struct {
+	head *node[K, V]
+	tail *node[K, V]
+	len  int
+}
+
+func newList[K comparable, V any]() *list[K, V] {
+	head := &node[K, V]{}
+	tail := &node[K, V]{}
+	head.next = tail
+	tail.prev = head
+
+	return &list[K, V]{
+		head: head,
+		tail: tail,
+	}
+}
+
+func (l *list[K, V]) pushFront(n *node[K, V]) {
+	n.prev = l.head
+	n.next = l.head.next
+	l.head.next.prev = n
+	l.head.next = n
+	l.len++
+}
+
+func (l *list[K, V]) remove(n *node[K, V]) {
+	n.prev.next = n.next
+	n.next.prev = n.prev
+	n.prev = nil
+	n.next = nil
+	l.len--
+}
+
+func (l *list[K, V]) moveToFront(n *node[K, V]) {
+	l.remove(n)
+	l.pushFront(n)
+}
+
+// back returns the least recently used node, or nil if the list is
+// empty.
+func (l *list[K, V]) back() *node[K, V] {
+	if l.len == 0 {
+		return nil
+	}
+	return l.tail.prev
+}
@@ -0,0 +1,81 @@
+package wtinylfu
+
+// slru is the main region of the cache, a segmented LRU: keys enter the
+// probation segment and a hit there promotes them to the protected one,
+// whose least recently used key is demoted back to probation when it is
+// full. Keys used once never push out keys used twice.
+type slru[K comparable, V any] struct {
+	probation *list[K, V]
+	protected *list[K, V]
+
+	capacity     int
+	protectedCap int
+}
+
+// newSLRU creates a main region of capacity keys, 80% of them
+// protected.
+func newSLRU[K comparable, V any](capacity int) *slru[K, V] {
+	return &slru[K, V]{
+		probation:    newList[K, V](),
+		protected:    newList[K, V](),
+		capacity:     capacity,
+		protectedCap: capacity * 8 / 10,
+	}
+}
+
+func (s *slru[K, V]) len() int {
+	return s.probation.len + s.protected.len
+}
+
+// full reports whether a new key needs a victim to make room.
+func (s *slru[K, V]) full() bool {
+	return s.len() >= s.capacity
+}
+
+// add puts a new key in probation, as its most recently used key.
+func (s *slru[K, V]) add(n *node[K, V]) {
+	n.segment = probation
+	s.probation.pushFront(n)
+}
+
+// hit makes n the most recently used key of its segment, promoting it
+// to protected from probation, demoting the protected segment's least
+// recently used key if needed.
+func (s *slru[K, V]) hit(n *node[K, V]) {
+	if n.segment == protected {
+		s.protected.moveToFront(n)
+		return
+	}
+	if s.protectedCap == 0 {
+		s.probation.moveToFront(n)
+		return
+	}
+
+	s.probation.remove(n)
+	if s.protected.len >= s.protectedCap {
+		demoted := s.protected.back()
+		s.protected.remove(demoted)
+		s.add(demoted)
+	}
+	n.segment = protected
+	s.protected.pushFront(n)
+}
+
+// victim returns the key a new one would replace, the least recently
+// used probation key, or protected one if probation is empty. It is nil
+// for an empty region.
+func (s *slru[K, V]) victim() *node[K, V] {
+	if victim := s.probation.back(); victim != nil {
+		return victim
+	}
+	return s.protected.back()
+}
+
+// remove unlinks n from its segment.
+func (s *slru[K, V]) remove(n *node[K, V]) {
+	if n.segment == protected {
+		s.protected.remove(n)
+		return
+	}
+	s.probation.remove(n)
+}
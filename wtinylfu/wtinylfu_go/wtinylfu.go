@@ -0,0 +1,249 @@
+package wtinylfu
+
+import (
+	"fmt"
+	"sync"
+
+	cachego "cache_go"
+	"cache_go/sketch"
+)
+
+// WTinyLFU is a Window TinyLFU cache. New keys enter a small window LRU.
+// Keys pushed out of the window compete for a place in the main region,
+// an SLRU split into probation and protected segments: a count-min
+// sketch estimates how often both the window victim and the main
+// region's victim were referenced, and only the more popular of the two
+// stays. The window lets bursts of new keys build up a frequency, the
+// admission filter keeps one-hit wonders from flushing the main region.
+type WTinyLFU[K comparable, V any] struct {
+	Mu       sync.Mutex
+	Capacity int
+
+	items     map[K]*node[K, V]
+	window    *list[K, V]
+	windowCap int
+	main      *slru[K, V]
+
+	sketch     *sketch.CountMin
+	hash       func(K) uint64
+	sampleSize uint64
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+}
+
+// NewWTinyLFU creates a cache holding at most capacity keys, 1% of them
+// (at least one) in the window and 80% of the main region protected.
+// hash maps a key to the 64 bits the frequency sketch counts, e.g.
+// maphash.String with a seed for string keys; keys it maps alike share
+// their estimated frequency.
+func NewWTinyLFU[K comparable, V any](capacity int, hash func(K) uint64) *WTinyLFU[K, V] {
+	if capacity <= 0 {
+		panic("capacity has to be greater than 0")
+	}
+	if hash == nil {
+		panic("hash cannot be nil")
+	}
+
+	windowCap := max(capacity/100, 1)
+
+	return &WTinyLFU[K, V]{
+		Capacity:   capacity,
+		items:      make(map[K]*node[K, V], capacity),
+		window:     newList[K, V](),
+		windowCap:  windowCap,
+		main:       newSLRU[K, V](capacity - windowCap),
+		sketch:     sketch.NewCountMin(4 * capacity),
+		hash:       hash,
+		sampleSize: uint64(10 * capacity),
+	}
+}
+
+// record counts a reference to key in the sketch, halving every counter
+// once a sample of ten references per slot has been seen so the
+// estimates follow the current workload.
+func (c *WTinyLFU[K, V]) record(key K) {
+	c.sketch.Add(c.hash(key))
+	if c.sketch.Adds() >= c.sampleSize {
+		c.sketch.Reset()
+	}
+}
+
+func (c *WTinyLFU[K, V]) estimate(key K) uint32 {
+	return c.sketch.Estimate(c.hash(key))
+}
+
+// touch moves a node after a hit: within the window it becomes the
+// most recently used, in the main region it is handled as an SLRU hit.
+func (c *WTinyLFU[K, V]) touch(n *node[K, V]) {
+	if n.segment == window {
+		c.window.moveToFront(n)
+		return
+	}
+	c.main.hit(n)
+}
+
+// Get returns the value of key. Every lookup, hit or miss, counts
+// towards the key's estimated frequency.
+func (c *WTinyLFU[K, V]) Get(key K) (V, bool) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.record(key)
+	n, present := c.items[key]
+	if !present {
+		c.misses++
+		var zeroValue V
+		return zeroValue, false
+	}
+
+	c.hits++
+	c.touch(n)
+	return n.value, true
+}
+
+// Set stores value under key. Updating a resident key moves it the way
+// a Get hit does, but only Get counts hits and misses in Stats; a new
+// key enters the window, which may push the window's LRU key into the
+// admission contest for the main region.
+func (c *WTinyLFU[K, V]) Set(key K, value V) {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	c.record(key)
+	if n, present := c.items[key]; present {
+		n.value = value
+		c.touch(n)
+		return
+	}
+
+	n := &node[K, V]{key: key, value: value, segment: window}
+	c.items[key] = n
+	c.window.pushFront(n)
+
+	if c.window.len > c.windowCap {
+		candidate := c.window.back()
+		c.window.remove(candidate)
+		c.admit(candidate)
+	}
+}
+
+// admit decides whether a key leaving the window gets into the main
+// region. While there is room it always does, after that it has to be
+// estimated more popular than the main region's victim.
+func (c *WTinyLFU[K, V]) admit(candidate *node[K, V]) {
+	if !c.main.full() {
+		c.main.add(candidate)
+		return
+	}
+
+	victim := c.main.victim()
+	if victim == nil || c.estimate(candidate.key) <= c.estimate(victim.key) {
+		delete(c.items, candidate.key)
+		c.evictions++
+		return
+	}
+
+	c.main.remove(victim)
+	delete(c.items, victim.key)
+	c.evictions++
+
+	c.main.add(candidate)
+}
+
+func (c *WTinyLFU[K, V]) Delete(key K) bool {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	n, present := c.items[key]
+	if !present {
+		return false
+	}
+
+	if n.segment == window {
+		c.window.remove(n)
+	} else {
+		c.main.remove(n)
+	}
+	delete(c.items, key)
+	return true
+}
+
+func (c *WTinyLFU[K, V]) Len() int {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return len(c.items)
+}
+
+// Entries returns the protected, probation and window keys in that
+// order, each segment from its least to its most recently used key.
+func (c *WTinyLFU[K, V]) Entries() []cachego.Entry[K, V] {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	entries := make([]cachego.Entry[K, V], 0, len(c.items))
+	for _, l := range []*list[K, V]{c.main.protected, c.main.probation, c.window} {
+		for n := l.tail.prev; n != l.head; n = n.prev {
+			entries = append(entries, cachego.Entry[K, V]{Key: n.key, Value: n.value})
+		}
+	}
+	return entries
+}
+
+func (c *WTinyLFU[K, V]) Stats() cachego.Stats {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	return cachego.Stats{
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+		Len:       len(c.items),
+		Cap:       c.Capacity,
+	}
+}
+
+// CheckInvariants reports the first inconsistency between the segments
+// and the items map: every key linked in the segment it is marked with
+// and nowhere else, the recorded lengths matching the links, and the
+// window, the protected segment and the main region within their
+// capacities.
+func (c *WTinyLFU[K, V]) CheckInvariants() error {
+	c.Mu.Lock()
+	defer c.Mu.Unlock()
+
+	count := 0
+	for s, l := range []*list[K, V]{window: c.window, probation: c.main.probation, protected: c.main.protected} {
+		linked := 0
+		prev := l.head
+		for n := l.head.next; n != l.tail; n = n.next {
+			if n.prev != prev {
+				return fmt.Errorf("key %v in segment %d has a broken prev link", n.key, s)
+			}
+			if n.segment != segment(s) {
+				return fmt.Errorf("key %v is linked in segment %d but marked %d", n.key, s, n.segment)
+			}
+			if c.items[n.key] != n {
+				return fmt.Errorf("key %v in segment %d is not the one in the map", n.key, s)
+			}
+			linked++
+			if linked > len(c.items) {
+				return fmt.Errorf("segment %d links more keys than the map holds", s)
+			}
+			prev = n
+		}
+		if l.tail.prev != prev || linked != l.len {
+			return fmt.Errorf("segment %d links %d keys but records %d", s, linked, l.len)
+		}
+		count += linked
+	}
+	if count != len(c.items) {
+		return fmt.Errorf("segments hold %d keys but the map holds %d", count, len(c.items))
+	}
+	if c.window.len > c.windowCap || c.main.protected.len > c.main.protectedCap || c.main.len() > c.main.capacity {
+		return fmt.Errorf("segments over capacity: window %d, probation %d, protected %d", c.window.len, c.main.probation.len, c.main.protected.len)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package wtinylfu
+
+import (
+	"hash/maphash"
+	"testing"
+
+	cachego "cache_go"
+	"cache_go/cachetest"
+)
+
+var _ cachego.Cache[string, int] = (*WTinyLFU[string, int])(nil)
+
+var seed = maphash.MakeSeed()
+
+func hashString(key string) uint64 { return maphash.String(seed, key) }
+func hashInt(key int) uint64       { return uint64(key) }
+
+// checkSegments fails the test if the segments and the map disagree or
+// overflow their capacities
+func checkSegments[K comparable, V any](t *testing.T, c *WTinyLFU[K, V]) {
+	t.Helper()
+	if err := c.CheckInvariants(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestNewWTinyLFUPanics tests that a non positive capacity and a nil hash are rejected
+func TestNewWTinyLFUPanics(t *testing.T) {
+	for name, create := range map[string]func(){
+		"capacity 0": func() { NewWTinyLFU[string, int](0, hashString) },
+		"a nil hash": func() { NewWTinyLFU[string, int](10, nil) },
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil {
+					t.Errorf("Expected panic for %s", name)
+				}
+			}()
+			create()
+		}()
+	}
+}
+
+// TestGetSet tests basic reads, writes and deletes
+func TestGetSet(t *testing.T) {
+	c := NewWTinyLFU[string, int](10, hashString)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("a", 3)
+
+	if value, ok := c.Get("a"); !ok || value != 3 {
+		t.Errorf("Expected (3, true), got (%d, %v)", value, ok)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Expected a miss for a missing key")
+	}
+	if !c.Delete("b") || c.Delete("b") {
+		t.Error("Expected Delete to report b once")
+	}
+	if c.Len() != 1 {
+		t.Errorf("Expected Len 1, got %d", c.Len())
+	}
+
+	stats := c.Stats()
+	if stats.Hits != 1 || stats.Misses != 1 || stats.Cap != 10 {
+		t.Errorf("Expected 1 hit, 1 miss and Cap 10, got %+v", stats)
+	}
+	checkSegments(t, c)
+}
+
+// TestProbationHitPromotes tests that a second hit in the main region moves a key to protected
+func TestProbationHitPromotes(t *testing.T) {
+	c := NewWTinyLFU[string, int](10, hashString) // window 1, main 9, protected 7
+	c.Set("a", 1)
+	c.Set("b", 2) // a leaves the window for probation
+
+	if c.items["a"].segment != probation {
+		t.Fatalf("Expected a in probation, got segment %d", c.items["a"].segment)
+	}
+	c.Get("a")
+	if c.items["a"].segment != protected {
+		t.Errorf("Expected a to be promoted to protected, got segment %d", c.items["a"].segment)
+	}
+	checkSegments(t, c)
+}
+
+// TestScanResistance tests that a one-off scan does not flush frequently used keys
+func TestScanResistance(t *testing.T) {
+	c := NewWTinyLFU[int, int](100, hashInt)
+
+	for round := 0; round < 20; round++ {
+		for key := 0; key < 50; key++ {
+			if _, ok := c.Get(key); !ok {
+				c.Set(key, key)
+			}
+		}
+	}
+
+	for key := 1000; key < 3000; key++ {
+		if _, ok := c.Get(key); !ok {
+			c.Set(key, key)
+		}
+	}
+
+	kept := 0
+	for key := 0; key < 50; key++ {
+		if _, ok := c.items[key]; ok {
+			kept++
+		}
+	}
+	if kept < 45 {
+		t.Errorf("Expected the hot keys to survive the scan, only %d of 50 did", kept)
+	}
+	if c.Len() > c.Capacity {
+		t.Errorf("Expected at most %d keys, got %d", c.Capacity, c.Len())
+	}
+	checkSegments(t, c)
+}
+
+// TestCapacityOne tests the smallest cache, which has no main region
+func TestCapacityOne(t *testing.T) {
+	c := NewWTinyLFU[string, int](1, hashString)
+	c.Set("a", 1)
+	c.Set("b", 2)
+
+	if _, ok := c.Get("b"); !ok {
+		t.Error("Expected the newest key to be resident")
+	}
+	if c.Len() != 1 || c.Stats().Evictions != 1 {
+		t.Errorf("Expected 1 key and 1 eviction, got %+v", c.Stats())
+	}
+	checkSegments(t, c)
+}
+
+// TestEntries tests that replaying Entries into a new cache restores every key
+func TestEntries(t *testing.T) {
+	c := NewWTinyLFU[int, int](20, hashInt)
+	for key := 0; key < 20; key++ {
+		c.Set(key, key*10)
+	}
+	c.Get(3)
+
+	entries := c.Entries()
+	if len(entries) != c.Len() {
+		t.Fatalf("Expected %d entries, got %d", c.Len(), len(entries))
+	}
+
+	restored := NewWTinyLFU[int, int](20, hashInt)
+	for _, entry := range entries {
+		restored.Set(entry.Key, entry.Value)
+	}
+	for _, entry := range entries {
+		if value, ok := restored.Get(entry.Key); !ok || value != entry.Value {
+			t.Errorf("Expected %d to be restored as %d, got (%d, %v)", entry.Key, entry.Value, value, ok)
+		}
+	}
+	checkSegments(t, restored)
+}
+
+// FuzzWTinyLFU tests that no stream of operations leaves the segments inconsistent
+func FuzzWTinyLFU(f *testing.F) {
+	cachetest.Seed(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		c := NewWTinyLFU[int, int](8, hashInt)
+
+		cachetest.Run(t, data, cachetest.Policy{
+			Get:             func(key int) { c.Get(key) },
+			Set:             func(key, value int) { c.Set(key, value) },
+			Delete:          func(key int) { c.Delete(key) },
+			CheckInvariants: c.CheckInvariants,
+		})
+	})
+}